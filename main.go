@@ -14,26 +14,47 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	log "github.com/Sirupsen/logrus"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/admission"
 	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
-	"github.com/grieshaber/generic-autoscaler-controller/pkg/autoscaler"
-	"github.com/grieshaber/generic-autoscaler-controller/pkg/autoscalerv2"
 	"github.com/grieshaber/generic-autoscaler-controller/pkg/client/clientset/versioned"
 	"github.com/grieshaber/generic-autoscaler-controller/pkg/client/informers/externalversions"
-	"github.com/grieshaber/generic-autoscaler-controller/util"
+	listers "github.com/grieshaber/generic-autoscaler-controller/pkg/client/listers/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/controller"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/ingest"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/metrics"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/monitoring"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/server"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/sharding"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/webhook"
+	"io/ioutil"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
 	"time"
 )
 
-var rules = make(map[string]*v1.AutoscalingRule)
-
-func init() {
-	log.SetLevel(log.DebugLevel)
-}
+var (
+	configFile           = flag.String("config", "", "Path to the controller configuration file (optional)")
+	configReloadInterval = flag.Duration("configReloadInterval", 10*time.Second, "Period between checks of the configuration file for changes")
+	rulesNamespace       = flag.String("rulesNamespace", metav1.NamespaceAll, "Namespace to look for autoscaling rules")
+	targetNamespace      = flag.String("targetNamespace", metav1.NamespaceAll, "Namespace, the target is deployed in")
+	targetName           = flag.String("targetName", "workload-sim-dummy", "Name of the target")
+	targetKind           = flag.String("targetKind", "Deployment", "Kind of the target")
+	minReplicas          = flag.Int("minReplicas", 1, "Minimum number of replicas")
+	maxReplicas          = flag.Int("maxReplicas", 10, "Maximum number of replicas")
+	calmdownInts         = flag.Int64("calmdownInts", 3, "Number of calmdown intervals")
+	checkInterval        = flag.Int("checkInterval", 5, "Period between intervals in s")
+	usev2                = flag.Bool("usev2", true, "Evaluate rules that do not name an algorithm with the trend algorithm")
+	dryRun               = flag.Bool("dryRun", false, "Evaluate rules and record decisions without scaling any target")
+)
 
 func getConfig() *rest.Config {
 	config, err := rest.InClusterConfig()
@@ -61,73 +82,251 @@ func getRulesClientset(config *rest.Config) *versioned.Clientset {
 	return clientset
 }
 
-func createRulesInformer(rulesClientset *versioned.Clientset, namespace string) cache.SharedIndexInformer {
+func createRulesInformer(rulesClientset *versioned.Clientset, namespace string) (cache.SharedIndexInformer, listers.AutoscalingRuleLister) {
 	factory := externalversions.NewSharedInformerFactoryWithOptions(rulesClientset, 0, externalversions.WithNamespace(namespace))
 	informer := factory.Bsinfo().V1().AutoscalingRules().Informer()
+	lister := factory.Bsinfo().V1().AutoscalingRules().Lister()
 
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    onAdd,
 		DeleteFunc: onDelete,
 	})
-	return informer
+	return informer, lister
 }
 
-func main() {
+// overrideWithFlags lets explicitly set command line flags take precedence over the values of the configuration
+// file, including the per-target overrides.
+func overrideWithFlags(cfg *config.Config) {
+	targetFlagSet := false
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "rulesNamespace":
+			cfg.RulesNamespace = *rulesNamespace
+		case "targetNamespace", "targetName", "targetKind":
+			targetFlagSet = true
+		case "minReplicas":
+			cfg.Defaults.MinReplicas = *minReplicas
+			for i := range cfg.Targets {
+				cfg.Targets[i].MinReplicas = nil
+			}
+		case "maxReplicas":
+			cfg.Defaults.MaxReplicas = *maxReplicas
+			for i := range cfg.Targets {
+				cfg.Targets[i].MaxReplicas = nil
+			}
+		case "calmdownInts":
+			cfg.Defaults.CalmdownInts = *calmdownInts
+			for i := range cfg.Targets {
+				cfg.Targets[i].CalmdownInts = nil
+			}
+		case "checkInterval":
+			cfg.Defaults.CheckInterval = *checkInterval
+			for i := range cfg.Targets {
+				cfg.Targets[i].CheckInterval = nil
+			}
+		case "usev2":
+			cfg.Defaults.UseV2 = *usev2
+			for i := range cfg.Targets {
+				cfg.Targets[i].UseV2 = nil
+			}
+		case "dryRun":
+			cfg.Defaults.DryRun = *dryRun
+			for i := range cfg.Targets {
+				cfg.Targets[i].DryRun = nil
+			}
+		}
+	})
+
+	if targetFlagSet || len(cfg.Targets) == 0 {
+		cfg.Targets = []config.TargetConfig{{Namespace: *targetNamespace, Name: *targetName, Kind: *targetKind}}
+	}
+}
+
+func loadConfig() (*config.Config, *config.Watcher) {
+	if *configFile == "" {
+		cfg := config.Default()
+		overrideWithFlags(cfg)
+		if err := cfg.Validate(); err != nil {
+			log.Panic("Invalid parameters: ", err)
+		}
+		return cfg, nil
+	}
+
+	watcher := config.NewWatcher(*configFile, *configReloadInterval, overrideWithFlags, onConfigChange)
+	cfg, err := watcher.Load()
+	if err != nil {
+		log.Panicf("Could not load configuration file %s: %v", *configFile, err)
+	}
+	return cfg, watcher
+}
+
+func readToken(path string) string {
+	if path == "" {
+		return ""
+	}
+	token, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Panicf("Could not read token file %s: %v", path, err)
+	}
+	return strings.TrimSpace(string(token))
+}
+
+func configureLogging(logging config.LoggingConfig) {
+	// Both values are validated beforehand
+	level, _ := log.ParseLevel(logging.Level)
+	log.SetLevel(level)
+
+	if logging.Format == "json" {
+		log.SetFormatter(&log.JSONFormatter{})
+	} else {
+		log.SetFormatter(&log.TextFormatter{})
+	}
+}
+
+func shardIdentity(cfg config.ShardingConfig) string {
+	if cfg.Identity != "" {
+		return cfg.Identity
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Panic("Could not determine shard identity: ", err)
+	}
+	return hostname
+}
 
-	rulesNamespace := flag.String("rulesNamespace", metav1.NamespaceAll, "Namespace to look for autoscaling rules")
-	targetNamespace := flag.String("targetNamespace", metav1.NamespaceAll, "Namespace, the target is deployed in")
-	targetName := flag.String("targetName", "workload-sim-dummy", "Name of the target")
-	targetKind := flag.String("targetKind", "Deployment", "Kind of the target")
-	minReplicas := flag.Int("minReplicas", 1, "Minimum number of replicas")
-	maxReplicas := flag.Int("maxReplicas", 10, "Maximum number of replicas")
-	calmdownInts := flag.Int64("calmdownInts", 3, "Number of calmdown intervals")
-	checkInterval := flag.Int("checkInterval", 5, "Period between intervals in s")
-	usev2 := flag.Bool("usev2", true, "Use advanced rules")
+var (
+	activeConfig *config.Config
+	ctrl         *controller.Controller
+)
+
+func onConfigChange(cfg *config.Config) {
+	if cfg.RulesNamespace != activeConfig.RulesNamespace {
+		log.Warnf("Changing rulesNamespace from %q to %q requires a restart", activeConfig.RulesNamespace, cfg.RulesNamespace)
+	}
+	if cfg.Server.Port != activeConfig.Server.Port {
+		log.Warnf("Changing server.port from %d to %d requires a restart", activeConfig.Server.Port, cfg.Server.Port)
+	}
+	if cfg.Webhook != activeConfig.Webhook {
+		log.Warn("Changing the webhook configuration requires a restart")
+	}
+	if !reflect.DeepEqual(cfg.Ingest, activeConfig.Ingest) {
+		log.Warn("Changing the ingest configuration requires a restart")
+	}
+	if cfg.Admission != activeConfig.Admission {
+		log.Warn("Changing the admission configuration requires a restart")
+	}
+	if cfg.Sharding != activeConfig.Sharding {
+		log.Warn("Changing the sharding configuration requires a restart")
+	}
+
+	configureLogging(cfg.Logging)
+	ctrl.Apply(cfg)
+	activeConfig = cfg
+	log.Info("Applied new configuration.")
+}
 
+func main() {
 	flag.Parse()
 
-	fmt.Printf("Starting the GenericAutoscalerController with following Parameters: \n\trulesNamespace: %v"+
-		"\n\ttargetNamespace: %v \n\ttargetName: %v \n\ttargetKind: %v\n\tminReplicas: %v\n\tmaxReplicas: %v"+
-		"\n\tcalmdownInts: %v\n\tcheckInterval: %v\n\tusev2: %v", *rulesNamespace, *targetNamespace, *targetName, *targetKind, *minReplicas,
-		*maxReplicas, *calmdownInts, *checkInterval, *usev2)
+	cfg, watcher := loadConfig()
+	configureLogging(cfg.Logging)
+	activeConfig = cfg
 
-	target := *util.NewTarget(*targetNamespace, *targetName, *targetKind)
+	log.Infof("Starting the GenericAutoscalerController (rulesNamespace: %q, configuration file: %q)", cfg.RulesNamespace, *configFile)
 
 	log.Info("Start GA-Controller..")
 	stopChan := make(chan struct{})
-	defer close(stopChan)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Infof("Received %v, shutting down..", sig)
+		close(stopChan)
+	}()
 
-	config := getConfig()
-	clientset := getKubernetesClientset(config)
-	rulesClientset := getRulesClientset(config)
+	restConfig := getConfig()
+	clientset := getKubernetesClientset(restConfig)
+	rulesClientset := getRulesClientset(restConfig)
 
 	log.Debug("Create informer to keep track of autoscaling rules..")
-	informer := createRulesInformer(rulesClientset, *rulesNamespace)
+	informer, lister := createRulesInformer(rulesClientset, cfg.RulesNamespace)
 	go informer.Run(stopChan)
+	if !cache.WaitForCacheSync(stopChan, informer.HasSynced) {
+		log.Panic("Could not sync autoscaling rules")
+	}
 	log.Info("Infomer started.")
 
-	log.Debug("Start autoscaler..")
+	metrics.Register(metrics.NewCustomSource(clientset.RESTClient(), clientset))
+	metrics.Register(metrics.NewHTTPSource(clientset))
+	metrics.Register(metrics.NewPrometheusSource())
+	metrics.Register(metrics.NewExternalSource(clientset.RESTClient()))
+	metrics.Register(metrics.NewResourceSource(clientset))
+	store := ingest.NewStore(time.Duration(cfg.Ingest.TTL) * time.Second)
+	metrics.Register(metrics.NewPushSource(store))
+	metrics.Register(metrics.NewReplaySource())
 
-	if *usev2 {
-		scaler := autoscalerv2.New(clientset, time.Duration(*checkInterval)*time.Second, target, *calmdownInts, rules, *minReplicas, *maxReplicas)
-		go scaler.Run()
-	} else {
-		scaler := autoscaler.New(clientset, time.Duration(*checkInterval)*time.Second, target, *calmdownInts, rules, *minReplicas, *maxReplicas)
-		go scaler.Run()
+	log.Debug("Start autoscalers..")
+	ctrl = controller.New(clientset, rulesClientset, lister)
+	var membership *sharding.Membership
+	if cfg.Sharding.Enabled {
+		identity := shardIdentity(cfg.Sharding)
+		ctrl.EnableSharding(identity, sharding.NewHandoff(clientset, cfg.Sharding.Namespace, cfg.Sharding.HandoffConfigMap),
+			time.Duration(cfg.Sharding.HandoffTimeout)*time.Second)
+		membership = sharding.NewMembership(clientset, cfg.Sharding, identity, ctrl.Rebalance)
+	}
+	ctrl.Apply(cfg)
+	if membership != nil {
+		go membership.Run(stopChan)
+	}
+
+	if cfg.Server.Port > 0 {
+		srv := server.New(cfg.Server.Port)
+		srv.Handle("/metrics", monitoring.Handler())
+		if cfg.Webhook.Enabled {
+			if token := readToken(cfg.Webhook.TokenFile); token != "" {
+				srv.Handle("/webhook", webhook.Handler(ctrl, token))
+			} else {
+				log.Errorf("Token file %s of the webhook is empty, not serving the webhook", cfg.Webhook.TokenFile)
+			}
+		}
+		if cfg.Ingest.Enabled {
+			credentials := ingest.Credentials{Token: readToken(cfg.Ingest.TokenFile), Username: cfg.Ingest.Username, Password: readToken(cfg.Ingest.PasswordFile),
+				Namespaces: cfg.Ingest.Namespaces}
+			if credentials.Complete() {
+				srv.Handle(ingest.PathPrefix, ingest.Handler(store, credentials))
+				go store.Run(stopChan)
+			} else {
+				log.Errorf("Credentials of the ingest endpoint are empty, not serving %s", ingest.PathPrefix)
+			}
+		}
+		go srv.Run()
+	}
+
+	if cfg.Admission.Enabled {
+		admissionServer := server.New(cfg.Admission.Port)
+		admissionServer.Handle("/validate", admission.Handler())
+		go admissionServer.RunTLS(cfg.Admission.CertFile, cfg.Admission.KeyFile)
+	}
+
+	if watcher != nil {
+		go watcher.Run(stopChan)
 	}
 
 	<-stopChan
+	ctrl.Stop()
+	if membership != nil {
+		membership.Leave()
+	}
 	log.Info("Stopped application!")
 }
 
 func onAdd(obj interface{}) {
 	rule := obj.(*v1.AutoscalingRule)
-	rules[rule.Name] = rule
 	log.Infof("Rule added: %s", rule.Name)
 }
 
 func onDelete(obj interface{}) {
-	rule := obj.(*v1.AutoscalingRule)
-	delete(rules, rule.Name)
-	log.Infof("Rule %s deleted", rule.Name)
+	if rule, ok := obj.(*v1.AutoscalingRule); ok {
+		log.Infof("Rule %s deleted", rule.Name)
+	}
 }
@@ -0,0 +1,54 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package main
+
+import (
+	"flag"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	"testing"
+)
+
+func TestOverrideWithFlags(t *testing.T) {
+	four, nine := 4, 9
+	cfg := config.Default()
+	cfg.Defaults.MaxReplicas = 20
+	cfg.Targets = []config.TargetConfig{{Namespace: "shop", Name: "web", Kind: "Deployment", MinReplicas: &four, MaxReplicas: &nine}}
+
+	// Flags that are not set explicitly keep the values of the file
+	overrideWithFlags(cfg)
+	if cfg.Defaults.MaxReplicas != 20 || *cfg.Targets[0].MinReplicas != 4 || cfg.Targets[0].Name != "web" {
+		t.Fatalf("unset flags overrode the configuration: %+v %+v", cfg.Defaults, cfg.Targets[0])
+	}
+
+	if err := flag.Set("minReplicas", "3"); err != nil {
+		t.Fatal(err)
+	}
+	defer flag.Set("minReplicas", "1")
+	overrideWithFlags(cfg)
+
+	// Explicit flags take precedence over the defaults and the per-target overrides
+	target := cfg.ResolveTargets()[0]
+	if target.MinReplicas != 3 {
+		t.Errorf("minReplicas = %d, expected the flag value 3", target.MinReplicas)
+	}
+	if target.MaxReplicas != 9 {
+		t.Errorf("maxReplicas = %d, expected the unaffected target override 9", target.MaxReplicas)
+	}
+
+	if err := flag.Set("targetName", "api"); err != nil {
+		t.Fatal(err)
+	}
+	overrideWithFlags(cfg)
+	if len(cfg.Targets) != 1 || cfg.Targets[0].Name != "api" {
+		t.Errorf("target flags did not replace the configured targets: %+v", cfg.Targets)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+// Package admission implements a validating admission webhook rejecting rules that violate the targeting policy.
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/policy"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+)
+
+// review is the part of an admission.k8s.io/v1beta1 AdmissionReview the webhook works with.
+type review struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *request  `json:"request,omitempty"`
+	Response        *response `json:"response,omitempty"`
+}
+
+type request struct {
+	UID       string                  `json:"uid"`
+	Kind      metav1.GroupVersionKind `json:"kind"`
+	Namespace string                  `json:"namespace,omitempty"`
+	Operation string                  `json:"operation"`
+	Object    json.RawMessage         `json:"object,omitempty"`
+}
+
+type response struct {
+	UID     string         `json:"uid"`
+	Allowed bool           `json:"allowed"`
+	Result  *metav1.Status `json:"status,omitempty"`
+}
+
+func validate(req *request) error {
+	if req.Kind.Kind != "AutoscalingRule" || (req.Operation != "CREATE" && req.Operation != "UPDATE") {
+		return nil
+	}
+
+	var rule v1.AutoscalingRule
+	if err := json.Unmarshal(req.Object, &rule); err != nil {
+		return fmt.Errorf("could not decode rule: %v", err)
+	}
+	if rule.Namespace == "" {
+		rule.Namespace = req.Namespace
+	}
+	return policy.ValidateRule(&rule)
+}
+
+// Handler serves the validating admission webhook for rules.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var ar review
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&ar); err != nil || ar.Request == nil {
+			http.Error(w, "invalid admission review", http.StatusBadRequest)
+			return
+		}
+
+		resp := &response{UID: ar.Request.UID, Allowed: true}
+		if err := validate(ar.Request); err != nil {
+			log.Infof("Rejected %s of rule in namespace %s: %v", ar.Request.Operation, ar.Request.Namespace, err)
+			resp.Allowed = false
+			resp.Result = &metav1.Status{Status: metav1.StatusFailure, Message: err.Error(), Reason: metav1.StatusReasonForbidden, Code: http.StatusForbidden}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(review{TypeMeta: ar.TypeMeta, Response: resp})
+	})
+}
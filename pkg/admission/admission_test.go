@@ -0,0 +1,87 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package admission
+
+import (
+	"encoding/json"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/policy"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func ruleRequest(operation, namespace, object string) *request {
+	return &request{
+		UID:       "1",
+		Kind:      metav1.GroupVersionKind{Group: "bsinfo.hhu.de", Version: "v1", Kind: "AutoscalingRule"},
+		Namespace: namespace,
+		Operation: operation,
+		Object:    json.RawMessage(object),
+	}
+}
+
+func TestValidate(t *testing.T) {
+	policy.Configure(config.PolicyConfig{
+		Enabled:            true,
+		AllowSameNamespace: true,
+		Allow:              []config.PolicyEntry{{RuleNamespaces: []string{"autoscaling"}, TargetNamespaces: []string{"*"}}},
+	})
+
+	for _, test := range []struct {
+		name    string
+		request *request
+		allowed bool
+	}{
+		{"own namespace", ruleRequest("CREATE", "shop", `{"metadata": {"name": "r"}, "spec": {"targetNamespace": "shop"}}`), true},
+		{"other namespace", ruleRequest("CREATE", "shop", `{"metadata": {"name": "r"}, "spec": {"targetNamespace": "payments"}}`), false},
+		{"update to other namespace", ruleRequest("UPDATE", "shop", `{"metadata": {"name": "r"}, "spec": {"targetNamespace": "payments"}}`), false},
+		{"namespace in object", ruleRequest("CREATE", "", `{"metadata": {"name": "r", "namespace": "shop"}, "spec": {"targetNamespace": "shop"}}`), true},
+		{"missing target namespace", ruleRequest("CREATE", "shop", `{"metadata": {"name": "r"}, "spec": {}}`), false},
+		{"allowed cross-namespace", ruleRequest("CREATE", "autoscaling", `{"metadata": {"name": "r"}, "spec": {"targetNamespace": "payments"}}`), true},
+		{"undecodable rule", ruleRequest("CREATE", "shop", `{"spec": []}`), false},
+		{"delete", ruleRequest("DELETE", "shop", `{"metadata": {"name": "r"}, "spec": {"targetNamespace": "payments"}}`), true},
+		{"other kind", &request{Kind: metav1.GroupVersionKind{Kind: "ConfigMap"}, Operation: "CREATE", Object: json.RawMessage(`{}`)}, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if err := validate(test.request); (err == nil) != test.allowed {
+				t.Errorf("validate() = %v, expected allowed %v", err, test.allowed)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	policy.Configure(config.Default().Policy)
+
+	body := `{"apiVersion": "admission.k8s.io/v1beta1", "kind": "AdmissionReview", "request": {"uid": "42",
+		"kind": {"group": "bsinfo.hhu.de", "version": "v1", "kind": "AutoscalingRule"}, "namespace": "shop",
+		"operation": "CREATE", "object": {"metadata": {"name": "r"}, "spec": {"targetNamespace": "payments"}}}}`
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(body)))
+
+	var result review
+	if err := json.NewDecoder(recorder.Body).Decode(&result); err != nil || result.Response == nil {
+		t.Fatalf("invalid review response: %v", err)
+	}
+	if result.Response.UID != "42" || result.Response.Allowed || result.Response.Result.Code != http.StatusForbidden {
+		t.Errorf("unexpected response %+v", result.Response)
+	}
+
+	recorder = httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(`{}`)))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("review without request: status %d", recorder.Code)
+	}
+}
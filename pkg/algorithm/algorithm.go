@@ -0,0 +1,109 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package algorithm
+
+import (
+	"fmt"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sample is a single observation of the metrics of a rule, aggregated over the series of each metric.
+type Sample struct {
+	Value     resource.Quantity
+	Delta     resource.Quantity
+	Timestamp time.Time
+	Series    int
+	// HasDelta is set if Delta was measured or pushed, otherwise it is derived from the value history if needed
+	HasDelta bool
+}
+
+// Environment describes the target a rule is evaluated for.
+type Environment struct {
+	Replicas          int32
+	ReadyReplicas     int32
+	MinReplicas       int32
+	MaxReplicas       int32
+	CalmdownIntervals int64
+}
+
+// ScalingAlgorithm turns the samples of a rule into a desired replica count. Fetching the metrics, combining the
+// proposals of all rules, clamping and scaling the target is left to the autoscaler.
+type ScalingAlgorithm interface {
+	Name() string
+	// Metrics returns the names of the value and (optional) delta metric the algorithm needs for the rule.
+	Metrics(rule *v1.AutoscalingRule) (valueMetric string, deltaMetric string)
+	// UsesDelta reports whether the algorithm observes the delta of the value metric.
+	UsesDelta() bool
+	InitState(rule *v1.AutoscalingRule, sample Sample, env Environment) *util.MetricEvaluation
+	Observe(rule *v1.AutoscalingRule, state *util.MetricEvaluation, sample Sample, env Environment)
+	ProposeReplicas(rule *v1.AutoscalingRule, state *util.MetricEvaluation, env Environment) float64
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      = make(map[string]ScalingAlgorithm)
+)
+
+func Register(algorithm ScalingAlgorithm) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, exists := registry[algorithm.Name()]; exists {
+		panic(fmt.Sprintf("scaling algorithm %s registered twice", algorithm.Name()))
+	}
+	registry[algorithm.Name()] = algorithm
+}
+
+func Get(name string) (ScalingAlgorithm, error) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	algorithm, exists := registry[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown scaling algorithm %q (available: %v)", name, names())
+	}
+	return algorithm, nil
+}
+
+func names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ForRule returns the algorithm the rule asks for. Rules without an explicit choice get the algorithm matching the
+// section of their spec that is filled in, the fallback is only used if that is ambiguous.
+func ForRule(rule *v1.AutoscalingRule, fallback string) (ScalingAlgorithm, error) {
+	name := rule.Spec.Algorithm
+	if name == "" {
+		hasAutoMode := rule.Spec.AutoMode.ValueMetric != ""
+		hasThresholds := rule.Spec.MetricName != ""
+		switch {
+		case hasAutoMode && !hasThresholds:
+			name = TrendName
+		case hasThresholds && !hasAutoMode:
+			name = ThresholdName
+		default:
+			name = fallback
+		}
+	}
+	return Get(name)
+}
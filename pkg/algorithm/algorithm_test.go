@@ -0,0 +1,94 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package algorithm
+
+import (
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"strings"
+	"testing"
+)
+
+// renamed behaves like the threshold algorithm under another name.
+type renamed struct {
+	threshold
+	name string
+}
+
+func (r renamed) Name() string {
+	return r.name
+}
+
+// registerForTest registers the algorithm until the test ends.
+func registerForTest(t *testing.T, algorithm ScalingAlgorithm) {
+	Register(algorithm)
+	t.Cleanup(func() {
+		registryMutex.Lock()
+		defer registryMutex.Unlock()
+		delete(registry, algorithm.Name())
+	})
+}
+
+func TestRegister(t *testing.T) {
+	registerForTest(t, renamed{name: "custom"})
+	if algorithm, err := Get("custom"); err != nil || algorithm.Name() != "custom" {
+		t.Errorf("got %v, %v for the registered algorithm", algorithm, err)
+	}
+
+	_, err := Get("unknown")
+	if err == nil || !strings.Contains(err.Error(), "[custom threshold trend]") {
+		t.Errorf("expected an error listing the available algorithms, got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering an algorithm twice did not panic")
+		}
+	}()
+	Register(renamed{name: ThresholdName})
+}
+
+func TestForRule(t *testing.T) {
+	registerForTest(t, renamed{name: "custom"})
+
+	rule := func(algorithm string, autoMode bool, thresholds bool) *v1.AutoscalingRule {
+		rule := &v1.AutoscalingRule{Spec: v1.AutoscalingRuleSpec{Algorithm: algorithm}}
+		if autoMode {
+			rule.Spec.AutoMode.ValueMetric = "queue_length"
+		}
+		if thresholds {
+			rule.Spec.MetricName = "queue_length"
+		}
+		return rule
+	}
+	tests := []struct {
+		name      string
+		rule      *v1.AutoscalingRule
+		algorithm string
+	}{
+		{"auto mode", rule("", true, false), TrendName},
+		{"thresholds", rule("", false, true), ThresholdName},
+		{"both sections", rule("", true, true), "custom"},
+		{"no section", rule("", false, false), "custom"},
+		{"explicit choice", rule(ThresholdName, true, false), ThresholdName},
+		{"registered algorithm", rule("custom", false, true), "custom"},
+	}
+	for _, test := range tests {
+		algorithm, err := ForRule(test.rule, "custom")
+		if err != nil || algorithm.Name() != test.algorithm {
+			t.Errorf("%s: got %v, %v, expected %s", test.name, algorithm, err, test.algorithm)
+		}
+	}
+
+	if _, err := ForRule(rule("unknown", true, false), TrendName); err == nil {
+		t.Error("expected an error for an unknown algorithm")
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package algorithm
+
+import (
+	log "github.com/Sirupsen/logrus"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"math"
+	"sort"
+)
+
+const (
+	FilterEWMA   = "ewma"
+	FilterSMA    = "sma"
+	FilterMedian = "median"
+	FilterKalman = "kalman"
+)
+
+// legacyDelta is the smoothing the trend algorithm applies to the delta unless configured otherwise: 90% of the new
+// delta and 10% of the previous weighted delta, in milli units and starting from zero.
+func legacyDelta(delta resource.Quantity, lastDelta int64) int64 {
+	return int64(math.Round(0.9*float64(delta.MilliValue()) + 0.1*float64(lastDelta)))
+}
+
+func valueFilter(rule *v1.AutoscalingRule) *v1.Filter {
+	if rule.Spec.Smoothing == nil {
+		return nil
+	}
+	return rule.Spec.Smoothing.Value
+}
+
+func deltaFilter(rule *v1.AutoscalingRule) *v1.Filter {
+	if rule.Spec.Smoothing == nil {
+		return nil
+	}
+	return rule.Spec.Smoothing.Delta
+}
+
+// smooth passes the input through the filter and returns the filtered value. Without a filter the input is returned
+// unchanged. The state is reset if the type of the filter changed.
+func smooth(filter *v1.Filter, state *util.FilterState, input resource.Quantity) resource.Quantity {
+	if filter == nil {
+		return input
+	}
+	if state.Type != filter.Type {
+		*state = util.FilterState{}
+	}
+
+	x := float64(input.MilliValue()) / 1000
+	initialized := state.Type != ""
+	var y float64
+
+	switch filter.Type {
+	case FilterEWMA:
+		alpha := filter.Alpha
+		if alpha <= 0 || alpha > 1 {
+			alpha = 0.5
+		}
+		if !initialized {
+			state.Estimate = x
+		}
+		state.Estimate = alpha*x + (1-alpha)*state.Estimate
+		y = state.Estimate
+	case FilterSMA, FilterMedian:
+		samples := int(filter.Samples)
+		if samples < 1 {
+			samples = 5
+		}
+		state.Window = append(state.Window, x)
+		if len(state.Window) > samples {
+			state.Window = append(state.Window[:0], state.Window[len(state.Window)-samples:]...)
+		}
+		if filter.Type == FilterSMA {
+			y = mean(state.Window)
+		} else {
+			y = median(state.Window)
+		}
+	case FilterKalman:
+		processNoise, measurementNoise := filter.ProcessNoise, filter.MeasurementNoise
+		if processNoise <= 0 {
+			processNoise = 1
+		}
+		if measurementNoise <= 0 {
+			measurementNoise = 1
+		}
+		if !initialized {
+			state.Estimate, state.Variance = x, measurementNoise
+		} else {
+			// Predict that the metric stays, then correct the prediction by the measurement
+			variance := state.Variance + processNoise
+			gain := variance / (variance + measurementNoise)
+			state.Estimate += gain * (x - state.Estimate)
+			state.Variance = (1 - gain) * variance
+		}
+		y = state.Estimate
+	default:
+		log.Errorf("Unknown smoothing filter %q, using raw input", filter.Type)
+		return input
+	}
+
+	state.Type = filter.Type
+	return *resource.NewMilliQuantity(int64(math.Round(y*1000)), input.Format)
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
@@ -0,0 +1,127 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package algorithm
+
+import (
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"math"
+	"testing"
+)
+
+func milli(value float64) resource.Quantity {
+	return *resource.NewMilliQuantity(int64(math.Round(value*1000)), resource.DecimalSI)
+}
+
+// filtered passes the inputs through the filter and returns the outputs.
+func filtered(filter *v1.Filter, state *util.FilterState, inputs ...float64) []float64 {
+	outputs := make([]float64, len(inputs))
+	for i, input := range inputs {
+		output := smooth(filter, state, milli(input))
+		outputs[i] = float64(output.MilliValue()) / 1000
+	}
+	return outputs
+}
+
+func TestSmooth(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		filter   *v1.Filter
+		inputs   []float64
+		expected []float64
+	}{
+		{"none", nil, []float64{1, 5, 3}, []float64{1, 5, 3}},
+		{"ewma", &v1.Filter{Type: FilterEWMA, Alpha: 0.5}, []float64{10, 20, 20, 0}, []float64{10, 15, 17.5, 8.75}},
+		{"ewma default alpha", &v1.Filter{Type: FilterEWMA}, []float64{10, 20}, []float64{10, 15}},
+		{"ewma invalid alpha", &v1.Filter{Type: FilterEWMA, Alpha: 1.5}, []float64{10, 20}, []float64{10, 15}},
+		{"ewma alpha 1", &v1.Filter{Type: FilterEWMA, Alpha: 1}, []float64{10, 20, 5}, []float64{10, 20, 5}},
+		{"sma", &v1.Filter{Type: FilterSMA, Samples: 3}, []float64{3, 6, 9, 30, 0}, []float64{3, 4.5, 6, 15, 13}},
+		{"sma default samples", &v1.Filter{Type: FilterSMA}, []float64{1, 2, 3, 4, 5, 6}, []float64{1, 1.5, 2, 2.5, 3, 4}},
+		{"median", &v1.Filter{Type: FilterMedian, Samples: 3}, []float64{1, 100, 2, 3, -50, 4}, []float64{1, 50.5, 2, 3, 2, 3}},
+		{"kalman", &v1.Filter{Type: FilterKalman, ProcessNoise: 1, MeasurementNoise: 1}, []float64{10, 20, 20}, []float64{10, 16.667, 18.75}},
+		{"unknown", &v1.Filter{Type: "lowpass"}, []float64{1, 5}, []float64{1, 5}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			outputs := filtered(test.filter, &util.FilterState{}, test.inputs...)
+			for i := range outputs {
+				if math.Abs(outputs[i]-test.expected[i]) > 0.001 {
+					t.Fatalf("outputs %v, expected %v", outputs, test.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestKalmanConverges(t *testing.T) {
+	filter := &v1.Filter{Type: FilterKalman, ProcessNoise: 0.01, MeasurementNoise: 4}
+	state := &util.FilterState{}
+	inputs := make([]float64, 200)
+	for i := range inputs {
+		// Measurements alternate around the true value of 50
+		inputs[i] = 50 + 3*float64(1-2*(i%2))
+	}
+	outputs := filtered(filter, state, inputs...)
+	if last := outputs[len(outputs)-1]; math.Abs(last-50) > 0.5 {
+		t.Errorf("estimate %v did not converge to 50", last)
+	}
+	if state.Variance >= 4 {
+		t.Errorf("variance %v not below the measurement noise", state.Variance)
+	}
+}
+
+func TestSmoothResetsOnFilterChange(t *testing.T) {
+	state := &util.FilterState{}
+	filtered(&v1.Filter{Type: FilterSMA, Samples: 3}, state, 100, 100, 100)
+
+	// The window of the previous filter must not leak into the new one
+	outputs := filtered(&v1.Filter{Type: FilterEWMA, Alpha: 0.5}, state, 10, 20)
+	if outputs[0] != 10 || outputs[1] != 15 {
+		t.Errorf("outputs %v after changing the filter, expected [10 15]", outputs)
+	}
+}
+
+// baselineDeltas is the delta weighting of the trend algorithm before filters were configurable.
+func baselineDeltas(deltas []int64) []int64 {
+	var lastDelta int64
+	weighted := make([]int64, len(deltas))
+	for i, delta := range deltas {
+		lastDelta = int64(math.Round(0.9*float64(delta) + 0.1*float64(lastDelta)))
+		weighted[i] = lastDelta
+	}
+	return weighted
+}
+
+func TestTrendKeepsLegacyDeltaWeighting(t *testing.T) {
+	deltas := []int64{1000, 1000, -3333, 0, 25, 77777, -5, 12}
+	expected := baselineDeltas(deltas)
+
+	rule := &v1.AutoscalingRule{}
+	env := Environment{Replicas: 2, ReadyReplicas: 2, MinReplicas: 1, MaxReplicas: 10, CalmdownIntervals: 3}
+	state := util.NewMetricEvaluation("trend", 2)
+	for i, delta := range deltas {
+		trend{}.Observe(rule, state, Sample{Value: milli(1), Delta: *resource.NewMilliQuantity(delta, resource.DecimalSI)}, env)
+		if state.LastDelta != expected[i] {
+			t.Fatalf("weighted delta %d after %v, expected %d as before", state.LastDelta, deltas[:i+1], expected[i])
+		}
+	}
+
+	// A configured filter replaces the weighting
+	rule.Spec.Smoothing = &v1.Smoothing{Delta: &v1.Filter{Type: FilterSMA, Samples: 2}}
+	state = util.NewMetricEvaluation("trend", 2)
+	for _, delta := range []int64{1000, 3000} {
+		trend{}.Observe(rule, state, Sample{Value: milli(1), Delta: *resource.NewMilliQuantity(delta, resource.DecimalSI)}, env)
+	}
+	if state.LastDelta != 2000 {
+		t.Errorf("weighted delta %d with sma filter, expected 2000", state.LastDelta)
+	}
+}
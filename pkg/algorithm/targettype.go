@@ -0,0 +1,83 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package algorithm
+
+import (
+	log "github.com/Sirupsen/logrus"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"math"
+)
+
+const (
+	TargetTypeValue        = "Value"
+	TargetTypeAverageValue = "AverageValue"
+	TargetTypeUtilization  = "Utilization"
+
+	// tolerance is the deviation from the target within which proportional scaling keeps the replicas, like the
+	// HorizontalPodAutoscaler does
+	tolerance = 0.1
+)
+
+// proportional reports whether the rule scales proportionally to the deviation of its value from the target.
+func proportional(rule *v1.AutoscalingRule) bool {
+	return rule.Spec.TargetType == TargetTypeAverageValue || rule.Spec.TargetType == TargetTypeUtilization
+}
+
+// baseReplicas are the replicas a per replica value refers to, the ready replicas if there are any.
+func baseReplicas(env Environment) int32 {
+	if env.ReadyReplicas > 0 {
+		return env.ReadyReplicas
+	}
+	return env.Replicas
+}
+
+// Normalize interprets the sample according to the target type of the rule. Values of AverageValue rules are
+// divided by the ready replicas of the target, so thresholds and limits are given per replica.
+func Normalize(rule *v1.AutoscalingRule, sample Sample, env Environment) Sample {
+	if rule.Spec.TargetType != TargetTypeAverageValue {
+		return sample
+	}
+	replicas := baseReplicas(env)
+	if replicas < 1 {
+		return sample
+	}
+	sample.Value = *resource.NewMilliQuantity(sample.Value.MilliValue()/int64(replicas), sample.Value.Format)
+	sample.Delta = *resource.NewMilliQuantity(sample.Delta.MilliValue()/int64(replicas), sample.Delta.Format)
+	return sample
+}
+
+// proportionalReplicas scales the replicas by the ratio of the value to the target, both in milli units. Ratios
+// within the tolerance keep the current replicas.
+func proportionalReplicas(value int64, target int64, env Environment) float64 {
+	if target <= 0 {
+		log.Warnf("Cannot scale proportionally to target %dm", target)
+		return float64(env.Replicas)
+	}
+	ratio := float64(value) / float64(target)
+	if math.Abs(ratio-1) <= tolerance {
+		return float64(env.Replicas)
+	}
+
+	replicas := baseReplicas(env)
+	if replicas < 1 {
+		// Without replicas there is no load per replica, start with one if there is any load
+		if value > 0 {
+			return 1
+		}
+		return 0
+	}
+	desired := math.Ceil(ratio * float64(replicas))
+	log.Debugf("Proportional scaling: value %dm, target %dm, %d -> %v replicas", value, target, replicas, desired)
+	return desired
+}
@@ -0,0 +1,131 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package algorithm
+
+import (
+	log "github.com/Sirupsen/logrus"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/policies"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+)
+
+const ThresholdName = "threshold"
+
+// threshold counts consecutive violations of an upper or lower threshold and scales according to the configured
+// scaling modes once maxViolationCount is reached.
+type threshold struct{}
+
+func init() {
+	Register(threshold{})
+}
+
+func (threshold) Name() string {
+	return ThresholdName
+}
+
+func (threshold) Metrics(rule *v1.AutoscalingRule) (string, string) {
+	return rule.Spec.MetricName, ""
+}
+
+func (threshold) UsesDelta() bool {
+	return false
+}
+
+func (threshold) InitState(rule *v1.AutoscalingRule, sample Sample, env Environment) *util.MetricEvaluation {
+	return util.NewMetricEvaluation(ThresholdName, float64(env.Replicas))
+}
+
+func calculateNewReplicas(rule *v1.AutoscalingRule, replicasOld int32, scaleUp bool) float64 {
+	var (
+		mode string
+	)
+	if scaleUp {
+		mode = rule.Spec.Modes.UpscalingMode
+	} else {
+		mode = rule.Spec.Modes.DownscalingMode
+	}
+
+	switch mode {
+	case "mild":
+		if scaleUp {
+			return policies.Mild.UpScalingFunction(replicasOld)
+		} else {
+			return policies.Mild.DownScalingFunction(replicasOld)
+		}
+	case "medium":
+		if scaleUp {
+			return policies.Medium.UpScalingFunction(replicasOld)
+		} else {
+			return policies.Medium.DownScalingFunction(replicasOld)
+		}
+	case "strong":
+		if scaleUp {
+			return policies.Strong.UpScalingFunction(replicasOld)
+		} else {
+			return policies.Strong.DownScalingFunction(replicasOld)
+		}
+	default:
+		log.Warnf("Unsupported scaling mode: %s", mode)
+		return float64(replicasOld)
+	}
+}
+
+func (threshold) Observe(rule *v1.AutoscalingRule, metricEvaluation *util.MetricEvaluation, sample Sample, env Environment) {
+	value := smooth(valueFilter(rule), &metricEvaluation.ValueFilter, sample.Value)
+	metricEvaluation.LastValue = value.MilliValue()
+
+	if value.Cmp(rule.Spec.Thresholds.UpperThreshold)+1 >= 1 {
+		// UpperThreshold reached
+		log.Debugf("Upper threshold reached for rule %s", rule.Name)
+		if metricEvaluation.Higher && env.Replicas < env.MaxReplicas {
+			metricEvaluation.ViolationCount[0]++
+		} else {
+			// Reset violation count, if latest violation was at lower threshold
+			metricEvaluation.Higher = true
+			metricEvaluation.ViolationCount[0] = 1
+		}
+	} else if value.Cmp(rule.Spec.Thresholds.LowerThreshold)-1 <= -1 {
+		log.Debugf("Lower threshold reached for rule %s", rule.Name)
+		// lowerThreshold reached
+		if !metricEvaluation.Higher && env.Replicas > env.MinReplicas {
+			metricEvaluation.ViolationCount[0]++
+		} else {
+			// Reset violation count, if latest violation was at upper threshold
+			metricEvaluation.Higher = false
+			metricEvaluation.ViolationCount[0] = 1
+		}
+	} else {
+		// if metric is in normal range again, reduce violation count
+		log.Debugf("Metric for rule %s in normal range", rule.Name)
+		if metricEvaluation.ViolationCount[0] >= 0.33 {
+			metricEvaluation.ViolationCount[0] -= 0.33
+		}
+	}
+}
+
+func (threshold) ProposeReplicas(rule *v1.AutoscalingRule, metricEvaluation *util.MetricEvaluation, env Environment) float64 {
+	if metricEvaluation.ViolationCount[0] >= rule.Spec.Thresholds.MaxViolationCount {
+		log.Debugf("Max violation count %f reached for rule %s", rule.Spec.Thresholds.MaxViolationCount, rule.Name)
+		if proportional(rule) {
+			// Aim for the middle between the thresholds
+			thresholds := rule.Spec.Thresholds
+			target := (thresholds.UpperThreshold.MilliValue() + thresholds.LowerThreshold.MilliValue()) / 2
+			metricEvaluation.Replicas = proportionalReplicas(metricEvaluation.LastValue, target, env)
+		} else {
+			metricEvaluation.Replicas = calculateNewReplicas(rule, env.Replicas, metricEvaluation.Higher)
+		}
+		// reset counting
+		metricEvaluation.ViolationCount[0] = 0
+	}
+	return metricEvaluation.Replicas
+}
@@ -0,0 +1,152 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package algorithm
+
+import (
+	log "github.com/Sirupsen/logrus"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/policies"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"math"
+)
+
+const TrendName = "trend"
+
+// trend extrapolates value and delta of a metric and raises the violation count the faster, the sooner one of the
+// limits of the AutoMode will be reached.
+type trend struct{}
+
+func init() {
+	Register(trend{})
+}
+
+func (trend) Name() string {
+	return TrendName
+}
+
+func (trend) Metrics(rule *v1.AutoscalingRule) (string, string) {
+	return rule.Spec.AutoMode.ValueMetric, rule.Spec.AutoMode.DeltaMetric
+}
+
+func (trend) UsesDelta() bool {
+	return true
+}
+
+func (trend) InitState(rule *v1.AutoscalingRule, sample Sample, env Environment) *util.MetricEvaluation {
+	return util.NewMetricEvaluation(TrendName, float64(env.Replicas))
+}
+
+func calculateTrendReplicas(replicasOld int32, countSlope float64, limit int64, desired int64, env Environment) float64 {
+	switch {
+	case countSlope > 1:
+		return math.Min(float64(env.MaxReplicas), policies.Strong.UpScalingFunction(replicasOld))
+	case countSlope > 0.5:
+		return math.Min(float64(env.MaxReplicas), policies.Medium.UpScalingFunction(replicasOld))
+	case countSlope > 0:
+		return math.Min(float64(env.MaxReplicas), policies.Mild.UpScalingFunction(replicasOld))
+	case countSlope < 0:
+		return policies.DownScalingFunction(replicasOld, limit, desired)
+	default:
+		return float64(replicasOld)
+	}
+}
+
+func calculateNewViolationCount(rule *v1.AutoscalingRule, metricEvaluation *util.MetricEvaluation, value resource.Quantity, delta int64, env Environment) {
+	var (
+		newCount float64
+	)
+
+	latestCount := metricEvaluation.ViolationCount[len(metricEvaluation.ViolationCount)-1]
+
+	var (
+		limit                  int64
+		factor                 float64
+		violationCountIncrease float64
+	)
+
+	valueAsInt := value.MilliValue()
+
+	if delta == 0 {
+		violationCountIncrease = metricEvaluation.LastIncrease * 0.5
+		newCount = latestCount + violationCountIncrease
+	} else {
+		if delta > 0 {
+			// Steigend
+			limit = rule.Spec.AutoMode.Limits.UpperLimit.MilliValue()
+			factor = 1
+		} else if delta < 0 {
+			// Fallend
+			if valueAsInt < rule.Spec.AutoMode.Limits.LowerLimit.MilliValue() {
+				limit = valueAsInt + 2*delta
+			} else {
+				limit = rule.Spec.AutoMode.Limits.LowerLimit.MilliValue()
+			}
+			factor = -1
+		}
+
+		diffToLimit := util.Abs(valueAsInt - limit)
+		intervalsUntilLimit := util.Max64(diffToLimit/util.Abs(delta)-env.CalmdownIntervals, 1)
+		remainingViolationCount := math.Abs(factor*rule.Spec.AutoMode.Limits.MaxViolationCount - latestCount)
+		violationCountIncrease = factor * (remainingViolationCount / float64(intervalsUntilLimit))
+		newCount = latestCount + violationCountIncrease
+
+		log.Debugf("diff: %v, intsUntil: %v, remainingCount: %v, violationCountIn: %v, newCount: %v", diffToLimit, intervalsUntilLimit, remainingViolationCount, violationCountIncrease, newCount)
+	}
+
+	if len(metricEvaluation.ViolationCount) == 5 {
+		metricEvaluation.ViolationCount = append(metricEvaluation.ViolationCount[1:], newCount)
+	} else {
+		metricEvaluation.ViolationCount = append(metricEvaluation.ViolationCount, newCount)
+	}
+
+	metricEvaluation.LastIncrease = violationCountIncrease
+}
+
+func (trend) Observe(rule *v1.AutoscalingRule, metricEvaluation *util.MetricEvaluation, sample Sample, env Environment) {
+	var weightedDelta int64
+	if filter := deltaFilter(rule); filter != nil {
+		smoothedDelta := smooth(filter, &metricEvaluation.DeltaFilter, sample.Delta)
+		weightedDelta = smoothedDelta.MilliValue()
+	} else {
+		weightedDelta = legacyDelta(sample.Delta, metricEvaluation.LastDelta)
+	}
+	metricEvaluation.LastDelta = weightedDelta
+	log.Debugf("Current weighted Delta: %v", weightedDelta)
+
+	value := smooth(valueFilter(rule), &metricEvaluation.ValueFilter, sample.Value)
+	metricEvaluation.LastValue = value.MilliValue()
+	calculateNewViolationCount(rule, metricEvaluation, value, weightedDelta, env)
+}
+
+func (trend) ProposeReplicas(rule *v1.AutoscalingRule, metricEvaluation *util.MetricEvaluation, env Environment) float64 {
+	lastViolationCount := metricEvaluation.ViolationCount[len(metricEvaluation.ViolationCount)-1]
+	deltaViolationCount := lastViolationCount - metricEvaluation.ViolationCount[0]
+	countSlope := deltaViolationCount / float64(len(metricEvaluation.ViolationCount))
+
+	log.Infof("Count slope is %v", countSlope)
+
+	if math.Abs(lastViolationCount) >= rule.Spec.AutoMode.Limits.MaxViolationCount {
+		log.Debug("Bingo, need to scale!")
+		if proportional(rule) {
+			// Aim for the desired usage at the value expected once the new replicas are running
+			expected := util.Max64(metricEvaluation.LastValue+metricEvaluation.LastDelta*util.Max64(env.CalmdownIntervals, 1), 0)
+			metricEvaluation.Replicas = proportionalReplicas(expected, rule.Spec.AutoMode.Limits.DesiredUsage.MilliValue(), env)
+		} else {
+			metricEvaluation.Replicas = calculateTrendReplicas(env.Replicas, countSlope, rule.Spec.AutoMode.Limits.LowerLimit.MilliValue(), rule.Spec.AutoMode.Limits.DesiredUsage.MilliValue(), env)
+		}
+
+		metricEvaluation.ViolationCount = make([]float64, 1, 5)
+	}
+	return metricEvaluation.Replicas
+}
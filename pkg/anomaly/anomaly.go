@@ -0,0 +1,193 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+// Package anomaly detects outliers among the inputs of a rule and decides how the rule's algorithm treats them.
+package anomaly
+
+import (
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	MethodZScore    = "zscore"
+	MethodMAD       = "mad"
+	MethodMaxChange = "maxChange"
+
+	ActionSkip    = "skip"
+	ActionClamp   = "clamp"
+	ActionConfirm = "confirm"
+
+	InputValue = "value"
+	InputDelta = "delta"
+
+	defaultWindow        = 10
+	defaultConfirmations = 2
+	// madScale turns the median absolute deviation into an estimate of the standard deviation
+	madScale = 0.6745
+)
+
+// LegacyDelta is the detection the trend algorithm always applied to the delta: a delta larger than ten times the
+// mean magnitude is only accepted if the next one is anomalous as well.
+var LegacyDelta = &v1.AnomalyDetection{Method: MethodMaxChange, Input: InputDelta, Threshold: 10, Action: ActionConfirm, Confirmations: 2}
+
+// Verdict is the result of checking an input.
+type Verdict struct {
+	Anomalous bool
+	Score     float64
+	// Skip is set if the sample must not be observed
+	Skip bool
+	// Value is the input the algorithm should observe, it differs from the input if it was clamped
+	Value float64
+}
+
+// Input returns the input the detection checks, the delta for algorithms observing it unless configured otherwise.
+func Input(config *v1.AnomalyDetection, usesDelta bool) string {
+	if config.Input != "" {
+		return config.Input
+	}
+	if usesDelta {
+		return InputDelta
+	}
+	return InputValue
+}
+
+// Detect scores the input against the recent inputs in the state and applies the configured action if it is
+// anomalous. Normal, clamped and confirmed inputs are added to the window, skipped ones are not.
+func Detect(config *v1.AnomalyDetection, state *util.AnomalyState, input float64, now time.Time) Verdict {
+	window := int(config.Window)
+	if window < 1 {
+		window = defaultWindow
+	}
+	method := config.Method
+	if method == "" {
+		method = MethodZScore
+	}
+	threshold := config.Threshold
+	if threshold <= 0 {
+		threshold = defaultThreshold(method)
+	}
+
+	verdict := Verdict{Value: input}
+	score, lower, upper, scored := evaluate(method, state.Window, input, threshold)
+	verdict.Score = score
+	if scored && score > threshold {
+		verdict.Anomalous = true
+		state.Anomalies++
+		state.LastScore = score
+		state.LastTime = now
+
+		switch config.Action {
+		case ActionClamp:
+			verdict.Value = math.Max(lower, math.Min(upper, input))
+		case ActionConfirm:
+			confirmations := config.Confirmations
+			if confirmations < 1 {
+				confirmations = defaultConfirmations
+			}
+			state.Pending++
+			if state.Pending < confirmations {
+				verdict.Skip = true
+				return verdict
+			}
+			// The anomaly persisted, the metric moved to a new level
+			state.Pending = 0
+		default:
+			verdict.Skip = true
+			return verdict
+		}
+	} else {
+		state.Pending = 0
+	}
+
+	state.Window = append(state.Window, verdict.Value)
+	if len(state.Window) > window {
+		state.Window = append(state.Window[:0], state.Window[len(state.Window)-window:]...)
+	}
+	return verdict
+}
+
+func defaultThreshold(method string) float64 {
+	switch method {
+	case MethodMAD:
+		return 3.5
+	case MethodMaxChange:
+		return 10
+	default:
+		return 3
+	}
+}
+
+// evaluate scores the input and returns the range of inputs within the threshold. Inputs are not scored while the
+// window is too short or does not vary.
+func evaluate(method string, window []float64, input float64, threshold float64) (score, lower, upper float64, scored bool) {
+	switch method {
+	case MethodMAD:
+		if len(window) < 3 {
+			return 0, 0, 0, false
+		}
+		center := median(window)
+		deviations := make([]float64, len(window))
+		for i, v := range window {
+			deviations[i] = math.Abs(v - center)
+		}
+		mad := median(deviations)
+		if mad == 0 {
+			return 0, 0, 0, false
+		}
+		spread := threshold * mad / madScale
+		return madScale * math.Abs(input-center) / mad, center - spread, center + spread, true
+	case MethodMaxChange:
+		if len(window) < 1 {
+			return 0, 0, 0, false
+		}
+		var magnitude float64
+		for _, v := range window {
+			magnitude += math.Abs(v)
+		}
+		magnitude /= float64(len(window))
+		if magnitude == 0 {
+			return 0, 0, 0, false
+		}
+		return math.Abs(input) / magnitude, -threshold * magnitude, threshold * magnitude, true
+	default:
+		if len(window) < 3 {
+			return 0, 0, 0, false
+		}
+		var mean, variance float64
+		for _, v := range window {
+			mean += v
+		}
+		mean /= float64(len(window))
+		for _, v := range window {
+			variance += (v - mean) * (v - mean)
+		}
+		deviation := math.Sqrt(variance / float64(len(window)))
+		if deviation == 0 {
+			return 0, 0, 0, false
+		}
+		return math.Abs(input-mean) / deviation, mean - threshold*deviation, mean + threshold*deviation, true
+	}
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
@@ -0,0 +1,152 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package anomaly
+
+import (
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var detectTime = time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC)
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-3
+}
+
+func TestDetect(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		config    v1.AnomalyDetection
+		window    []float64
+		input     float64
+		anomalous bool
+		skip      bool
+		score     float64
+		value     float64
+		after     []float64
+	}{
+		{"zscore normal", v1.AnomalyDetection{}, []float64{10, 10, 10, 10, 12}, 11, false, false, 0.75, 11, []float64{10, 10, 10, 10, 12, 11}},
+		{"zscore skip", v1.AnomalyDetection{}, []float64{10, 10, 10, 10, 12}, 20, true, true, 12, 20, []float64{10, 10, 10, 10, 12}},
+		{"zscore clamp", v1.AnomalyDetection{Action: ActionClamp}, []float64{10, 10, 10, 10, 12}, 20, true, false, 12, 12.8, []float64{10, 10, 10, 10, 12, 12.8}},
+		{"zscore clamp below", v1.AnomalyDetection{Action: ActionClamp}, []float64{10, 10, 10, 10, 12}, 0, true, false, 13, 8, []float64{10, 10, 10, 10, 12, 8}},
+		{"zscore threshold", v1.AnomalyDetection{Threshold: 15}, []float64{10, 10, 10, 10, 12}, 20, false, false, 12, 20, []float64{10, 10, 10, 10, 12, 20}},
+		{"zscore short window", v1.AnomalyDetection{}, []float64{1, 2}, 1000, false, false, 0, 1000, []float64{1, 2, 1000}},
+		{"zscore constant window", v1.AnomalyDetection{}, []float64{5, 5, 5}, 1000, false, false, 0, 1000, []float64{5, 5, 5, 1000}},
+		{"mad normal", v1.AnomalyDetection{Method: MethodMAD}, []float64{10, 11, 12, 13, 100}, 14, false, false, 1.349, 14, []float64{10, 11, 12, 13, 100, 14}},
+		{"mad skip", v1.AnomalyDetection{Method: MethodMAD}, []float64{10, 11, 12, 13, 100}, 100, true, true, 59.356, 100, []float64{10, 11, 12, 13, 100}},
+		{"mad clamp", v1.AnomalyDetection{Method: MethodMAD, Action: ActionClamp}, []float64{10, 11, 12, 13, 100}, 100, true, false, 59.356, 12 + 3.5/0.6745, []float64{10, 11, 12, 13, 100, 12 + 3.5/0.6745}},
+		{"mad constant window", v1.AnomalyDetection{Method: MethodMAD}, []float64{7, 7, 7, 8}, 100, false, false, 0, 100, []float64{7, 7, 7, 8, 100}},
+		{"maxChange normal", v1.AnomalyDetection{Method: MethodMaxChange}, []float64{1, -1, 2}, 10, false, false, 7.5, 10, []float64{1, -1, 2, 10}},
+		{"maxChange skip", v1.AnomalyDetection{Method: MethodMaxChange}, []float64{1, -1, 2}, -20, true, true, 15, -20, []float64{1, -1, 2}},
+		{"maxChange clamp", v1.AnomalyDetection{Method: MethodMaxChange, Action: ActionClamp}, []float64{1, -1, 2}, -20, true, false, 15, -40.0 / 3, []float64{1, -1, 2, -40.0 / 3}},
+		{"maxChange empty window", v1.AnomalyDetection{Method: MethodMaxChange}, nil, 1000, false, false, 0, 1000, []float64{1000}},
+		{"maxChange zero window", v1.AnomalyDetection{Method: MethodMaxChange}, []float64{0, 0}, 1000, false, false, 0, 1000, []float64{0, 0, 1000}},
+		{"window trimmed", v1.AnomalyDetection{Window: 3}, []float64{10, 10, 10, 10, 12}, 11, false, false, 0.75, 11, []float64{10, 12, 11}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			state := &util.AnomalyState{Window: append([]float64(nil), test.window...)}
+			verdict := Detect(&test.config, state, test.input, detectTime)
+			if verdict.Anomalous != test.anomalous || verdict.Skip != test.skip || !approx(verdict.Score, test.score) || !approx(verdict.Value, test.value) {
+				t.Errorf("verdict %+v, expected anomalous %v, skip %v, score %v and value %v", verdict, test.anomalous, test.skip, test.score, test.value)
+			}
+			if len(state.Window) != len(test.after) {
+				t.Fatalf("window %v, expected %v", state.Window, test.after)
+			}
+			for i := range test.after {
+				if !approx(state.Window[i], test.after[i]) {
+					t.Fatalf("window %v, expected %v", state.Window, test.after)
+				}
+			}
+			if test.anomalous && (state.Anomalies != 1 || !state.LastTime.Equal(detectTime) || state.LastScore != verdict.Score) {
+				t.Errorf("anomaly not recorded: %+v", state)
+			}
+			if !test.anomalous && state.Anomalies != 0 {
+				t.Errorf("normal input recorded as anomaly: %+v", state)
+			}
+		})
+	}
+}
+
+// detected runs the inputs through the detection and returns which of them were skipped.
+func detected(config *v1.AnomalyDetection, state *util.AnomalyState, inputs ...float64) []bool {
+	skipped := make([]bool, len(inputs))
+	for i, input := range inputs {
+		skipped[i] = Detect(config, state, input, detectTime).Skip
+	}
+	return skipped
+}
+
+func TestDetectConfirm(t *testing.T) {
+	config := &v1.AnomalyDetection{Action: ActionConfirm, Confirmations: 3}
+	state := &util.AnomalyState{Window: []float64{10, 10, 10, 10, 12}}
+
+	// A normal input in between resets the confirmations
+	skipped := detected(config, state, 20, 20, 11, 20, 20, 20)
+	expected := []bool{true, true, false, true, true, false}
+	if !reflect.DeepEqual(skipped, expected) {
+		t.Errorf("skipped %v, expected %v", skipped, expected)
+	}
+	if state.Pending != 0 || state.Anomalies != 5 {
+		t.Errorf("pending %d and anomalies %d, expected 0 and 5", state.Pending, state.Anomalies)
+	}
+	if last := state.Window[len(state.Window)-1]; last != 20 {
+		t.Errorf("confirmed input not added to the window: %v", state.Window)
+	}
+
+	// Confirmations default to 2
+	state = &util.AnomalyState{Window: []float64{10, 10, 10, 10, 12}}
+	skipped = detected(&v1.AnomalyDetection{Action: ActionConfirm}, state, 20, 20)
+	if !reflect.DeepEqual(skipped, []bool{true, false}) {
+		t.Errorf("skipped %v with default confirmations, expected [true false]", skipped)
+	}
+}
+
+func TestLegacyDelta(t *testing.T) {
+	state := &util.AnomalyState{}
+	// The first delta is accepted as there is nothing to compare it with, a single jump is skipped, a jump that
+	// persists is accepted and becomes part of the mean magnitude
+	skipped := detected(LegacyDelta, state, 1, 1, 1, 50, 1, 50, 50, 50, -1)
+	expected := []bool{false, false, false, true, false, true, false, false, false}
+	if !reflect.DeepEqual(skipped, expected) {
+		t.Errorf("skipped %v, expected %v", skipped, expected)
+	}
+	if state.Anomalies != 3 {
+		t.Errorf("anomalies %d, expected 3", state.Anomalies)
+	}
+
+	// Deltas of a flat metric are never scored
+	state = &util.AnomalyState{}
+	if skipped := detected(LegacyDelta, state, 0, 0, 0, 1000); !reflect.DeepEqual(skipped, []bool{false, false, false, false}) {
+		t.Errorf("skipped %v on a flat metric", skipped)
+	}
+}
+
+func TestInput(t *testing.T) {
+	for _, test := range []struct {
+		input     string
+		usesDelta bool
+		expected  string
+	}{
+		{"", true, InputDelta},
+		{"", false, InputValue},
+		{InputValue, true, InputValue},
+		{InputDelta, false, InputDelta},
+	} {
+		if input := Input(&v1.AnomalyDetection{Input: test.input}, test.usesDelta); input != test.expected {
+			t.Errorf("Input(%q, %v) = %q, expected %q", test.input, test.usesDelta, input, test.expected)
+		}
+	}
+}
@@ -24,16 +24,98 @@ type AutoscalingRule struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec AutoscalingRuleSpec `json:"spec"`
+	Spec   AutoscalingRuleSpec   `json:"spec"`
+	Status AutoscalingRuleStatus `json:"status,omitempty"`
 }
 
 type AutoscalingRuleSpec struct {
+	// Algorithm names the scaling algorithm evaluating the rule, e.g. threshold or trend
+	Algorithm string `json:"algorithm,omitempty"`
+	// Source names the metric source the rule's metrics are read from, defaults to the custom metrics API
+	Source string `json:"source,omitempty"`
+	// TargetType interprets the rule's value: Value (default) compares it as is, AverageValue divides it by the
+	// ready replicas of the target and Utilization treats it as percentage. Both of the latter scale proportionally
+	TargetType string `json:"targetType,omitempty"`
+	// PerPod reads the metrics of the ready pods of the target, combined by the aggregation, e.g. max to scale by
+	// the hottest pod. The custom source reads the pods' custom metrics instead of those of the configured objects,
+	// the http source scrapes every pod
+	PerPod          bool       `json:"perPod,omitempty"`
 	MetricName      string     `json:"metricName"`
 	TargetNamespace string     `json:"targetNamespace"`
 	Modes           Modes      `json:"modes"`
 	Priority        int32      `json:"priority"`
 	Thresholds      Thresholds `json:"thresholds"`
 	AutoMode        AutoMode   `json:"autoMode"`
+	// MetricSelector restricts the series of the rule's metrics for sources supporting metric labels, the delta
+	// metric uses DeltaMetricSelector if given
+	MetricSelector      *metav1.LabelSelector `json:"metricSelector,omitempty"`
+	DeltaMetricSelector *metav1.LabelSelector `json:"deltaMetricSelector,omitempty"`
+	// Aggregation combines the series of the rule's metrics: first (default, the first series returned), avg, sum,
+	// min, max, median, count or a percentile like p95. The delta metric uses DeltaAggregation if given
+	Aggregation      string `json:"aggregation,omitempty"`
+	DeltaAggregation string `json:"deltaAggregation,omitempty"`
+	// MaxMetricAge is the age after which series of the rule's metrics are considered stale and dropped. If all
+	// series are stale, StalenessPolicy decides how the rule reacts: hold (default), decay or failsafe
+	MaxMetricAge    *metav1.Duration `json:"maxMetricAge,omitempty"`
+	StalenessPolicy string           `json:"stalenessPolicy,omitempty"`
+	// Interval at which the rule's metrics are sampled, defaults to the check interval of the target
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Smoothing filters the inputs of the rule before its algorithm observes them
+	Smoothing *Smoothing `json:"smoothing,omitempty"`
+	// AnomalyDetection protects the rule's algorithm from outliers among its samples. The trend algorithm confirms
+	// deltas larger than ten times their mean magnitude unless configured otherwise
+	AnomalyDetection *AnomalyDetection `json:"anomalyDetection,omitempty"`
+	// HTTP points the http source to the JSON document the rule's metrics are extracted from. Its metric names
+	// are JSONPath expressions like $.queue.length
+	HTTP *HTTPSource `json:"http,omitempty"`
+}
+
+// HTTPSource configures how the http source scrapes a JSON document. The URL may refer to {{.Namespace}} and the
+// {{.Target.Namespace}}, {{.Target.Name}} and {{.Target.Kind}} of the workload, per pod also to {{.Pod.Name}}
+// and {{.Pod.IP}}. Hosts other than the pod's IP have to be allowed by the controller configuration.
+type HTTPSource struct {
+	URL string `json:"url"`
+	// Headers are added to every request, e.g. to authenticate or negotiate the content type
+	Headers map[string]string `json:"headers,omitempty"`
+	// Timeout of a request, defaults to the timeout of the metrics configuration
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// AnomalyDetection configures how outliers among the inputs of a rule are detected and handled.
+type AnomalyDetection struct {
+	// Method scoring the input against the window: zscore (default), mad (median absolute deviation) or maxChange
+	// (ratio of the input's magnitude to the mean magnitude of the window)
+	Method string `json:"method,omitempty"`
+	// Input checked for outliers, value or delta. Defaults to the delta for algorithms observing it
+	Input string `json:"input,omitempty"`
+	// Threshold above which a score is anomalous, defaults to 3 for zscore, 3.5 for mad and 10 for maxChange
+	Threshold float64 `json:"threshold,omitempty"`
+	// Window is the number of recent inputs the score is computed from, defaults to 10
+	Window int32 `json:"window,omitempty"`
+	// Action on an anomaly: skip (default) the sample, clamp the input to the threshold or confirm it, accepting
+	// anomalies that persist for Confirmations consecutive samples (default 2)
+	Action        string `json:"action,omitempty"`
+	Confirmations int32  `json:"confirmations,omitempty"`
+}
+
+// Smoothing configures the filters of the value and the delta of a rule. Unless configured otherwise, the trend
+// algorithm weights the new delta with 0.9 and its previous weighted delta with 0.1.
+type Smoothing struct {
+	Value *Filter `json:"value,omitempty"`
+	Delta *Filter `json:"delta,omitempty"`
+}
+
+// Filter smooths a series of inputs. Type is one of ewma, sma (simple moving average), median or kalman.
+type Filter struct {
+	Type string `json:"type"`
+	// Alpha is the weight of the newest input of the ewma filter, between 0 and 1, defaults to 0.5
+	Alpha float64 `json:"alpha,omitempty"`
+	// Samples is the number of inputs the sma and median filters consider, defaults to 5
+	Samples int32 `json:"samples,omitempty"`
+	// ProcessNoise and MeasurementNoise are the variances the kalman filter assumes for changes of the metric and
+	// for errors of its measurement, both default to 1
+	ProcessNoise     float64 `json:"processNoise,omitempty"`
+	MeasurementNoise float64 `json:"measurementNoise,omitempty"`
 }
 
 type Modes struct {
@@ -48,9 +130,22 @@ type Thresholds struct {
 }
 
 type AutoMode struct {
-	DeltaMetric string `json:"deltaMetric"`
-	ValueMetric string `json:"valueMetric"`
-	Limits      Limits `json:"limits"`
+	// DeltaMetric is optional, without it the delta is derived from the history of the value metric
+	DeltaMetric     string           `json:"deltaMetric,omitempty"`
+	ValueMetric     string           `json:"valueMetric"`
+	Limits          Limits           `json:"limits"`
+	DeltaDerivation *DeltaDerivation `json:"deltaDerivation,omitempty"`
+}
+
+// DeltaDerivation configures how the delta is derived from the value history if no delta metric is given. The delta
+// is the slope of a linear regression over the values within the window.
+type DeltaDerivation struct {
+	// Unit of the delta, the change per sampling interval (interval, default) or per second (second)
+	Unit string `json:"unit,omitempty"`
+	// Window of values the delta is derived from, defaults to five sampling intervals
+	Window *metav1.Duration `json:"window,omitempty"`
+	// Counter marks monotonic counters, a decreasing value is treated as reset of the counter
+	Counter bool `json:"counter,omitempty"`
 }
 
 type Limits struct {
@@ -60,6 +155,50 @@ type Limits struct {
 	MaxViolationCount float64           `json:"maxViolationCount"`
 }
 
+type AutoscalingRuleStatus struct {
+	// Targets holds the latest evaluation of the rule for every target it applies to
+	Targets []TargetStatus `json:"targets,omitempty"`
+}
+
+type TargetStatus struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// ProposedReplicas is the replica count proposed by this rule
+	ProposedReplicas int32 `json:"proposedReplicas"`
+	// DesiredReplicas is the replica count decided by combining all rules of the target
+	DesiredReplicas int32 `json:"desiredReplicas"`
+	// DryRun is set if the desired replicas were only recorded but not applied to the target
+	DryRun bool `json:"dryRun,omitempty"`
+	// Override describes an active pause or manual override of the target, decisions are not applied meanwhile
+	Override string `json:"override,omitempty"`
+	// Series is the number of series the rule's value was aggregated from, using Aggregation
+	Series      int32  `json:"series,omitempty"`
+	Aggregation string `json:"aggregation,omitempty"`
+	// Anomalies counts the anomalous samples of the rule, the last one was detected at LastAnomalyTime
+	Anomalies       int64        `json:"anomalies,omitempty"`
+	LastAnomalyTime *metav1.Time `json:"lastAnomalyTime,omitempty"`
+	// Conditions report whether the rule's metrics are available and whether the target is in failsafe mode
+	Conditions     []Condition `json:"conditions,omitempty"`
+	LastUpdateTime metav1.Time `json:"lastUpdateTime,omitempty"`
+}
+
+const (
+	// ConditionMetricsAvailable is false while the rule fails to fetch its metrics
+	ConditionMetricsAvailable = "MetricsAvailable"
+	// ConditionFailsafe is true while the target is scaled by its failure policy
+	ConditionFailsafe = "Failsafe"
+)
+
+// Condition is an aspect of the state of a rule for a target. Status is True, False or Unknown.
+type Condition struct {
+	Type               string      `json:"type"`
+	Status             string      `json:"status"`
+	Reason             string      `json:"reason,omitempty"`
+	Message            string      `json:"message,omitempty"`
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 type AutoscalingRuleList struct {
 	metav1.TypeMeta `json:",inline"`
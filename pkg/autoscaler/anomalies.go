@@ -0,0 +1,69 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package autoscaler
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/algorithm"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/anomaly"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"math"
+	"time"
+)
+
+// anomalyDetection returns the anomaly detection of the rule, algorithms observing the delta get the legacy
+// detection unless the rule configures one.
+func anomalyDetection(rule *v1.AutoscalingRule, scalingAlgorithm algorithm.ScalingAlgorithm) *v1.AnomalyDetection {
+	if rule.Spec.AnomalyDetection != nil {
+		return rule.Spec.AnomalyDetection
+	}
+	if scalingAlgorithm.UsesDelta() {
+		return anomaly.LegacyDelta
+	}
+	return nil
+}
+
+// checkAnomaly checks the sample for an anomaly, clamping its input if configured. It reports whether the sample
+// should be observed.
+func (as *Autoscaler) checkAnomaly(rule *v1.AutoscalingRule, scalingAlgorithm algorithm.ScalingAlgorithm, state *util.MetricEvaluation, sample *algorithm.Sample) bool {
+	config := anomalyDetection(rule, scalingAlgorithm)
+	if config == nil {
+		return true
+	}
+
+	input := &sample.Value
+	if anomaly.Input(config, scalingAlgorithm.UsesDelta()) == anomaly.InputDelta {
+		input = &sample.Delta
+	}
+
+	verdict := anomaly.Detect(config, &state.Anomaly, float64(input.MilliValue())/1000, time.Now())
+	if !verdict.Anomalous {
+		return true
+	}
+
+	action := config.Action
+	if action == "" {
+		action = anomaly.ActionSkip
+	}
+	if action == anomaly.ActionConfirm && !verdict.Skip {
+		action = "confirmed"
+	}
+	log.Infof("Anomalous input %v of rule %s (score %.2f), action: %s", input, rule.Name, verdict.Score, action)
+	anomaliesCounter.Inc(as.target.Kind, as.target.Namespace, as.target.Name, ruleKey(rule), action)
+	anomalyScoreGauge.Set(verdict.Score, as.target.Kind, as.target.Namespace, as.target.Name, ruleKey(rule))
+
+	*input = *resource.NewMilliQuantity(int64(math.Round(verdict.Value*1000)), input.Format)
+	return !verdict.Skip
+}
@@ -13,275 +13,466 @@
 package autoscaler
 
 import (
+	"context"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/algorithm"
 	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	listers "github.com/grieshaber/generic-autoscaler-controller/pkg/client/listers/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/events"
 	"github.com/grieshaber/generic-autoscaler-controller/pkg/metrics"
-	"github.com/grieshaber/generic-autoscaler-controller/pkg/policies"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/policy"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/status"
 	"github.com/grieshaber/generic-autoscaler-controller/util"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"math"
 	"sync"
 	"time"
 )
 
-var (
-	calmdown  bool
-	waitGroup *sync.WaitGroup
-)
-
+// Autoscaler scales a single target. Every rule is sampled on its own schedule and evaluated by its scaling
+// algorithm, at every check interval the autoscaler combines the recent proposals of all rules, clamps the result
+// and scales the target.
 type Autoscaler struct {
 	kubeclientset     *kubernetes.Clientset
 	interval          time.Duration
-	target            util.Target
+	target            config.ResolvedTarget
 	calmdownIntervals int64
-	rules             map[string]*v1.AutoscalingRule
-	metricEvaluations map[*v1.AutoscalingRule]*util.MetricEvaluation
+	rules             listers.AutoscalingRuleLister
+	metricEvaluations map[string]*util.MetricEvaluation
 	minReplicas       int32
 	maxReplicas       int32
+	defaultAlgorithm  string
+	dryRun            bool
+	proposalAge       time.Duration
+	failurePolicy     string
+	failureThreshold  int
+	fallbackReplicas  int32
+	failsafe          bool
+	currentReplicas   int32
+	readyReplicas     int32
+	lastOverride      string
+	rejected          map[string]bool
+	statusUpdater     *status.Updater
+	recorder          *events.Recorder
+
+	// mutex guards the settings above against updates while a tick is evaluated
+	mutex                      sync.Mutex
+	evaluationsMutex           sync.Mutex
+	samplersMutex              sync.Mutex
+	samplers                   map[string]*sampler
+	failures                   map[string]failure
+	calmdown                   bool
+	remainingCalmdownIntervals int64
+	stopChan                   chan struct{}
+	trigger                    chan struct{}
+	pushMutex                  sync.Mutex
+	pushes                     map[string]Push
+}
+
+func New(kubeclientset *kubernetes.Clientset, target config.ResolvedTarget, rules listers.AutoscalingRuleLister, statusUpdater *status.Updater, recorder *events.Recorder) *Autoscaler {
+	as := &Autoscaler{kubeclientset: kubeclientset, rules: rules, metricEvaluations: make(map[string]*util.MetricEvaluation),
+		statusUpdater: statusUpdater, recorder: recorder, stopChan: make(chan struct{}), trigger: make(chan struct{}, 1), pushes: make(map[string]Push),
+		samplers: make(map[string]*sampler), failures: make(map[string]failure), currentReplicas: -1}
+	as.apply(target)
+	as.remainingCalmdownIntervals = as.calmdownIntervals
+	return as
+}
+
+func (as *Autoscaler) apply(target config.ResolvedTarget) {
+	as.target = target
+	as.interval = time.Duration(target.CheckInterval) * time.Second
+	as.calmdownIntervals = target.CalmdownInts
+	as.minReplicas = int32(target.MinReplicas)
+	as.maxReplicas = int32(target.MaxReplicas)
+	as.dryRun = target.DryRun
+	as.proposalAge = time.Duration(target.MaxProposalAge) * time.Second
+	as.failurePolicy = target.FailurePolicy
+	as.failureThreshold = target.FailureThreshold
+	as.fallbackReplicas = int32(target.FallbackReplicas)
+	if target.UseV2 {
+		as.defaultAlgorithm = algorithm.TrendName
+	} else {
+		as.defaultAlgorithm = algorithm.ThresholdName
+	}
+}
+
+// Update applies changed settings, they take effect with the next tick.
+func (as *Autoscaler) Update(target config.ResolvedTarget) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	as.apply(target)
+}
+
+func (as *Autoscaler) Stop() {
+	close(as.stopChan)
 }
 
-func New(kubeclientset *kubernetes.Clientset, interval time.Duration, target util.Target, calmdownIntervals int64, rules map[string]*v1.AutoscalingRule, minReplicas int, maxReplicas int) *Autoscaler {
-	return &Autoscaler{kubeclientset: kubeclientset, interval: interval, target: target, calmdownIntervals: calmdownIntervals, rules: rules, metricEvaluations: make(map[*v1.AutoscalingRule]*util.MetricEvaluation),
-		minReplicas: int32(minReplicas), maxReplicas: int32(maxReplicas)}
+func (as *Autoscaler) currentInterval() time.Duration {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	return as.interval
 }
 
-func (as Autoscaler) Run() {
-	log.Infof("Autoscaler running with interval %v", as.interval)
-	waitGroup = &sync.WaitGroup{}
+func (as *Autoscaler) Run() {
+	interval := as.currentInterval()
+	log.Infof("Autoscaler for %s %s/%s running with interval %v", as.target.Kind, as.target.Namespace, as.target.Name, interval)
 
-	ticker := time.NewTicker(as.interval)
+	ticker := time.NewTicker(interval)
 	go func() {
-		for range ticker.C {
-			remainingCalmdownIntervals := as.calmdownIntervals
-			if calmdown {
-				log.Debugf("Calming down after scaling (remaining calmdown intervals %d/%d)", remainingCalmdownIntervals, as.calmdownIntervals)
-				remainingCalmdownIntervals--
-				if remainingCalmdownIntervals == 0 {
-					calmdown = false
-				}
-			} else {
-				switch as.target.Kind {
-				case "Deployment":
-					if err := as.evaluateRulesForDeployments(); err != nil {
-						log.Error("Error while evaluating rules", err)
-					}
-				case "StatefulSet":
-					if err := as.evaluateRulesForStatefulSets(); err != nil {
-						log.Error("Error while evaluating rules", err)
-					}
-				}
+		defer func() { ticker.Stop() }()
+
+		// Evaluate right away to learn the replicas of the target and start sampling its rules
+		as.tick(true)
+		for {
+			select {
+			case <-as.stopChan:
+				as.stopSamplers()
+				log.Infof("Autoscaler for %s %s/%s stopped", as.target.Kind, as.target.Namespace, as.target.Name)
+				return
+			case <-ticker.C:
+				as.tick(false)
+			case <-as.trigger:
+				log.Debugf("Evaluation of %s %s/%s triggered", as.target.Kind, as.target.Namespace, as.target.Name)
+				as.tick(true)
+			}
+
+			if newInterval := as.currentInterval(); newInterval != interval {
+				log.Infof("Check interval changed from %v to %v", interval, newInterval)
+				interval = newInterval
+				ticker.Stop()
+				ticker = time.NewTicker(interval)
 			}
 		}
 	}()
 }
 
-func calculateNewReplicas(rule *v1.AutoscalingRule, replicasOld int32, scaleUp bool) float64 {
-	var (
-		mode string
-	)
-	if scaleUp {
-		mode = rule.Spec.Modes.UpscalingMode
-	} else {
-		mode = rule.Spec.Modes.DownscalingMode
-	}
+// tick evaluates the target. Triggered evaluations happen in addition to the regular ones and therefore do not
+// count as calmdown intervals.
+func (as *Autoscaler) tick(triggered bool) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
 
-	switch mode {
-	case "mild":
-		if scaleUp {
-			return policies.Mild.UpScalingFunction(replicasOld)
-		} else {
-			return policies.Mild.DownScalingFunction(replicasOld)
-		}
-	case "medium":
-		if scaleUp {
-			return policies.Medium.UpScalingFunction(replicasOld)
-		} else {
-			return policies.Medium.DownScalingFunction(replicasOld)
-		}
-	case "strong":
-		if scaleUp {
-			return policies.Strong.UpScalingFunction(replicasOld)
-		} else {
-			return policies.Strong.DownScalingFunction(replicasOld)
+	if as.calmdown && triggered {
+		log.Debug("Ignoring triggered evaluation while calming down")
+		return
+	}
+	if as.calmdown {
+		log.Debugf("Calming down after scaling (remaining calmdown intervals %d/%d)", as.remainingCalmdownIntervals, as.calmdownIntervals)
+		as.remainingCalmdownIntervals--
+		if as.remainingCalmdownIntervals <= 0 {
+			as.remainingCalmdownIntervals = as.calmdownIntervals
+			as.calmdown = false
 		}
-	default:
-		log.Warnf("Unsupported scaling mode: %s", rule.Spec.Modes.UpscalingMode)
-		return float64(replicasOld)
+		return
+	}
+
+	if err := as.evaluate(); err != nil {
+		log.Errorf("Error while evaluating rules: %v", err)
 	}
 }
 
-func (as Autoscaler) evaluateRule(rule *v1.AutoscalingRule, replicasOld int32) {
-	defer waitGroup.Done()
-	log.Debugf("Evaluating rule %s", rule.Name)
+func ruleKey(rule *v1.AutoscalingRule) string {
+	return rule.Namespace + "/" + rule.Name
+}
+
+// measurement is the value of a metric, aggregated over all of its series.
+type measurement struct {
+	value     resource.Quantity
+	timestamp time.Time
+	series    int
+}
 
-	if _, initialized := as.metricEvaluations[rule]; !initialized {
-		log.Debugf("Initializing new MetricEvaluation Object for rule %s", rule.Name)
-		as.metricEvaluations[rule] = util.NewMetricEvaluation(float64(replicasOld), 0)
+// fetchMetric reads a metric of the rule from its source and aggregates its series.
+func (as *Autoscaler) fetchMetric(ctx context.Context, rule *v1.AutoscalingRule, metricName string, delta bool) (measurement, error) {
+	source, err := metrics.ForRule(rule)
+	if err != nil {
+		return measurement{}, err
 	}
 
-	metricEvaluation := as.metricEvaluations[rule]
-	metric, err := metrics.GetMetric(as.kubeclientset, rule.Spec.TargetNamespace, rule.Spec.MetricName)
+	query := metrics.Query{Rule: rule, Namespace: rule.Spec.TargetNamespace, Metric: metricName, Delta: delta, Target: as.target.Target}
+	if err := metrics.ValidateAggregation(query.Aggregation()); err != nil {
+		return measurement{}, metrics.NewError(metrics.ErrorInvalid, source.Name(), err)
+	}
+	samples, err := metrics.Fetch(ctx, source, query)
+	if err != nil {
+		return measurement{}, err
+	}
+	if samples, err = as.dropStale(rule, samples); err != nil {
+		return measurement{}, metrics.NewError(metrics.ErrorStale, source.Name(), fmt.Errorf("metric %s: %v", metricName, err))
+	}
+	if len(samples) == 0 && query.Aggregation() != "count" {
+		return measurement{}, metrics.NewError(metrics.ErrorNotFound, source.Name(), fmt.Errorf("no values for metric %s", metricName))
+	}
 
+	value, timestamp, err := metrics.Aggregate(samples, query.Aggregation())
 	if err != nil {
-		log.Errorf("Could not retrieve metrics for rule %s", rule.Name, err)
-		return
+		return measurement{}, metrics.NewError(metrics.ErrorInvalid, source.Name(), err)
 	}
+	return measurement{value: value, timestamp: timestamp, series: len(samples)}, nil
+}
+
+// fetchSample fetches the value and, if the algorithm names one, the delta metric of the rule concurrently.
+func (as *Autoscaler) fetchSample(ctx context.Context, rule *v1.AutoscalingRule, scalingAlgorithm algorithm.ScalingAlgorithm) (algorithm.Sample, error) {
+	var sample algorithm.Sample
+	valueMetric, deltaMetric := scalingAlgorithm.Metrics(rule)
 
-	value, err := resource.ParseQuantity(metric.Items[0].Value)
+	var delta measurement
+	var deltaErr error
+	deltaDone := make(chan struct{})
+	go func() {
+		defer close(deltaDone)
+		if deltaMetric != "" {
+			delta, deltaErr = as.fetchMetric(ctx, rule, deltaMetric, true)
+		}
+	}()
+
+	value, err := as.fetchMetric(ctx, rule, valueMetric, false)
+	<-deltaDone
 	if err != nil {
-		log.Errorf("Could not parse metric for rule %s", rule.Name, err)
-		return
+		return sample, err
+	}
+	log.Debugf("Current Value: %v (%d series)", value.value, value.series)
+	sample.Value = value.value
+	sample.Timestamp = value.timestamp
+	sample.Series = value.series
+
+	if deltaMetric != "" {
+		if deltaErr != nil {
+			return sample, deltaErr
+		}
+		log.Debugf("Current Delta: %v (%d series)", delta.value, delta.series)
+		sample.Delta = delta.value
+		sample.HasDelta = true
 	}
+	return sample, nil
+}
 
-	if value.Cmp(rule.Spec.Thresholds.UpperThreshold)+1 >= 1 {
-		// UpperThreshold reached
-		log.Debugf("Upper threshold reached for rule %s", rule.Name)
-		if metricEvaluation.Higher && replicasOld < as.maxReplicas {
-			metricEvaluation.ViolationCount[0]++
-			if metricEvaluation.ViolationCount[0] >= rule.Spec.Thresholds.MaxViolationCount {
-				log.Debugf("Max violation count %f reached for rule %s", rule.Spec.Thresholds.MaxViolationCount, rule.Name)
-				// calc new replicas!
-				newReplicas := calculateNewReplicas(rule, replicasOld, true)
-				metricEvaluation.Replicas = newReplicas
-				metricEvaluation.ViolationCount[0] = 0
-			}
-		} else {
-			// Reset violation count, if latest violation was at lower threshold
-			metricEvaluation.Higher = true
-			metricEvaluation.ViolationCount[0] = 1
+// selectedRules lists the rules of the target that the policy permits to scale it. Rejected rules are reported once.
+func (as *Autoscaler) selectedRules(state targetState) []*v1.AutoscalingRule {
+	rules, err := as.rules.List(labels.Everything())
+	if err != nil {
+		log.Errorf("Could not list rules: %v", err)
+		return nil
+	}
+
+	selected := make([]*v1.AutoscalingRule, 0, len(rules))
+	rejected := make(map[string]bool)
+	for _, rule := range rules {
+		if !as.target.Selects(rule) {
+			continue
 		}
-	} else if value.Cmp(rule.Spec.Thresholds.LowerThreshold)-1 <= -1 {
-		log.Debugf("Lower threshold reached for rule %s", rule.Name)
-		// lowerThreshold reached
-		if !metricEvaluation.Higher && replicasOld > as.minReplicas {
-			metricEvaluation.ViolationCount[0]++
-			if metricEvaluation.ViolationCount[0] >= rule.Spec.Thresholds.MaxViolationCount {
-				log.Debugf("Max violation count %f reached for rule %s", rule.Spec.Thresholds.MaxViolationCount, rule.Name)
-				// calc new replicas!
-
-				newReplicas := calculateNewReplicas(rule, replicasOld, false)
-				metricEvaluation.Replicas = newReplicas
-				// reset countin
-				metricEvaluation.ViolationCount[0] = 0
+		if err := policy.Permits(rule, as.target.Namespace, state.labels); err != nil {
+			rejected[ruleKey(rule)] = true
+			if !as.rejected[ruleKey(rule)] {
+				log.Warnf("Ignoring rule %s for %s %s/%s: %v", ruleKey(rule), as.target.Kind, as.target.Namespace, as.target.Name, err)
+				as.recorder.Eventf(as.reference(state.uid), corev1.EventTypeWarning, "RuleRejected", "Rule %s ignored: %v", ruleKey(rule), err)
 			}
-		} else {
-			// Reset violation count, if latest violation was at upper threshold
-			metricEvaluation.Higher = false
-			metricEvaluation.ViolationCount[0] = 1
-		}
-	} else {
-		// if metric is in normal range again, reduce violation count
-		log.Debugf("Metric for rule %s in normal range", rule.Name)
-		if metricEvaluation.ViolationCount[0] >= 0.33 {
-			metricEvaluation.ViolationCount[0] -= 0.33
+			continue
 		}
+		selected = append(selected, rule)
 	}
+	as.rejected = rejected
+	return selected
 }
 
-func (as Autoscaler) evaluateRules(replicas int32) int32 {
-	log.Debug("Tick. Evaluate all metrics..")
-	// asynchronously evaluate metrics
-	for _, rule := range as.rules {
-		waitGroup.Add(1)
-		go as.evaluateRule(rule, replicas)
-	}
-	// Wait for all rules to be evaluated
-	waitGroup.Wait()
-	log.Debug("All metrics evaluated.")
+// proposal is the replica count proposed by a rule.
+type proposal struct {
+	rule        *v1.AutoscalingRule
+	replicas    float64
+	series      int
+	aggregation string
+	anomalies   int64
+	lastAnomaly time.Time
+}
+
+// combineProposals weights the recent proposals of the rules by their priority. Proposals older than the maximum
+// proposal age are ignored, if no rule has a recent proposal the current replicas are kept.
+func (as *Autoscaler) combineProposals(rules []*v1.AutoscalingRule, replicas int32) (int32, []proposal) {
+	as.evaluationsMutex.Lock()
+	defer as.evaluationsMutex.Unlock()
+
 	util.LogTable(as.metricEvaluations)
 
-	// calculate new replica as a by priority weighted sum
 	var (
+		proposals        []proposal
 		weights          int32
 		weightedReplicas float64
 	)
 
-	for rule, metricEvaluation := range as.metricEvaluations {
-		priority := rule.Spec.Priority
-		desiredReplicas := metricEvaluation.Replicas
+	now := time.Now()
+	for _, rule := range rules {
+		metricEvaluation, evaluated := as.metricEvaluations[ruleKey(rule)]
+		if !evaluated {
+			continue
+		}
+		if age := now.Sub(metricEvaluation.ProposedAt); age > as.maxProposalAge(as.ruleInterval(rule)) {
+			log.Debugf("Ignoring proposal of rule %s, it is %v old", rule.Name, age.Round(time.Second))
+			continue
+		}
+		proposals = append(proposals, proposal{rule, metricEvaluation.Replicas, metricEvaluation.Series, metricEvaluation.Aggregation, metricEvaluation.Anomaly.Anomalies, metricEvaluation.Anomaly.LastTime})
 
+		priority := rule.Spec.Priority
 		weights += priority
-		weightedReplicas += desiredReplicas * float64(priority)
+		weightedReplicas += metricEvaluation.Replicas * float64(priority)
 	}
 
-	return int32(math.Round(weightedReplicas / float64(weights)))
+	if weights == 0 {
+		log.Debug("No rule proposed a replica count")
+		return replicas, proposals
+	}
+	return int32(math.Round(weightedReplicas / float64(weights))), proposals
 }
 
-func (as Autoscaler) evaluateRulesForDeployments() error {
-	deployments := as.kubeclientset.AppsV1().Deployments(as.target.Namespace)
-	deployment, err := deployments.Get(as.target.Name, metav1.GetOptions{})
-
-	if err != nil {
-		return err
+// clamp limits the combined proposal of all rules to the bounds of the target.
+func (as *Autoscaler) clamp(replicas int32) int32 {
+	if replicas > as.maxReplicas {
+		return as.maxReplicas
+	} else if replicas < as.minReplicas {
+		return as.minReplicas
 	}
+	return replicas
+}
 
-	if *deployment.Spec.Replicas != deployment.Status.ReadyReplicas {
-		// Maybe the old scaling isn't completed yet
-		return fmt.Errorf("number of replicas instable, won't scale now")
+// recordStatus writes the proposals of the rules, the resulting decision and the availability of the metrics into
+// the status of every rule that proposed replicas or failed to fetch its metrics.
+func (as *Autoscaler) recordStatus(rules []*v1.AutoscalingRule, proposals []proposal, failures map[string]failure, desiredReplicas int32, activeOverride override) {
+	proposed := make(map[string]proposal, len(proposals))
+	for _, p := range proposals {
+		proposed[ruleKey(p.rule)] = p
 	}
 
-	newDesiredReplicas := as.evaluateRules(deployment.Status.Replicas)
+	for _, rule := range rules {
+		p, hasProposal := proposed[ruleKey(rule)]
+		f, hasFailed := failures[ruleKey(rule)]
+		if !hasProposal && !hasFailed {
+			continue
+		}
 
-	if newDesiredReplicas > as.maxReplicas {
-		newDesiredReplicas = as.maxReplicas
-	} else if newDesiredReplicas < as.minReplicas {
-		newDesiredReplicas = as.minReplicas
+		targetStatus := v1.TargetStatus{
+			Kind:             as.target.Kind,
+			Namespace:        as.target.Namespace,
+			Name:             as.target.Name,
+			ProposedReplicas: int32(math.Round(p.replicas)),
+			DesiredReplicas:  desiredReplicas,
+			DryRun:           as.dryRun,
+			Override:         activeOverride.String(),
+			Series:           int32(p.series),
+			Aggregation:      p.aggregation,
+			Anomalies:        p.anomalies,
+			Conditions:       as.conditions(f, f.count >= as.failureThreshold, as.failsafe),
+		}
+		if !p.lastAnomaly.IsZero() {
+			// Status times are stored with second precision, finer ones would make every update look like a change
+			lastAnomaly := metav1.NewTime(p.lastAnomaly.Truncate(time.Second))
+			targetStatus.LastAnomalyTime = &lastAnomaly
+		}
+		if err := as.statusUpdater.UpdateTarget(rule, targetStatus); err != nil {
+			log.Errorf("Could not update status of rule %s: %v", rule.Name, err)
+		}
 	}
+}
 
-	if newDesiredReplicas != deployment.Status.Replicas {
-		log.Infof("New desired replica count: %d", newDesiredReplicas)
+// recordDryRun reports a scaling decision that was not applied because the target is in dry-run mode.
+func (as *Autoscaler) recordDryRun(reference corev1.ObjectReference, replicas int32, newDesiredReplicas int32) {
+	log.Infof("Dry run: would scale %s %s/%s from %d to %d replicas", as.target.Kind, as.target.Namespace, as.target.Name, replicas, newDesiredReplicas)
+	dryRunReplicasGauge.Set(float64(newDesiredReplicas), as.target.Kind, as.target.Namespace, as.target.Name)
+	dryRunDecisionsCounter.Inc(as.target.Kind, as.target.Namespace, as.target.Name)
+	as.recorder.Eventf(reference, corev1.EventTypeNormal, "DryRunScaling", "Would scale from %d to %d replicas (dry run)", replicas, newDesiredReplicas)
 
-		// New desired Replicas! Should scale..
-		deployment.Spec.Replicas = &newDesiredReplicas
-		_, err := deployments.Update(deployment)
+	// Calm down as if the target was scaled, so decisions are recorded at the same pace as they would be applied
+	as.calmdown = true
+}
+
+// checkOverride reads the operator annotations of the target and reports every change of them as event.
+func (as *Autoscaler) checkOverride(state targetState) override {
+	activeOverride, err := parseOverride(state.annotations, time.Now())
+	if err != nil {
+		log.Warnf("Target %s %s/%s: %v", as.target.Kind, as.target.Namespace, as.target.Name, err)
+	}
 
-		if err == nil {
-			log.Info("Scaled deployment!")
-			calmdown = true
+	if description := activeOverride.String(); description != as.lastOverride {
+		if activeOverride.active() {
+			as.recorder.Eventf(as.reference(state.uid), corev1.EventTypeNormal, "AutoscalingDeferred", "Autoscaling %s", description)
+		} else {
+			as.recorder.Eventf(as.reference(state.uid), corev1.EventTypeNormal, "AutoscalingResumed", "Pause or override ended, autoscaling resumed")
 		}
-		return err
+		as.lastOverride = description
 	}
 
-	return err
+	if activeOverride.active() {
+		actuationDeferredGauge.Set(1, as.target.Kind, as.target.Namespace, as.target.Name)
+	} else {
+		actuationDeferredGauge.Set(0, as.target.Kind, as.target.Namespace, as.target.Name)
+	}
+	return activeOverride
 }
 
-func (as Autoscaler) evaluateRulesForStatefulSets() error {
-	statefulsets := as.kubeclientset.AppsV1().StatefulSets(as.target.Namespace)
-	statefulset, err := statefulsets.Get(as.target.Name, metav1.GetOptions{})
-
+func (as *Autoscaler) evaluate() error {
+	state, err := as.getTargetState()
 	if err != nil {
 		return err
 	}
+	as.currentReplicas = state.replicas
+	as.readyReplicas = state.readyReplicas
 
-	if *statefulset.Spec.Replicas != statefulset.Status.ReadyReplicas {
+	rules := as.selectedRules(state)
+	as.reconcileSamplers(rules)
+
+	// Pauses and overrides are reported and applied even while the target is rolling
+	activeOverride := as.checkOverride(state)
+
+	if state.specReplicas != state.readyReplicas {
+		if activeOverride.replicas != nil && *activeOverride.replicas != state.specReplicas && !as.dryRun {
+			log.Infof("Autoscaling of %s %s/%s %s, pinning replicas while rolling", as.target.Kind, as.target.Namespace, as.target.Name, activeOverride)
+			if err := as.scale(state, *activeOverride.replicas, true); err != nil {
+				if _, outdated := err.(outdatedDecision); !outdated {
+					return err
+				}
+			}
+			return nil
+		}
 		// Maybe the old scaling isn't completed yet
 		return fmt.Errorf("number of replicas instable, won't scale now")
 	}
 
-	newDesiredReplicas := as.evaluateRules(statefulset.Status.Replicas)
-
-	if newDesiredReplicas > as.maxReplicas {
-		newDesiredReplicas = as.maxReplicas
-	} else if newDesiredReplicas < as.minReplicas {
-		newDesiredReplicas = as.minReplicas
-	}
+	combined, proposals := as.combineProposals(rules, state.replicas)
+	combined, failures := as.applyFailurePolicy(rules, state, combined)
 
-	if newDesiredReplicas != statefulset.Status.Replicas {
-		log.Infof("New desired replica count: %d", newDesiredReplicas)
+	newDesiredReplicas := as.clamp(combined)
+	desiredReplicasGauge.Set(float64(newDesiredReplicas), as.target.Kind, as.target.Namespace, as.target.Name)
+	as.recordStatus(rules, proposals, failures, newDesiredReplicas, activeOverride)
 
-		// New desired Replicas! Should scale..
-		statefulset.Spec.Replicas = &newDesiredReplicas
-		_, err := statefulsets.Update(statefulset)
+	if activeOverride.active() {
+		log.Infof("Autoscaling of %s %s/%s %s, not applying %d replicas", as.target.Kind, as.target.Namespace, as.target.Name, activeOverride, newDesiredReplicas)
+		if activeOverride.replicas == nil || *activeOverride.replicas == state.specReplicas || as.dryRun {
+			return nil
+		}
+		// Pin the target to the replicas requested by the operator
+		newDesiredReplicas = *activeOverride.replicas
+	} else if newDesiredReplicas == state.replicas {
+		return nil
+	} else if as.dryRun {
+		as.recordDryRun(as.reference(state.uid), state.replicas, newDesiredReplicas)
+		return nil
+	}
+	log.Infof("New desired replica count: %d", newDesiredReplicas)
 
-		if err == nil {
-			log.Info("Scaled deployment!")
-			calmdown = true
+	// New desired Replicas! Should scale..
+	if err := as.scale(state, newDesiredReplicas, activeOverride.active()); err != nil {
+		if _, outdated := err.(outdatedDecision); outdated {
+			log.Infof("Not scaling %s %s/%s: %v", as.target.Kind, as.target.Namespace, as.target.Name, err)
+			return nil
 		}
 		return err
 	}
 
-	return err
+	log.Infof("Scaled %s!", as.target.Kind)
+	as.calmdown = true
+	return nil
 }
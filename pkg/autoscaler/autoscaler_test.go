@@ -0,0 +1,154 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package autoscaler
+
+import (
+	"encoding/json"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/client/clientset/versioned"
+	listers "github.com/grieshaber/generic-autoscaler-controller/pkg/client/listers/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/events"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/status"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ruleServer serves the AutoscalingRules of the namespace shop and keeps the target statuses written to them.
+type ruleServer struct {
+	mutex sync.Mutex
+	rules map[string]*v1.AutoscalingRule
+}
+
+func (s *ruleServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/apis/bsinfo.hhu.de/v1/namespaces/shop/autoscalingrules/"), "/status")
+	rule, exists := s.rules[name]
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodPut {
+		var updated v1.AutoscalingRule
+		if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		rule.Status = updated.Status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+// targetStatuses returns the statuses of the rule's targets.
+func (s *ruleServer) targetStatuses(name string) []v1.TargetStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.rules[name].Status.Targets
+}
+
+// newTestAutoscaler returns an autoscaler of the deployment shop/web served by the given server with the rules of
+// the rule server. The rules are not sampled, their evaluations are set by the tests.
+func newTestAutoscaler(t *testing.T, settings config.Settings, deployments *deploymentServer, rules *ruleServer) *Autoscaler {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/apis/bsinfo.hhu.de/") {
+			rules.ServeHTTP(w, r)
+		} else {
+			deployments.ServeHTTP(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rulesClientset, err := versioned.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, rule := range rules.rules {
+		indexer.Add(rule.DeepCopy())
+	}
+	target := config.ResolvedTarget{Target: util.Target{Kind: "Deployment", Namespace: "shop", Name: "web"}, Settings: settings}
+	as := New(clientset, target, listers.NewAutoscalingRuleLister(indexer), status.NewUpdater(rulesClientset), events.NewRecorder(clientset))
+	for _, rule := range rules.rules {
+		as.samplers[ruleKey(rule)] = &sampler{namespace: rule.Namespace, name: rule.Name, interval: as.ruleInterval(rule), stopChan: make(chan struct{})}
+	}
+	return as
+}
+
+// testDeployment returns a server of a deployment with the given replicas, all of them ready.
+func testDeployment(replicas int32) *deploymentServer {
+	return &deploymentServer{
+		deployment: appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web", UID: "1234", ResourceVersion: "1"},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsv1.DeploymentStatus{Replicas: replicas, ReadyReplicas: replicas},
+		},
+		events: &eventServer{},
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	tests := []struct {
+		dryRun   bool
+		replicas int32
+		updates  int
+		reasons  []string
+	}{
+		{false, 5, 1, nil},
+		{true, 2, 0, []string{"DryRunScaling"}},
+	}
+	for _, test := range tests {
+		rule := &v1.AutoscalingRule{
+			TypeMeta:   metav1.TypeMeta{Kind: "AutoscalingRule", APIVersion: "bsinfo.hhu.de/v1"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "queue"},
+			Spec:       v1.AutoscalingRuleSpec{Priority: 1},
+		}
+		deployments, rules := testDeployment(2), &ruleServer{rules: map[string]*v1.AutoscalingRule{"queue": rule}}
+		as := newTestAutoscaler(t, config.Settings{MinReplicas: 1, MaxReplicas: 10, CheckInterval: 30, DryRun: test.dryRun}, deployments, rules)
+		evaluation := util.NewMetricEvaluation("threshold", 5)
+		evaluation.ProposedAt = time.Now()
+		as.metricEvaluations[ruleKey(rule)] = evaluation
+
+		if err := as.evaluate(); err != nil {
+			t.Fatal(err)
+		}
+		if *deployments.deployment.Spec.Replicas != test.replicas || deployments.updates != test.updates || !as.calmdown {
+			t.Errorf("dry run %v: got %d replicas after %d updates, calming down %v, expected %d replicas", test.dryRun,
+				*deployments.deployment.Spec.Replicas, deployments.updates, as.calmdown, test.replicas)
+		}
+		if reasons := deployments.events.recorded(); !reflect.DeepEqual(reasons, test.reasons) {
+			t.Errorf("dry run %v: recorded events %v, expected %v", test.dryRun, reasons, test.reasons)
+		}
+		statuses := rules.targetStatuses("queue")
+		if len(statuses) != 1 || statuses[0].DryRun != test.dryRun || statuses[0].DesiredReplicas != 5 || statuses[0].ProposedReplicas != 5 {
+			t.Errorf("dry run %v: got target status %+v", test.dryRun, statuses)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package autoscaler
+
+import (
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/algorithm"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"math"
+	"time"
+)
+
+const (
+	DeltaPerInterval = "interval"
+	DeltaPerSecond   = "second"
+
+	// maxHistory bounds the values kept per rule, independent of the window
+	maxHistory = 120
+)
+
+// deltaWindow is the window of values the delta of the rule is derived from.
+func deltaWindow(rule *v1.AutoscalingRule, interval time.Duration) time.Duration {
+	if derivation := rule.Spec.AutoMode.DeltaDerivation; derivation != nil && derivation.Window != nil && derivation.Window.Duration > 0 {
+		return derivation.Window.Duration
+	}
+	return 5 * interval
+}
+
+// deriveDelta records the value of the sample in the history of the rule and returns the slope of a linear
+// regression over the values within the window, per sampling interval or per second. Without at least two values
+// in the window the delta is zero.
+func deriveDelta(rule *v1.AutoscalingRule, state *util.MetricEvaluation, sample algorithm.Sample, interval time.Duration) resource.Quantity {
+	derivation := rule.Spec.AutoMode.DeltaDerivation
+	if derivation == nil {
+		derivation = &v1.DeltaDerivation{}
+	}
+
+	timestamp := sample.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	raw := float64(sample.Value.MilliValue()) / 1000
+	value := raw
+	if derivation.Counter {
+		if len(state.History) > 0 && raw < state.LastRaw {
+			// The counter was reset and started from zero again
+			state.CounterOffset += state.LastRaw
+		}
+		value += state.CounterOffset
+	}
+	state.LastRaw = raw
+
+	// Metrics that were not updated since the last sample add nothing to the history
+	if n := len(state.History); n == 0 || timestamp.After(state.History[n-1].Timestamp) {
+		state.History = append(state.History, util.TimedValue{Timestamp: timestamp, Value: value})
+	}
+
+	oldest := timestamp.Add(-deltaWindow(rule, interval))
+	start := 0
+	for start < len(state.History) && state.History[start].Timestamp.Before(oldest) {
+		start++
+	}
+	if len(state.History)-start > maxHistory {
+		start = len(state.History) - maxHistory
+	}
+	state.History = append(state.History[:0], state.History[start:]...)
+
+	slope := regressionSlope(state.History)
+	if derivation.Unit != DeltaPerSecond {
+		slope *= interval.Seconds()
+	}
+	return *resource.NewMilliQuantity(int64(math.Round(slope*1000)), resource.DecimalSI)
+}
+
+// regressionSlope is the slope per second of the least squares line through the values.
+func regressionSlope(history []util.TimedValue) float64 {
+	if len(history) < 2 {
+		return 0
+	}
+
+	origin := history[0].Timestamp
+	var sumX, sumY float64
+	for _, point := range history {
+		sumX += point.Timestamp.Sub(origin).Seconds()
+		sumY += point.Value
+	}
+	n := float64(len(history))
+	meanX, meanY := sumX/n, sumY/n
+
+	var covariance, variance float64
+	for _, point := range history {
+		dx := point.Timestamp.Sub(origin).Seconds() - meanX
+		covariance += dx * (point.Value - meanY)
+		variance += dx * dx
+	}
+	if variance == 0 {
+		return 0
+	}
+	return covariance / variance
+}
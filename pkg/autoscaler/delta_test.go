@@ -0,0 +1,138 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package autoscaler
+
+import (
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/algorithm"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"math"
+	"testing"
+	"time"
+)
+
+var deltaEpoch = time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func timedValues(interval time.Duration, values ...float64) []util.TimedValue {
+	history := make([]util.TimedValue, len(values))
+	for i, value := range values {
+		history[i] = util.TimedValue{Timestamp: deltaEpoch.Add(time.Duration(i) * interval), Value: value}
+	}
+	return history
+}
+
+func TestRegressionSlope(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		history  []util.TimedValue
+		expected float64
+	}{
+		{"empty", nil, 0},
+		{"single value", timedValues(time.Second, 5), 0},
+		{"constant", timedValues(time.Second, 3, 3, 3), 0},
+		{"rising", timedValues(time.Second, 0, 2, 4, 6), 2},
+		{"falling", timedValues(10*time.Second, 100, 90, 80), -1},
+		{"noise around a line", timedValues(time.Second, 1, 0, 3, 2, 5, 4), 0.8285714286},
+		{"symmetric", timedValues(time.Second, 0, 10, 0), 0},
+		{"same timestamp", []util.TimedValue{{Timestamp: deltaEpoch, Value: 1}, {Timestamp: deltaEpoch, Value: 5}}, 0},
+		{"uneven spacing", []util.TimedValue{{Timestamp: deltaEpoch, Value: 0}, {Timestamp: deltaEpoch.Add(time.Second), Value: 1},
+			{Timestamp: deltaEpoch.Add(4 * time.Second), Value: 4}}, 1},
+	} {
+		if slope := regressionSlope(test.history); math.Abs(slope-test.expected) > 1e-6 {
+			t.Errorf("%s: slope %v, expected %v", test.name, slope, test.expected)
+		}
+	}
+}
+
+func deltaRule(derivation *v1.DeltaDerivation) *v1.AutoscalingRule {
+	return &v1.AutoscalingRule{Spec: v1.AutoscalingRuleSpec{AutoMode: v1.AutoMode{DeltaDerivation: derivation}}}
+}
+
+// derive feeds the values sampled every interval and returns the deltas in milli units.
+func derive(rule *v1.AutoscalingRule, state *util.MetricEvaluation, interval time.Duration, values ...float64) []int64 {
+	deltas := make([]int64, len(values))
+	for i, value := range values {
+		sample := algorithm.Sample{
+			Value:     *resource.NewMilliQuantity(int64(value*1000), resource.DecimalSI),
+			Timestamp: deltaEpoch.Add(time.Duration(i) * interval),
+		}
+		delta := deriveDelta(rule, state, sample, interval)
+		deltas[i] = delta.MilliValue()
+	}
+	return deltas
+}
+
+func equalDeltas(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDeriveDelta(t *testing.T) {
+	interval := 10 * time.Second
+	for _, test := range []struct {
+		name       string
+		derivation *v1.DeltaDerivation
+		values     []float64
+		expected   []int64
+	}{
+		{"per interval", nil, []float64{10, 20, 30, 40}, []int64{0, 10000, 10000, 10000}},
+		{"per second", &v1.DeltaDerivation{Unit: DeltaPerSecond}, []float64{10, 20, 30}, []int64{0, 1000, 1000}},
+		// The default window spans five intervals, the jump is forgotten once it is older
+		{"window", nil, []float64{0, 100, 100, 100, 100, 100, 100, 100}, []int64{0, 100000, 50000, 30000, 20000, 14286, 0, 0}},
+		{"short window", &v1.DeltaDerivation{Window: &metav1.Duration{Duration: 10 * time.Second}}, []float64{0, 10, 30, 60}, []int64{0, 10000, 20000, 30000}},
+		{"gauge decreasing", nil, []float64{50, 40, 30}, []int64{0, -10000, -10000}},
+		{"counter", &v1.DeltaDerivation{Counter: true}, []float64{100, 150, 200}, []int64{0, 50000, 50000}},
+		// A decreasing counter was reset, its new values continue where it left off
+		{"counter reset", &v1.DeltaDerivation{Counter: true, Window: &metav1.Duration{Duration: 10 * time.Second}}, []float64{100, 150, 10, 60, 5}, []int64{0, 50000, 10000, 50000, 5000}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			state := &util.MetricEvaluation{}
+			if deltas := derive(deltaRule(test.derivation), state, interval, test.values...); !equalDeltas(deltas, test.expected) {
+				t.Errorf("deltas %v, expected %v", deltas, test.expected)
+			}
+		})
+	}
+}
+
+func TestDeriveDeltaHistory(t *testing.T) {
+	interval := time.Second
+	rule := deltaRule(&v1.DeltaDerivation{Window: &metav1.Duration{Duration: time.Hour}})
+	state := &util.MetricEvaluation{}
+
+	values := make([]float64, 3*maxHistory)
+	for i := range values {
+		values[i] = float64(i)
+	}
+	derive(rule, state, interval, values...)
+	if len(state.History) != maxHistory {
+		t.Errorf("history of %d values, expected at most %d", len(state.History), maxHistory)
+	}
+	if last := state.History[len(state.History)-1].Value; last != values[len(values)-1] {
+		t.Errorf("history ends with %v, expected the latest value", last)
+	}
+
+	// Samples that were not updated since the last one are not recorded again
+	sample := algorithm.Sample{Value: *resource.NewQuantity(1000, resource.DecimalSI), Timestamp: state.History[len(state.History)-1].Timestamp}
+	deriveDelta(rule, state, sample, interval)
+	if len(state.History) != maxHistory || state.History[len(state.History)-1].Value == 1000 {
+		t.Errorf("sample with unchanged timestamp recorded")
+	}
+}
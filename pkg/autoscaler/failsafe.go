@@ -0,0 +1,143 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package autoscaler
+
+import (
+	log "github.com/Sirupsen/logrus"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	"sort"
+	"strings"
+)
+
+// failure counts the consecutive samples a rule could not fetch its metrics.
+type failure struct {
+	count int
+	err   error
+}
+
+// recordFailure counts a failed sample of the rule.
+func (as *Autoscaler) recordFailure(rule *v1.AutoscalingRule, err error) {
+	as.evaluationsMutex.Lock()
+	defer as.evaluationsMutex.Unlock()
+
+	f := as.failures[ruleKey(rule)]
+	f.count++
+	f.err = err
+	as.failures[ruleKey(rule)] = f
+	metricFailuresGauge.Set(float64(f.count), as.target.Kind, as.target.Namespace, as.target.Name, ruleKey(rule))
+}
+
+// recordSuccess resets the failures of the rule. The evaluations mutex has to be held.
+func (as *Autoscaler) recordSuccess(rule *v1.AutoscalingRule) {
+	if _, failed := as.failures[ruleKey(rule)]; failed {
+		log.Infof("Metrics of rule %s are available again", rule.Name)
+		delete(as.failures, ruleKey(rule))
+	}
+	metricFailuresGauge.Set(0, as.target.Kind, as.target.Namespace, as.target.Name, ruleKey(rule))
+}
+
+// currentFailures returns the failures of the given rules.
+func (as *Autoscaler) currentFailures(rules []*v1.AutoscalingRule) map[string]failure {
+	as.evaluationsMutex.Lock()
+	defer as.evaluationsMutex.Unlock()
+
+	failures := make(map[string]failure)
+	for _, rule := range rules {
+		if f, failed := as.failures[ruleKey(rule)]; failed {
+			failures[ruleKey(rule)] = f
+		}
+	}
+	return failures
+}
+
+// failedRules lists the rules that reached the failure threshold.
+func (as *Autoscaler) failedRules(failures map[string]failure) []string {
+	var failed []string
+	for key, f := range failures {
+		if f.count >= as.failureThreshold {
+			failed = append(failed, key)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// failsafeReplicas applies the failure policy of the target to the combined proposal of the rules.
+func (as *Autoscaler) failsafeReplicas(replicas int32, combined int32) int32 {
+	switch as.failurePolicy {
+	case config.FailurePolicyFallback:
+		return as.fallbackReplicas
+	case config.FailurePolicyScaleUp:
+		if combined > replicas {
+			return combined
+		}
+		return replicas + 1
+	default:
+		return replicas
+	}
+}
+
+// applyFailurePolicy replaces the combined proposal of the rules by the one of the failure policy while any of them
+// reached the failure threshold. It returns the replicas and the failures of the rules.
+func (as *Autoscaler) applyFailurePolicy(rules []*v1.AutoscalingRule, state targetState, combined int32) (int32, map[string]failure) {
+	failures := as.currentFailures(rules)
+	failed := as.failedRules(failures)
+	if len(failed) > 0 {
+		combined = as.failsafeReplicas(state.replicas, combined)
+	}
+	as.reportFailsafe(state, failed)
+	return combined, failures
+}
+
+// reportFailsafe reports the target entering and leaving failsafe mode.
+func (as *Autoscaler) reportFailsafe(state targetState, failed []string) {
+	active := len(failed) > 0
+	if active {
+		failsafeGauge.Set(1, as.target.Kind, as.target.Namespace, as.target.Name)
+	} else {
+		failsafeGauge.Set(0, as.target.Kind, as.target.Namespace, as.target.Name)
+	}
+	if active == as.failsafe {
+		return
+	}
+	as.failsafe = active
+
+	if active {
+		log.Warnf("Metrics of %s unavailable, applying failure policy %s to %s %s/%s", strings.Join(failed, ", "), as.failurePolicy, as.target.Kind, as.target.Namespace, as.target.Name)
+		as.recorder.Eventf(as.reference(state.uid), corev1.EventTypeWarning, "FailsafeActivated", "Metrics of %s unavailable, applying failure policy %s", strings.Join(failed, ", "), as.failurePolicy)
+	} else {
+		log.Infof("Metrics of all rules of %s %s/%s available again", as.target.Kind, as.target.Namespace, as.target.Name)
+		as.recorder.Eventf(as.reference(state.uid), corev1.EventTypeNormal, "FailsafeDeactivated", "Metrics of all rules available again")
+	}
+}
+
+// conditions describes the availability of the rule's metrics and the failsafe mode of the target.
+func (as *Autoscaler) conditions(f failure, failed bool, failsafe bool) []v1.Condition {
+	metricsAvailable := v1.Condition{Type: v1.ConditionMetricsAvailable, Status: string(corev1.ConditionTrue), Reason: "FetchSucceeded"}
+	if f.count > 0 {
+		metricsAvailable = v1.Condition{Type: v1.ConditionMetricsAvailable, Status: string(corev1.ConditionFalse), Reason: "FetchFailed", Message: f.err.Error()}
+	}
+
+	failsafeCondition := v1.Condition{Type: v1.ConditionFailsafe, Status: string(corev1.ConditionFalse), Reason: "MetricsAvailable"}
+	if failsafe {
+		failsafeCondition = v1.Condition{Type: v1.ConditionFailsafe, Status: string(corev1.ConditionTrue), Reason: "FailurePolicy" + strings.Title(as.failurePolicy)}
+		if failed {
+			failsafeCondition.Message = "Metrics of this rule are unavailable"
+		} else {
+			failsafeCondition.Message = "Metrics of other rules of the target are unavailable"
+		}
+	}
+	return []v1.Condition{metricsAvailable, failsafeCondition}
+}
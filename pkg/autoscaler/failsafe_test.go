@@ -0,0 +1,166 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package autoscaler
+
+import (
+	"encoding/json"
+	"errors"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/events"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/monitoring"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// eventServer records the reasons of the events created in the namespace shop.
+type eventServer struct {
+	mutex   sync.Mutex
+	reasons []string
+}
+
+func (s *eventServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var event corev1.Event
+	if r.Method != http.MethodPost || r.URL.Path != "/api/v1/namespaces/shop/events" || json.NewDecoder(r.Body).Decode(&event) != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	s.mutex.Lock()
+	s.reasons = append(s.reasons, event.Reason)
+	s.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&event)
+}
+
+// recorded returns the reasons of the events recorded since the last call.
+func (s *eventServer) recorded() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	reasons := s.reasons
+	s.reasons = nil
+	return reasons
+}
+
+// newClientset returns a clientset of an emulated API server serving the given handler until the test ends.
+func newClientset(t *testing.T, handler http.Handler) *kubernetes.Clientset {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientset
+}
+
+// metricsOutput returns the metrics currently exposed by the controller.
+func metricsOutput() string {
+	response := httptest.NewRecorder()
+	monitoring.Handler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return response.Body.String()
+}
+
+func TestFailurePolicies(t *testing.T) {
+	queue := &v1.AutoscalingRule{}
+	queue.Namespace, queue.Name = "shop", "queue"
+	cpu := &v1.AutoscalingRule{}
+	cpu.Namespace, cpu.Name = "shop", "cpu"
+	rules := []*v1.AutoscalingRule{queue, cpu}
+	state := targetState{replicas: 4}
+
+	tests := []struct {
+		policy   string
+		replicas int32
+		reason   string
+	}{
+		{config.FailurePolicyHold, 4, "FailurePolicyHold"},
+		{config.FailurePolicyFallback, 6, "FailurePolicyFallback"},
+		{config.FailurePolicyScaleUp, 5, "FailurePolicyScaleUp"},
+	}
+	for _, test := range tests {
+		server := &eventServer{}
+		as := &Autoscaler{
+			target:           config.ResolvedTarget{Target: util.Target{Kind: "Deployment", Namespace: "shop", Name: "web"}},
+			failurePolicy:    test.policy,
+			failureThreshold: 3,
+			fallbackReplicas: 6,
+			failures:         make(map[string]failure),
+			recorder:         events.NewRecorder(newClientset(t, server)),
+		}
+
+		// The rules propose to scale down to 3 replicas, the metrics of queue fail from now on
+		for i := 1; i <= 3; i++ {
+			as.recordFailure(queue, errors.New("metrics unavailable"))
+			replicas, failures := as.applyFailurePolicy(rules, state, 3)
+			if i < 3 {
+				if replicas != 3 || as.failsafe || len(server.recorded()) > 0 {
+					t.Errorf("%s: failsafe after %d failures, got %d replicas", test.policy, i, replicas)
+				}
+				continue
+			}
+
+			if replicas != test.replicas || !as.failsafe {
+				t.Errorf("%s: got %d replicas and failsafe %v, expected %d replicas", test.policy, replicas, as.failsafe, test.replicas)
+			}
+			if reasons := server.recorded(); !reflect.DeepEqual(reasons, []string{"FailsafeActivated"}) {
+				t.Errorf("%s: recorded events %v", test.policy, reasons)
+			}
+			expected := []v1.Condition{
+				{Type: v1.ConditionMetricsAvailable, Status: "False", Reason: "FetchFailed", Message: "metrics unavailable"},
+				{Type: v1.ConditionFailsafe, Status: "True", Reason: test.reason, Message: "Metrics of this rule are unavailable"},
+			}
+			f := failures[ruleKey(queue)]
+			if conditions := as.conditions(f, f.count >= as.failureThreshold, as.failsafe); !reflect.DeepEqual(conditions, expected) {
+				t.Errorf("%s: conditions of the failed rule %v", test.policy, conditions)
+			}
+			expected = []v1.Condition{
+				{Type: v1.ConditionMetricsAvailable, Status: "True", Reason: "FetchSucceeded"},
+				{Type: v1.ConditionFailsafe, Status: "True", Reason: test.reason, Message: "Metrics of other rules of the target are unavailable"},
+			}
+			if conditions := as.conditions(failures[ruleKey(cpu)], false, as.failsafe); !reflect.DeepEqual(conditions, expected) {
+				t.Errorf("%s: conditions of the available rule %v", test.policy, conditions)
+			}
+		}
+		if gauge := `gac_metric_failures{kind="Deployment",namespace="shop",name="web",rule="shop/queue"} 3`; !strings.Contains(metricsOutput(), gauge) {
+			t.Errorf("%s: metrics do not contain %s", test.policy, gauge)
+		}
+
+		as.evaluationsMutex.Lock()
+		as.recordSuccess(queue)
+		as.evaluationsMutex.Unlock()
+		replicas, failures := as.applyFailurePolicy(rules, state, 3)
+		if replicas != 3 || as.failsafe || len(failures) > 0 {
+			t.Errorf("%s: got %d replicas and failsafe %v after the metrics recovered", test.policy, replicas, as.failsafe)
+		}
+		if reasons := server.recorded(); !reflect.DeepEqual(reasons, []string{"FailsafeDeactivated"}) {
+			t.Errorf("%s: recorded events %v after the metrics recovered", test.policy, reasons)
+		}
+		expected := []v1.Condition{
+			{Type: v1.ConditionMetricsAvailable, Status: "True", Reason: "FetchSucceeded"},
+			{Type: v1.ConditionFailsafe, Status: "False", Reason: "MetricsAvailable"},
+		}
+		if conditions := as.conditions(failures[ruleKey(queue)], false, as.failsafe); !reflect.DeepEqual(conditions, expected) {
+			t.Errorf("%s: conditions after the metrics recovered %v", test.policy, conditions)
+		}
+		if gauge := `rule="shop/queue"} 0`; !strings.Contains(metricsOutput(), gauge) {
+			t.Errorf("%s: failures of the rule were not reset", test.policy)
+		}
+	}
+}
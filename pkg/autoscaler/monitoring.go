@@ -0,0 +1,31 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package autoscaler
+
+import (
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/monitoring"
+)
+
+var (
+	desiredReplicasGauge    = monitoring.NewGaugeVec("gac_desired_replicas", "Replica count decided for the target.", "kind", "namespace", "name")
+	dryRunReplicasGauge     = monitoring.NewGaugeVec("gac_dry_run_replicas", "Replica count the target would have been scaled to in dry-run mode.", "kind", "namespace", "name")
+	dryRunDecisionsCounter  = monitoring.NewCounterVec("gac_dry_run_decisions_total", "Scaling decisions that were not applied because of dry-run mode.", "kind", "namespace", "name")
+	scalingConflictsCounter = monitoring.NewCounterVec("gac_scaling_conflicts_total", "Scaling attempts that failed because the target was modified concurrently.", "kind", "namespace", "name")
+	staleSeriesCounter      = monitoring.NewCounterVec("gac_stale_series_total", "Metric series dropped because they were older than the maximum metric age of the rule.", "kind", "namespace", "name", "rule")
+	metricStaleGauge        = monitoring.NewGaugeVec("gac_metric_stale", "Whether the latest sample of a rule was unavailable because all of its series were stale.", "kind", "namespace", "name", "rule")
+	anomaliesCounter        = monitoring.NewCounterVec("gac_anomalies_total", "Anomalous samples of a rule by the action taken on them.", "kind", "namespace", "name", "rule", "action")
+	anomalyScoreGauge       = monitoring.NewGaugeVec("gac_anomaly_score", "Score of the latest anomalous sample of a rule.", "kind", "namespace", "name", "rule")
+	metricFailuresGauge     = monitoring.NewGaugeVec("gac_metric_failures", "Consecutive samples of a rule that failed to fetch its metrics.", "kind", "namespace", "name", "rule")
+	failsafeGauge           = monitoring.NewGaugeVec("gac_failsafe_active", "Whether the target is scaled by its failure policy because metrics are unavailable.", "kind", "namespace", "name")
+	actuationDeferredGauge  = monitoring.NewGaugeVec("gac_actuation_deferred", "Whether scaling decisions are deferred by a pause or override annotation on the target.", "kind", "namespace", "name")
+)
@@ -0,0 +1,87 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package autoscaler
+
+import (
+	"fmt"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule"
+	"strconv"
+	"time"
+)
+
+// Annotations on a target that let operators take over. Rules are still evaluated while one of them is active,
+// but their decisions are not applied.
+const (
+	// PauseAnnotation set to "true" stops the autoscaler from changing the replicas of the target
+	PauseAnnotation = autoscalingrule.GroupName + "/pause"
+	// OverrideReplicasAnnotation pins the target to the given replica count until OverrideExpiresAnnotation
+	OverrideReplicasAnnotation = autoscalingrule.GroupName + "/override-replicas"
+	// OverrideExpiresAnnotation is an RFC 3339 timestamp ending the override
+	OverrideExpiresAnnotation = autoscalingrule.GroupName + "/override-expires"
+)
+
+type override struct {
+	paused   bool
+	replicas *int32
+	expires  time.Time
+}
+
+func (o override) active() bool {
+	return o.paused || o.replicas != nil
+}
+
+func (o override) String() string {
+	switch {
+	case o.paused:
+		return "paused"
+	case o.replicas != nil:
+		return fmt.Sprintf("overridden to %d replicas until %s", *o.replicas, o.expires.Format(time.RFC3339))
+	default:
+		return ""
+	}
+}
+
+// parseOverride reads the operator annotations of a target. An expired override is ignored. Malformed annotations
+// are reported and pause the target, so the autoscaler never overwrites a manual change it does not understand.
+func parseOverride(annotations map[string]string, now time.Time) (override, error) {
+	var result override
+
+	if value, exists := annotations[PauseAnnotation]; exists {
+		paused, err := strconv.ParseBool(value)
+		if err != nil {
+			return override{paused: true}, fmt.Errorf("invalid value %q of annotation %s", value, PauseAnnotation)
+		}
+		result.paused = paused
+	}
+
+	value, exists := annotations[OverrideReplicasAnnotation]
+	if !exists {
+		return result, nil
+	}
+
+	replicas, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || replicas < 0 {
+		return override{paused: true}, fmt.Errorf("invalid value %q of annotation %s", value, OverrideReplicasAnnotation)
+	}
+	expires, err := time.Parse(time.RFC3339, annotations[OverrideExpiresAnnotation])
+	if err != nil {
+		return override{paused: true}, fmt.Errorf("annotation %s requires a RFC 3339 timestamp in %s", OverrideReplicasAnnotation, OverrideExpiresAnnotation)
+	}
+
+	if now.Before(expires) {
+		overrideReplicas := int32(replicas)
+		result.replicas = &overrideReplicas
+		result.expires = expires
+	}
+	return result, nil
+}
@@ -0,0 +1,79 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package autoscaler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseOverride(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	later := now.Add(time.Hour).Format(time.RFC3339)
+	earlier := now.Add(-time.Hour).Format(time.RFC3339)
+
+	for _, test := range []struct {
+		name        string
+		annotations map[string]string
+		paused      bool
+		replicas    int32 // -1 for no override
+		invalid     bool
+	}{
+		{"none", nil, false, -1, false},
+		{"paused", map[string]string{PauseAnnotation: "true"}, true, -1, false},
+		{"unpaused", map[string]string{PauseAnnotation: "false"}, false, -1, false},
+		{"override", map[string]string{OverrideReplicasAnnotation: "4", OverrideExpiresAnnotation: later}, false, 4, false},
+		{"override to zero", map[string]string{OverrideReplicasAnnotation: "0", OverrideExpiresAnnotation: later}, false, 0, false},
+		{"expired override", map[string]string{OverrideReplicasAnnotation: "4", OverrideExpiresAnnotation: earlier}, false, -1, false},
+		{"paused and override", map[string]string{PauseAnnotation: "true", OverrideReplicasAnnotation: "4", OverrideExpiresAnnotation: later}, true, 4, false},
+		{"malformed pause", map[string]string{PauseAnnotation: "yes please"}, true, -1, true},
+		{"malformed replicas", map[string]string{OverrideReplicasAnnotation: "four", OverrideExpiresAnnotation: later}, true, -1, true},
+		{"negative replicas", map[string]string{OverrideReplicasAnnotation: "-1", OverrideExpiresAnnotation: later}, true, -1, true},
+		{"missing expiry", map[string]string{OverrideReplicasAnnotation: "4"}, true, -1, true},
+		{"malformed expiry", map[string]string{OverrideReplicasAnnotation: "4", OverrideExpiresAnnotation: "tomorrow"}, true, -1, true},
+		{"malformed expiry of unpaused target", map[string]string{PauseAnnotation: "false", OverrideReplicasAnnotation: "4", OverrideExpiresAnnotation: "tomorrow"}, true, -1, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := parseOverride(test.annotations, now)
+			if (err != nil) != test.invalid {
+				t.Errorf("error = %v, expected invalid %v", err, test.invalid)
+			}
+			if result.paused != test.paused {
+				t.Errorf("paused = %v, expected %v", result.paused, test.paused)
+			}
+			switch {
+			case test.replicas < 0 && result.replicas != nil:
+				t.Errorf("unexpected override to %d replicas", *result.replicas)
+			case test.replicas >= 0 && (result.replicas == nil || *result.replicas != test.replicas):
+				t.Errorf("override = %v, expected %d replicas", result.replicas, test.replicas)
+			}
+			// Malformed annotations must stop the autoscaler from changing the target
+			if test.invalid && !result.active() {
+				t.Errorf("malformed annotations do not deactivate autoscaling")
+			}
+		})
+	}
+}
+
+func TestOverrideString(t *testing.T) {
+	replicas := int32(3)
+	expires := time.Date(2019, 6, 1, 13, 0, 0, 0, time.UTC)
+	if s := (override{}).String(); s != "" {
+		t.Errorf("inactive override described as %q", s)
+	}
+	if s := (override{paused: true, replicas: &replicas}).String(); s != "paused" {
+		t.Errorf("paused override described as %q", s)
+	}
+	if s := (override{replicas: &replicas, expires: expires}).String(); s != "overridden to 3 replicas until 2019-06-01T13:00:00Z" {
+		t.Errorf("override described as %q", s)
+	}
+}
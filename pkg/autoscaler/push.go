@@ -0,0 +1,93 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/algorithm"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/metrics"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"time"
+)
+
+// Push is a sample pushed for a rule from outside. It replaces the next fetch of the rule's metrics, a missing
+// delta is still fetched or derived if the rule's algorithm needs one.
+type Push struct {
+	Value     resource.Quantity
+	Delta     *resource.Quantity
+	Timestamp time.Time
+}
+
+// Trigger requests an immediate sample of the given rule, optionally using a pushed sample, followed by an
+// evaluation of the target. Triggers arriving while an evaluation is pending are merged into it.
+func (as *Autoscaler) Trigger(ruleKey string, push *Push) {
+	if push != nil {
+		as.pushMutex.Lock()
+		as.pushes[ruleKey] = *push
+		as.pushMutex.Unlock()
+	}
+
+	if !as.triggerSampler(ruleKey) {
+		// The rule is sampled once the evaluation of the target started its sampler
+		as.triggerEvaluation()
+	}
+}
+
+func (as *Autoscaler) triggerEvaluation() {
+	select {
+	case as.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (as *Autoscaler) takePush(rule *v1.AutoscalingRule) (Push, bool) {
+	as.pushMutex.Lock()
+	defer as.pushMutex.Unlock()
+
+	push, exists := as.pushes[ruleKey(rule)]
+	delete(as.pushes, ruleKey(rule))
+	return push, exists
+}
+
+// nextSample prefers a pushed sample over fetching the metrics of the rule.
+func (as *Autoscaler) nextSample(ctx context.Context, rule *v1.AutoscalingRule, scalingAlgorithm algorithm.ScalingAlgorithm) (algorithm.Sample, error) {
+	push, pushed := as.takePush(rule)
+	if !pushed {
+		return as.fetchSample(ctx, rule, scalingAlgorithm)
+	}
+
+	log.Debugf("Using pushed sample %v for rule %s", push.Value, rule.Name)
+	if stale(rule, push.Timestamp) {
+		staleSeriesCounter.Inc(as.staleLabels(rule)...)
+		return algorithm.Sample{}, metrics.NewError(metrics.ErrorStale, "push", fmt.Errorf("pushed sample from %v is older than %v", push.Timestamp, maxMetricAge(rule)))
+	}
+	sample := algorithm.Sample{Value: push.Value, Timestamp: push.Timestamp, Series: 1}
+	if push.Delta != nil {
+		sample.Delta = *push.Delta
+		sample.HasDelta = true
+		return sample, nil
+	}
+
+	if _, deltaMetric := scalingAlgorithm.Metrics(rule); deltaMetric != "" {
+		delta, err := as.fetchMetric(ctx, rule, deltaMetric, true)
+		if err != nil {
+			return sample, err
+		}
+		sample.Delta = delta.value
+		sample.HasDelta = true
+	}
+	return sample, nil
+}
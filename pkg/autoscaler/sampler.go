@@ -0,0 +1,239 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package autoscaler
+
+import (
+	"context"
+	log "github.com/Sirupsen/logrus"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/algorithm"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/metrics"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"time"
+)
+
+// sampler evaluates a single rule on the rule's own schedule. The proposals are combined by the decision loop
+// of the target.
+type sampler struct {
+	namespace string
+	name      string
+	interval  time.Duration
+	trigger   chan struct{}
+	stopChan  chan struct{}
+}
+
+// ruleInterval is the sampling interval of the rule, rules without one are sampled at the check interval.
+func (as *Autoscaler) ruleInterval(rule *v1.AutoscalingRule) time.Duration {
+	if rule.Spec.Interval != nil && rule.Spec.Interval.Duration > 0 {
+		return rule.Spec.Interval.Duration
+	}
+	return as.interval
+}
+
+// maxProposalAge is the age after which a proposal of a rule sampled at the given interval is ignored.
+func (as *Autoscaler) maxProposalAge(interval time.Duration) time.Duration {
+	if as.proposalAge > 0 {
+		return as.proposalAge
+	}
+	return 3 * interval
+}
+
+// reconcileSamplers starts a sampler for every rule of the target and stops the samplers of rules that were deleted
+// or no longer apply. Samplers of rules with a changed interval are restarted, their evaluation state is kept.
+func (as *Autoscaler) reconcileSamplers(rules []*v1.AutoscalingRule) {
+	as.samplersMutex.Lock()
+	defer as.samplersMutex.Unlock()
+
+	current := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		key := ruleKey(rule)
+		current[key] = true
+
+		interval := as.ruleInterval(rule)
+		if s, running := as.samplers[key]; running {
+			if s.interval == interval {
+				continue
+			}
+			log.Infof("Sampling interval of rule %s changed from %v to %v", rule.Name, s.interval, interval)
+			close(s.stopChan)
+		}
+
+		s := &sampler{namespace: rule.Namespace, name: rule.Name, interval: interval, trigger: make(chan struct{}, 1), stopChan: make(chan struct{})}
+		as.samplers[key] = s
+		go as.runSampler(s)
+	}
+
+	for key, s := range as.samplers {
+		if !current[key] {
+			close(s.stopChan)
+			delete(as.samplers, key)
+		}
+	}
+
+	// Forget the state of rules that were deleted or no longer apply
+	as.evaluationsMutex.Lock()
+	defer as.evaluationsMutex.Unlock()
+	for key := range as.metricEvaluations {
+		if !current[key] {
+			delete(as.metricEvaluations, key)
+		}
+	}
+	for key := range as.failures {
+		if !current[key] {
+			delete(as.failures, key)
+		}
+	}
+}
+
+func (as *Autoscaler) stopSamplers() {
+	as.samplersMutex.Lock()
+	defer as.samplersMutex.Unlock()
+
+	for key, s := range as.samplers {
+		close(s.stopChan)
+		delete(as.samplers, key)
+	}
+}
+
+// triggerSampler requests an immediate sample of the rule and reports whether the rule has a sampler.
+func (as *Autoscaler) triggerSampler(ruleKey string) bool {
+	as.samplersMutex.Lock()
+	defer as.samplersMutex.Unlock()
+
+	s, running := as.samplers[ruleKey]
+	if !running {
+		return false
+	}
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// runSampler samples the rule right away and then at its interval. A triggered sample is followed by a triggered
+// evaluation of the target.
+func (as *Autoscaler) runSampler(s *sampler) {
+	log.Debugf("Sampling rule %s/%s every %v", s.namespace, s.name, s.interval)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	triggered := false
+	for {
+		as.sampleRule(s)
+		if triggered {
+			as.triggerEvaluation()
+		}
+
+		select {
+		case <-s.stopChan:
+			log.Debugf("Stopped sampling rule %s/%s", s.namespace, s.name)
+			return
+		case <-ticker.C:
+			triggered = false
+		case <-s.trigger:
+			triggered = true
+		}
+	}
+}
+
+// environment returns the environment rules are evaluated in. Rules are not sampled before the replicas of the
+// target are known and while calming down after scaling.
+func (as *Autoscaler) environment() (algorithm.Environment, string, bool) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	env := algorithm.Environment{Replicas: as.currentReplicas, ReadyReplicas: as.readyReplicas, MinReplicas: as.minReplicas, MaxReplicas: as.maxReplicas, CalmdownIntervals: as.calmdownIntervals}
+	return env, as.defaultAlgorithm, as.currentReplicas >= 0 && !as.calmdown
+}
+
+// sampleRule fetches a sample of the rule's metrics and lets its scaling algorithm propose a replica count.
+func (as *Autoscaler) sampleRule(s *sampler) {
+	env, defaultAlgorithm, ready := as.environment()
+	if !ready {
+		return
+	}
+
+	rule, err := as.rules.AutoscalingRules(s.namespace).Get(s.name)
+	if err != nil {
+		log.Errorf("Could not get rule %s/%s: %v", s.namespace, s.name, err)
+		return
+	}
+	log.Debugf("Evaluating rule %s", rule.Name)
+
+	scalingAlgorithm, err := algorithm.ForRule(rule, defaultAlgorithm)
+	if err != nil {
+		log.Errorf("Could not evaluate rule %s: %v", rule.Name, err)
+		return
+	}
+
+	// A sample has to be taken before the next one is due
+	ctx, cancel := context.WithTimeout(context.Background(), s.interval)
+	defer cancel()
+
+	sample, err := as.nextSample(ctx, rule, scalingAlgorithm)
+	if metrics.IsStale(err) {
+		as.handleStale(rule, env, err)
+		return
+	} else if err != nil {
+		log.Errorf("Could not retrieve metrics for rule %s: %v", rule.Name, err)
+		as.recordFailure(rule, err)
+		return
+	}
+	metricStaleGauge.Set(0, as.staleLabels(rule)...)
+
+	as.evaluationsMutex.Lock()
+	defer as.evaluationsMutex.Unlock()
+
+	select {
+	case <-s.stopChan:
+		// The rule was removed from the target meanwhile
+		return
+	default:
+	}
+	as.recordSuccess(rule)
+
+	metricEvaluation, initialized := as.metricEvaluations[ruleKey(rule)]
+	if !initialized || metricEvaluation.Algorithm != scalingAlgorithm.Name() {
+		log.Debugf("Initializing new MetricEvaluation Object for rule %s", rule.Name)
+		metricEvaluation = scalingAlgorithm.InitState(rule, algorithm.Normalize(rule, sample, env), env)
+		as.metricEvaluations[ruleKey(rule)] = metricEvaluation
+	}
+
+	as.observe(rule, scalingAlgorithm, metricEvaluation, sample, env, s.interval)
+	scalingAlgorithm.ProposeReplicas(rule, metricEvaluation, env)
+	metricEvaluation.ProposedAt = time.Now()
+	metricEvaluation.Series = sample.Series
+	metricEvaluation.Aggregation = describeAggregation(rule)
+}
+
+// observe hands the sample to the rule's algorithm unless it is anomalous. Deltas are derived and anomalies detected
+// before the sample is normalized, so a change of the replicas is not mistaken for a change of the metric.
+func (as *Autoscaler) observe(rule *v1.AutoscalingRule, scalingAlgorithm algorithm.ScalingAlgorithm, metricEvaluation *util.MetricEvaluation, sample algorithm.Sample, env algorithm.Environment, interval time.Duration) {
+	if scalingAlgorithm.UsesDelta() && !sample.HasDelta {
+		sample.Delta = deriveDelta(rule, metricEvaluation, sample, interval)
+		log.Debugf("Derived Delta: %v", sample.Delta)
+	}
+
+	if as.checkAnomaly(rule, scalingAlgorithm, metricEvaluation, &sample) {
+		scalingAlgorithm.Observe(rule, metricEvaluation, algorithm.Normalize(rule, sample, env), env)
+	}
+}
+
+// describeAggregation names the aggregation of the rule's value metric and, if different, of its delta metric.
+func describeAggregation(rule *v1.AutoscalingRule) string {
+	value := metrics.Query{Rule: rule}.Aggregation()
+	if delta := (metrics.Query{Rule: rule, Delta: true}).Aggregation(); delta != value {
+		return value + "/" + delta
+	}
+	return value
+}
@@ -0,0 +1,194 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package autoscaler
+
+import (
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/algorithm"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// recordingAlgorithm observes the delta and records the samples it is handed.
+type recordingAlgorithm struct {
+	observed []algorithm.Sample
+}
+
+func (*recordingAlgorithm) Name() string {
+	return "recording"
+}
+
+func (*recordingAlgorithm) Metrics(rule *v1.AutoscalingRule) (string, string) {
+	return "queue_length", ""
+}
+
+func (*recordingAlgorithm) UsesDelta() bool {
+	return true
+}
+
+func (*recordingAlgorithm) InitState(rule *v1.AutoscalingRule, sample algorithm.Sample, env algorithm.Environment) *util.MetricEvaluation {
+	return util.NewMetricEvaluation("recording", float64(env.Replicas))
+}
+
+func (r *recordingAlgorithm) Observe(rule *v1.AutoscalingRule, state *util.MetricEvaluation, sample algorithm.Sample, env algorithm.Environment) {
+	r.observed = append(r.observed, sample)
+}
+
+func (*recordingAlgorithm) ProposeReplicas(rule *v1.AutoscalingRule, state *util.MetricEvaluation, env algorithm.Environment) float64 {
+	return float64(env.Replicas)
+}
+
+func TestObserveDerivesDeltaBeforeNormalizing(t *testing.T) {
+	rule := &v1.AutoscalingRule{Spec: v1.AutoscalingRuleSpec{TargetType: algorithm.TargetTypeAverageValue}}
+	rule.Name = "queue"
+	recorder := &recordingAlgorithm{}
+	state := util.NewMetricEvaluation("recording", 2)
+	as := &Autoscaler{}
+
+	// The total load stays the same while the target is scaled from 2 to 4 replicas
+	replicas := []int32{2, 2, 2, 4, 4}
+	for i, n := range replicas {
+		env := algorithm.Environment{Replicas: n, ReadyReplicas: n, MinReplicas: 1, MaxReplicas: 10}
+		sample := algorithm.Sample{
+			Value:     *resource.NewMilliQuantity(20000, resource.DecimalSI),
+			Timestamp: deltaEpoch.Add(time.Duration(i) * 10 * time.Second),
+		}
+		as.observe(rule, recorder, state, sample, env, 10*time.Second)
+	}
+
+	var values, deltas []int64
+	for _, sample := range recorder.observed {
+		values = append(values, sample.Value.MilliValue())
+		deltas = append(deltas, sample.Delta.MilliValue())
+	}
+	if expected := []int64{10000, 10000, 10000, 5000, 5000}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("observed values %v, expected %v per replica", values, expected)
+	}
+	if expected := []int64{0, 0, 0, 0, 0}; !reflect.DeepEqual(deltas, expected) {
+		t.Errorf("observed deltas %v, scaling the target must not change the delta", deltas)
+	}
+	if state.Anomaly.Anomalies != 0 {
+		t.Errorf("scaling the target was detected as %d anomalies", state.Anomaly.Anomalies)
+	}
+}
+
+func TestObserveNormalizesDelta(t *testing.T) {
+	rule := &v1.AutoscalingRule{Spec: v1.AutoscalingRuleSpec{TargetType: algorithm.TargetTypeAverageValue}}
+	recorder := &recordingAlgorithm{}
+	state := util.NewMetricEvaluation("recording", 4)
+	env := algorithm.Environment{Replicas: 4, ReadyReplicas: 4, MinReplicas: 1, MaxReplicas: 10}
+
+	for i, value := range []int64{40000, 60000} {
+		sample := algorithm.Sample{
+			Value:     *resource.NewMilliQuantity(value, resource.DecimalSI),
+			Timestamp: deltaEpoch.Add(time.Duration(i) * 10 * time.Second),
+		}
+		(&Autoscaler{}).observe(rule, recorder, state, sample, env, 10*time.Second)
+	}
+
+	// The total grew by 20 within the interval, that is 5 per replica
+	last := recorder.observed[len(recorder.observed)-1]
+	if last.Value.MilliValue() != 15000 || last.Delta.MilliValue() != 5000 {
+		t.Errorf("observed value %v and delta %v, expected 15 and 5 per replica", &last.Value, &last.Delta)
+	}
+}
+
+// intervalRule returns a rule of the given priority sampled at the given interval, zero for the check interval.
+func intervalRule(name string, priority int32, interval time.Duration) *v1.AutoscalingRule {
+	rule := &v1.AutoscalingRule{Spec: v1.AutoscalingRuleSpec{Priority: priority}}
+	rule.Namespace, rule.Name = "shop", name
+	if interval > 0 {
+		rule.Spec.Interval = &metav1.Duration{Duration: interval}
+	}
+	return rule
+}
+
+func TestCombineProposalsByAge(t *testing.T) {
+	fast := intervalRule("fast", 1, 10*time.Second)
+	slow := intervalRule("slow", 1, time.Minute)
+	regular := intervalRule("regular", 3, 0)
+	unsampled := intervalRule("unsampled", 5, 0)
+	rules := []*v1.AutoscalingRule{fast, slow, regular, unsampled}
+
+	now := time.Now()
+	proposed := func(replicas float64, age time.Duration) *util.MetricEvaluation {
+		evaluation := util.NewMetricEvaluation("threshold", replicas)
+		evaluation.ProposedAt = now.Add(-age)
+		return evaluation
+	}
+
+	tests := []struct {
+		name        string
+		proposalAge time.Duration
+		ages        map[string]time.Duration
+		replicas    int32
+		proposed    []string
+	}{
+		// Proposals expire after three intervals of their rule
+		{"all recent", 0, map[string]time.Duration{"fast": 5 * time.Second, "slow": 5 * time.Second, "regular": 5 * time.Second}, 5, []string{"fast", "slow", "regular"}},
+		{"fast rule aged", 0, map[string]time.Duration{"fast": 40 * time.Second, "slow": 40 * time.Second, "regular": 40 * time.Second}, 6, []string{"slow", "regular"}},
+		{"regular rule aged", 0, map[string]time.Duration{"fast": 5 * time.Second, "slow": 5 * time.Second, "regular": 100 * time.Second}, 3, []string{"fast", "slow"}},
+		{"maximum proposal age", 20 * time.Second, map[string]time.Duration{"fast": 15 * time.Second, "slow": 40 * time.Second, "regular": 15 * time.Second}, 6, []string{"fast", "regular"}},
+		{"all aged", 0, map[string]time.Duration{"fast": time.Minute, "slow": 5 * time.Minute, "regular": 5 * time.Minute}, 4, nil},
+	}
+	for _, test := range tests {
+		as := &Autoscaler{interval: 30 * time.Second, proposalAge: test.proposalAge, metricEvaluations: map[string]*util.MetricEvaluation{
+			ruleKey(fast):    proposed(2, test.ages["fast"]),
+			ruleKey(slow):    proposed(4, test.ages["slow"]),
+			ruleKey(regular): proposed(7, test.ages["regular"]),
+		}}
+
+		replicas, proposals := as.combineProposals(rules, 4)
+		var names []string
+		for _, p := range proposals {
+			names = append(names, p.rule.Name)
+		}
+		if replicas != test.replicas || !reflect.DeepEqual(names, test.proposed) {
+			t.Errorf("%s: got %d replicas proposed by %v, expected %d by %v", test.name, replicas, names, test.replicas, test.proposed)
+		}
+	}
+}
+
+func TestReconcileSamplers(t *testing.T) {
+	// The replicas of the target are not known, so the samplers do not sample
+	as := &Autoscaler{interval: 30 * time.Second, currentReplicas: -1, samplers: make(map[string]*sampler), failures: make(map[string]failure),
+		metricEvaluations: make(map[string]*util.MetricEvaluation)}
+	defer as.stopSamplers()
+
+	queue, cpu := intervalRule("queue", 1, 10*time.Second), intervalRule("cpu", 1, 0)
+	as.reconcileSamplers([]*v1.AutoscalingRule{queue, cpu})
+	if len(as.samplers) != 2 || as.samplers[ruleKey(queue)].interval != 10*time.Second || as.samplers[ruleKey(cpu)].interval != 30*time.Second {
+		t.Fatalf("got samplers %v", as.samplers)
+	}
+	as.metricEvaluations[ruleKey(queue)] = util.NewMetricEvaluation("threshold", 3)
+	as.metricEvaluations[ruleKey(cpu)] = util.NewMetricEvaluation("threshold", 3)
+
+	// A changed interval restarts the sampler of the rule and keeps its evaluation, removed rules are forgotten
+	previous := as.samplers[ruleKey(queue)]
+	queue = intervalRule("queue", 1, 20*time.Second)
+	as.reconcileSamplers([]*v1.AutoscalingRule{queue})
+	if s := as.samplers[ruleKey(queue)]; len(as.samplers) != 1 || s == previous || s.interval != 20*time.Second {
+		t.Errorf("got samplers %v after the interval changed", as.samplers)
+	}
+	select {
+	case <-previous.stopChan:
+	default:
+		t.Error("the sampler of the previous interval was not stopped")
+	}
+	if _, kept := as.metricEvaluations[ruleKey(queue)]; !kept || len(as.metricEvaluations) != 1 {
+		t.Errorf("got evaluations %v, expected the one of the remaining rule", as.metricEvaluations)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package autoscaler
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/algorithm"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/metrics"
+	"time"
+)
+
+const (
+	// StalenessHold keeps the last proposal of the rule until it expires
+	StalenessHold = "hold"
+	// StalenessDecay halves the violation counts of the rule for every stale sample
+	StalenessDecay = "decay"
+	// StalenessFailsafe resets the violation counts and proposes the current replicas
+	StalenessFailsafe = "failsafe"
+)
+
+func maxMetricAge(rule *v1.AutoscalingRule) time.Duration {
+	if rule.Spec.MaxMetricAge == nil {
+		return 0
+	}
+	return rule.Spec.MaxMetricAge.Duration
+}
+
+func (as *Autoscaler) staleLabels(rule *v1.AutoscalingRule) []string {
+	return []string{as.target.Kind, as.target.Namespace, as.target.Name, ruleKey(rule)}
+}
+
+// stale reports whether a sample taken at the given time is older than the maximum metric age of the rule. Samples
+// without timestamp are never stale.
+func stale(rule *v1.AutoscalingRule, timestamp time.Time) bool {
+	maxAge := maxMetricAge(rule)
+	return maxAge > 0 && !timestamp.IsZero() && time.Since(timestamp) > maxAge
+}
+
+// dropStale removes the stale series of a metric, an error is returned if all series are stale.
+func (as *Autoscaler) dropStale(rule *v1.AutoscalingRule, samples []metrics.Sample) ([]metrics.Sample, error) {
+	fresh := make([]metrics.Sample, 0, len(samples))
+	for _, sample := range samples {
+		if !stale(rule, sample.Timestamp) {
+			fresh = append(fresh, sample)
+		}
+	}
+
+	dropped := len(samples) - len(fresh)
+	if dropped == 0 {
+		return samples, nil
+	}
+	staleSeriesCounter.Add(float64(dropped), as.staleLabels(rule)...)
+	log.Debugf("Dropped %d of %d series of rule %s older than %v", dropped, len(samples), rule.Name, maxMetricAge(rule))
+	if len(fresh) == 0 {
+		return nil, fmt.Errorf("all %d series are older than %v", len(samples), maxMetricAge(rule))
+	}
+	return fresh, nil
+}
+
+// handleStale lets the rule react to a sample that was unavailable because all series were stale.
+func (as *Autoscaler) handleStale(rule *v1.AutoscalingRule, env algorithm.Environment, err error) {
+	metricStaleGauge.Set(1, as.staleLabels(rule)...)
+
+	policy := rule.Spec.StalenessPolicy
+	if policy == "" {
+		policy = StalenessHold
+	}
+	log.Warnf("Stale metrics for rule %s, applying staleness policy %s: %v", rule.Name, policy, err)
+
+	as.evaluationsMutex.Lock()
+	defer as.evaluationsMutex.Unlock()
+
+	metricEvaluation, initialized := as.metricEvaluations[ruleKey(rule)]
+	if !initialized {
+		return
+	}
+	switch policy {
+	case StalenessDecay:
+		for i := range metricEvaluation.ViolationCount {
+			metricEvaluation.ViolationCount[i] *= 0.5
+		}
+	case StalenessFailsafe:
+		metricEvaluation.ViolationCount = make([]float64, 1, 5)
+		metricEvaluation.Replicas = float64(env.Replicas)
+		metricEvaluation.ProposedAt = time.Now()
+	case StalenessHold:
+	default:
+		log.Warnf("Unsupported staleness policy %s of rule %s", policy, rule.Name)
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package autoscaler
+
+import (
+	"errors"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/algorithm"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/metrics"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func staleRule(policy string) *v1.AutoscalingRule {
+	rule := &v1.AutoscalingRule{Spec: v1.AutoscalingRuleSpec{MaxMetricAge: &metav1.Duration{Duration: time.Minute}, StalenessPolicy: policy}}
+	rule.Namespace, rule.Name = "shop", "queue"
+	return rule
+}
+
+func TestDropStale(t *testing.T) {
+	as := &Autoscaler{target: config.ResolvedTarget{Target: util.Target{Kind: "Deployment", Namespace: "shop", Name: "web"}}}
+	now := time.Now()
+	fresh := metrics.Sample{Timestamp: now.Add(-30 * time.Second), Labels: map[string]string{"name": "fresh"}}
+	old := metrics.Sample{Timestamp: now.Add(-2 * time.Minute), Labels: map[string]string{"name": "old"}}
+	unknown := metrics.Sample{Labels: map[string]string{"name": "unknown"}}
+
+	samples, err := as.dropStale(staleRule(""), []metrics.Sample{fresh, old, unknown})
+	if err != nil || !reflect.DeepEqual(samples, []metrics.Sample{fresh, unknown}) {
+		t.Errorf("got %v, %v, expected the series without timestamp and the fresh one", samples, err)
+	}
+	if _, err := as.dropStale(staleRule(""), []metrics.Sample{old}); err == nil {
+		t.Error("expected an error if all series are stale")
+	}
+
+	withoutMaxAge := staleRule("")
+	withoutMaxAge.Spec.MaxMetricAge = nil
+	if samples, err := as.dropStale(withoutMaxAge, []metrics.Sample{old}); err != nil || len(samples) != 1 {
+		t.Errorf("series of a rule without maximum age dropped: %v, %v", samples, err)
+	}
+}
+
+func TestStalenessPolicies(t *testing.T) {
+	proposedAt := time.Now().Add(-time.Minute)
+	tests := []struct {
+		policy     string
+		violations []float64
+		replicas   float64
+		reproposed bool
+	}{
+		{"", []float64{4, 2}, 7, false},
+		{StalenessHold, []float64{4, 2}, 7, false},
+		{StalenessDecay, []float64{2, 1}, 7, false},
+		{StalenessFailsafe, []float64{0}, 3, true},
+	}
+	for _, test := range tests {
+		rule := staleRule(test.policy)
+		evaluation := util.NewMetricEvaluation("threshold", 7)
+		evaluation.ViolationCount = []float64{4, 2}
+		evaluation.ProposedAt = proposedAt
+		as := &Autoscaler{
+			target:            config.ResolvedTarget{Target: util.Target{Kind: "Deployment", Namespace: "shop", Name: "web"}},
+			metricEvaluations: map[string]*util.MetricEvaluation{ruleKey(rule): evaluation},
+		}
+
+		as.handleStale(rule, algorithm.Environment{Replicas: 3, ReadyReplicas: 3}, errors.New("all 1 series are stale"))
+		if !reflect.DeepEqual(evaluation.ViolationCount, test.violations) || evaluation.Replicas != test.replicas {
+			t.Errorf("policy %q: got violations %v and %v replicas, expected %v and %v", test.policy,
+				evaluation.ViolationCount, evaluation.Replicas, test.violations, test.replicas)
+		}
+		if reproposed := evaluation.ProposedAt.After(proposedAt); reproposed != test.reproposed {
+			t.Errorf("policy %q: proposal renewed %v, expected %v", test.policy, reproposed, test.reproposed)
+		}
+	}
+
+	// Rules that were never evaluated have nothing to hold, decay or reset
+	as := &Autoscaler{metricEvaluations: make(map[string]*util.MetricEvaluation)}
+	as.handleStale(staleRule(StalenessFailsafe), algorithm.Environment{Replicas: 3}, errors.New("stale"))
+	if len(as.metricEvaluations) != 0 {
+		t.Errorf("stale metrics of a new rule created evaluations %v", as.metricEvaluations)
+	}
+}
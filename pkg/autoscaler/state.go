@@ -0,0 +1,58 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package autoscaler
+
+import (
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+)
+
+// State is the evaluation state of an autoscaler. It is handed over when another controller replica takes over
+// the target.
+type State struct {
+	Evaluations map[string]*util.MetricEvaluation `json:"evaluations"`
+	// RemainingCalmdownIntervals is set while calming down after scaling
+	RemainingCalmdownIntervals int64 `json:"remainingCalmdownIntervals,omitempty"`
+}
+
+// State returns a copy of the current evaluation state, it is meant to be called after the autoscaler was stopped.
+// Samplers still running may update the evaluations while the copy is encoded.
+func (as *Autoscaler) State() State {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	as.evaluationsMutex.Lock()
+	defer as.evaluationsMutex.Unlock()
+
+	state := State{Evaluations: make(map[string]*util.MetricEvaluation, len(as.metricEvaluations))}
+	for key, evaluation := range as.metricEvaluations {
+		state.Evaluations[key] = evaluation.Copy()
+	}
+	if as.calmdown {
+		state.RemainingCalmdownIntervals = as.remainingCalmdownIntervals
+	}
+	return state
+}
+
+// Restore continues from the state of a previous autoscaler of the target, it has to be called before Run.
+func (as *Autoscaler) Restore(state State) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	as.evaluationsMutex.Lock()
+	defer as.evaluationsMutex.Unlock()
+
+	if state.Evaluations != nil {
+		as.metricEvaluations = state.Evaluations
+	}
+	if state.RemainingCalmdownIntervals > 0 {
+		as.calmdown = true
+		as.remainingCalmdownIntervals = state.RemainingCalmdownIntervals
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package autoscaler
+
+import (
+	"encoding/json"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStateIsACopy(t *testing.T) {
+	evaluation := util.NewMetricEvaluation("threshold", 3)
+	evaluation.History = []util.TimedValue{{Timestamp: time.Unix(100, 0), Value: 1}}
+	evaluation.ValueFilter.Window = []float64{1, 2}
+	evaluation.Anomaly.Window = []float64{3}
+	as := &Autoscaler{metricEvaluations: map[string]*util.MetricEvaluation{"shop/queue": evaluation}}
+	expected := *evaluation.Copy()
+
+	state := as.State()
+	copied := state.Evaluations["shop/queue"]
+	copied.Replicas = 5
+	copied.ViolationCount[0] = 2
+	copied.History[0].Value = 4
+	copied.ValueFilter.Window[0] = 4
+	copied.Anomaly.Window[0] = 4
+	state.Evaluations["shop/cpu"] = util.NewMetricEvaluation("threshold", 1)
+
+	if !reflect.DeepEqual(*as.metricEvaluations["shop/queue"], expected) || len(as.metricEvaluations) != 1 {
+		t.Errorf("changes of the state changed the evaluations of the autoscaler: %+v", as.metricEvaluations)
+	}
+}
+
+func TestStateWhileSampling(t *testing.T) {
+	as := &Autoscaler{metricEvaluations: map[string]*util.MetricEvaluation{"shop/queue": util.NewMetricEvaluation("threshold", 3)}}
+
+	// A sampler that has not noticed the stop yet keeps updating the evaluations while the state is encoded
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			as.evaluationsMutex.Lock()
+			evaluation := as.metricEvaluations["shop/queue"]
+			evaluation.History = append(evaluation.History, util.TimedValue{Value: float64(i)})
+			as.metricEvaluations["shop/cpu"] = util.NewMetricEvaluation("threshold", float64(i))
+			as.evaluationsMutex.Unlock()
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		if _, err := json.Marshal(as.State()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
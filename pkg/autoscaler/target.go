@@ -0,0 +1,130 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package autoscaler
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"time"
+)
+
+// targetState is the part of a Deployment or StatefulSet the autoscaler works with.
+type targetState struct {
+	uid             types.UID
+	resourceVersion string
+	annotations     map[string]string
+	labels          map[string]string
+	specReplicas    int32
+	replicas        int32
+	readyReplicas   int32
+}
+
+func (as *Autoscaler) getTargetState() (targetState, error) {
+	switch as.target.Kind {
+	case "Deployment":
+		deployment, err := as.kubeclientset.AppsV1().Deployments(as.target.Namespace).Get(as.target.Name, metav1.GetOptions{})
+		if err != nil {
+			return targetState{}, err
+		}
+		return targetState{deployment.UID, deployment.ResourceVersion, deployment.Annotations, deployment.Labels, *deployment.Spec.Replicas, deployment.Status.Replicas, deployment.Status.ReadyReplicas}, nil
+	case "StatefulSet":
+		statefulset, err := as.kubeclientset.AppsV1().StatefulSets(as.target.Namespace).Get(as.target.Name, metav1.GetOptions{})
+		if err != nil {
+			return targetState{}, err
+		}
+		return targetState{statefulset.UID, statefulset.ResourceVersion, statefulset.Annotations, statefulset.Labels, *statefulset.Spec.Replicas, statefulset.Status.Replicas, statefulset.Status.ReadyReplicas}, nil
+	default:
+		return targetState{}, fmt.Errorf("unsupported target kind %s", as.target.Kind)
+	}
+}
+
+// updateScale sets the replicas through the scale subresource. The request only succeeds if the target was not
+// modified since the given resource version was read, otherwise a conflict is returned.
+func (as *Autoscaler) updateScale(resourceVersion string, replicas int32) error {
+	scale := &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: as.target.Name, Namespace: as.target.Namespace, ResourceVersion: resourceVersion},
+		Spec:       autoscalingv1.ScaleSpec{Replicas: replicas},
+	}
+
+	var err error
+	switch as.target.Kind {
+	case "Deployment":
+		_, err = as.kubeclientset.AppsV1().Deployments(as.target.Namespace).UpdateScale(as.target.Name, scale)
+	case "StatefulSet":
+		_, err = as.kubeclientset.AppsV1().StatefulSets(as.target.Namespace).UpdateScale(as.target.Name, scale)
+	default:
+		err = fmt.Errorf("unsupported target kind %s", as.target.Kind)
+	}
+	return err
+}
+
+// outdatedDecision is returned if the target changed in a way that invalidates a scaling decision.
+type outdatedDecision struct {
+	reason string
+}
+
+func (o outdatedDecision) Error() string {
+	return "scaling decision outdated: " + o.reason
+}
+
+// revalidate checks whether a decision made on the basis of one state still holds for a fresh state of the target.
+func revalidate(basis targetState, fresh targetState, replicas int32, pinned bool) error {
+	freshOverride, _ := parseOverride(fresh.annotations, time.Now())
+	if freshOverride.active() && !(pinned && freshOverride.replicas != nil && *freshOverride.replicas == replicas) {
+		return outdatedDecision{fmt.Sprintf("target is %s now", freshOverride)}
+	}
+	if fresh.specReplicas != basis.specReplicas {
+		return outdatedDecision{fmt.Sprintf("replicas were changed from %d to %d meanwhile", basis.specReplicas, fresh.specReplicas)}
+	}
+	return nil
+}
+
+// scale applies the replicas decided on the basis of the given state. If the target was modified concurrently,
+// the decision is re-validated against the fresh state and retried. pinned marks replicas requested by an override.
+func (as *Autoscaler) scale(basis targetState, replicas int32, pinned bool) error {
+	current := basis
+	attempt := 0
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if attempt > 0 {
+			fresh, err := as.getTargetState()
+			if err != nil {
+				return err
+			}
+			if err := revalidate(basis, fresh, replicas, pinned); err != nil {
+				return err
+			}
+			log.Debugf("Conflict while scaling %s %s/%s, retrying (attempt %d)", as.target.Kind, as.target.Namespace, as.target.Name, attempt+1)
+			current = fresh
+		}
+		attempt++
+		return as.updateScale(current.resourceVersion, replicas)
+	})
+
+	if errors.IsConflict(err) {
+		scalingConflictsCounter.Inc(as.target.Kind, as.target.Namespace, as.target.Name)
+		as.recorder.Eventf(as.reference(basis.uid), corev1.EventTypeWarning, "ScalingConflict",
+			"Could not scale to %d replicas after %d attempts, the target is modified concurrently", replicas, attempt)
+	}
+	return err
+}
+
+func (as *Autoscaler) reference(uid types.UID) corev1.ObjectReference {
+	return corev1.ObjectReference{APIVersion: "apps/v1", Kind: as.target.Kind, Namespace: as.target.Namespace, Name: as.target.Name, UID: uid}
+}
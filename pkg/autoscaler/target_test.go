@@ -0,0 +1,147 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package autoscaler
+
+import (
+	"encoding/json"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/events"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// deploymentServer serves the deployment shop/web and its scale like the API server, scale updates with an outdated
+// resourceVersion are rejected as conflict. Before each of the next conflicts updates the deployment is modified
+// concurrently by modify. Events are passed to the event server.
+type deploymentServer struct {
+	mutex      sync.Mutex
+	deployment appsv1.Deployment
+	conflicts  int
+	modify     func(deployment *appsv1.Deployment)
+	updates    int
+	events     *eventServer
+}
+
+func (s *deploymentServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const path = "/apis/apps/v1/namespaces/shop/deployments/web"
+	if r.URL.Path != path && r.URL.Path != path+"/scale" {
+		s.events.ServeHTTP(w, r)
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var response interface{} = &s.deployment
+	if r.Method == http.MethodPut {
+		var scale autoscalingv1.Scale
+		if err := json.NewDecoder(r.Body).Decode(&scale); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.updates++
+		if s.conflicts > 0 {
+			s.conflicts--
+			if s.modify != nil {
+				s.modify(&s.deployment)
+			}
+			s.save()
+		}
+		if scale.ResourceVersion != s.deployment.ResourceVersion {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(&metav1.Status{TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}, Status: metav1.StatusFailure,
+				Code: http.StatusConflict, Reason: metav1.StatusReasonConflict, Details: &metav1.StatusDetails{Kind: "deployments"}})
+			return
+		}
+		s.deployment.Spec.Replicas = &scale.Spec.Replicas
+		s.save()
+		scale.ResourceVersion = s.deployment.ResourceVersion
+		response = &scale
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// save stores a modification of the deployment by increasing its resourceVersion.
+func (s *deploymentServer) save() {
+	version, _ := strconv.Atoi(s.deployment.ResourceVersion)
+	s.deployment.ResourceVersion = strconv.Itoa(version + 1)
+}
+
+func TestScaleRetriesConflicts(t *testing.T) {
+	expires := time.Now().Add(time.Hour).Format(time.RFC3339)
+	annotate := func(annotations map[string]string) func(*appsv1.Deployment) {
+		return func(deployment *appsv1.Deployment) {
+			deployment.Annotations = annotations
+		}
+	}
+
+	tests := []struct {
+		name      string
+		conflicts int
+		modify    func(deployment *appsv1.Deployment)
+		pinned    bool
+		replicas  int32
+		updates   int
+		outdated  bool
+		conflict  bool
+		reasons   []string
+	}{
+		{"conflict once", 1, nil, false, 5, 2, false, false, nil},
+		{"replicas changed meanwhile", 1, func(deployment *appsv1.Deployment) {
+			replicas := int32(3)
+			deployment.Spec.Replicas = &replicas
+		}, false, 3, 1, true, false, nil},
+		{"paused meanwhile", 1, annotate(map[string]string{PauseAnnotation: "true"}), false, 2, 1, true, false, nil},
+		{"overridden meanwhile", 1, annotate(map[string]string{OverrideReplicasAnnotation: "4", OverrideExpiresAnnotation: expires}),
+			false, 2, 1, true, false, nil},
+		{"pinned by the override meanwhile", 1, annotate(map[string]string{OverrideReplicasAnnotation: "5", OverrideExpiresAnnotation: expires}),
+			true, 5, 2, false, false, nil},
+		{"conflicts persist", 10, nil, false, 2, 5, false, true, []string{"ScalingConflict"}},
+	}
+	for _, test := range tests {
+		server := testDeployment(2)
+		server.conflicts, server.modify = test.conflicts, test.modify
+		clientset := newClientset(t, server)
+		as := &Autoscaler{
+			kubeclientset: clientset,
+			target:        config.ResolvedTarget{Target: util.Target{Kind: "Deployment", Namespace: "shop", Name: "web"}},
+			recorder:      events.NewRecorder(clientset),
+		}
+
+		basis, err := as.getTargetState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = as.scale(basis, 5, test.pinned)
+		_, outdated := err.(outdatedDecision)
+		if outdated != test.outdated || errors.IsConflict(err) != test.conflict || (err == nil) != (!test.outdated && !test.conflict) {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if *server.deployment.Spec.Replicas != test.replicas || server.updates != test.updates {
+			t.Errorf("%s: got %d replicas after %d updates, expected %d replicas after %d updates", test.name,
+				*server.deployment.Spec.Replicas, server.updates, test.replicas, test.updates)
+		}
+		if reasons := server.events.recorded(); !reflect.DeepEqual(reasons, test.reasons) {
+			t.Errorf("%s: recorded events %v, expected %v", test.name, reasons, test.reasons)
+		}
+	}
+}
@@ -39,6 +39,7 @@ type AutoscalingRulesGetter interface {
 type AutoscalingRuleInterface interface {
 	Create(*v1.AutoscalingRule) (*v1.AutoscalingRule, error)
 	Update(*v1.AutoscalingRule) (*v1.AutoscalingRule, error)
+	UpdateStatus(*v1.AutoscalingRule) (*v1.AutoscalingRule, error)
 	Delete(name string, options *metav1.DeleteOptions) error
 	DeleteCollection(options *metav1.DeleteOptions, listOptions metav1.ListOptions) error
 	Get(name string, options metav1.GetOptions) (*v1.AutoscalingRule, error)
@@ -132,6 +133,22 @@ func (c *autoscalingRules) Update(autoscalingRule *v1.AutoscalingRule) (result *
 	return
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+
+func (c *autoscalingRules) UpdateStatus(autoscalingRule *v1.AutoscalingRule) (result *v1.AutoscalingRule, err error) {
+	result = &v1.AutoscalingRule{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("autoscalingrules").
+		Name(autoscalingRule.Name).
+		SubResource("status").
+		Body(autoscalingRule).
+		Do().
+		Into(result)
+	return
+}
+
 // Delete takes name of the autoscalingRule and deletes it. Returns an error if one occurs.
 func (c *autoscalingRules) Delete(name string, options *metav1.DeleteOptions) error {
 	return c.client.Delete().
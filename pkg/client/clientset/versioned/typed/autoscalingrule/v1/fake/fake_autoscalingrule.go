@@ -100,6 +100,18 @@ func (c *FakeAutoscalingRules) Update(autoscalingRule *autoscalingrulev1.Autosca
 	return obj.(*autoscalingrulev1.AutoscalingRule), err
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeAutoscalingRules) UpdateStatus(autoscalingRule *autoscalingrulev1.AutoscalingRule) (*autoscalingrulev1.AutoscalingRule, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(autoscalingrulesResource, "status", c.ns, autoscalingRule), &autoscalingrulev1.AutoscalingRule{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*autoscalingrulev1.AutoscalingRule), err
+}
+
 // Delete takes name of the autoscalingRule and deletes it. Returns an error if one occurs.
 func (c *FakeAutoscalingRules) Delete(name string, options *v1.DeleteOptions) error {
 	_, err := c.Fake.
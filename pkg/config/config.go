@@ -0,0 +1,550 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package config
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"net"
+	"net/url"
+	"path"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+const (
+	APIVersion = "bsinfo.hhu.de/v1"
+	Kind       = "ControllerConfig"
+)
+
+type Config struct {
+	APIVersion     string          `json:"apiVersion"`
+	Kind           string          `json:"kind"`
+	RulesNamespace string          `json:"rulesNamespace"`
+	Defaults       Settings        `json:"defaults"`
+	Targets        []TargetConfig  `json:"targets"`
+	Metrics        MetricsConfig   `json:"metrics"`
+	Logging        LoggingConfig   `json:"logging"`
+	Server         ServerConfig    `json:"server"`
+	Webhook        WebhookConfig   `json:"webhook"`
+	Sharding       ShardingConfig  `json:"sharding"`
+	Policy         PolicyConfig    `json:"policy"`
+	Admission      AdmissionConfig `json:"admission"`
+	Ingest         IngestConfig    `json:"ingest"`
+}
+
+// Settings are the scaling parameters of a single target. UseV2 selects the trend algorithm for rules that neither
+// name an algorithm nor make it obvious from their spec.
+type Settings struct {
+	MinReplicas   int   `json:"minReplicas"`
+	MaxReplicas   int   `json:"maxReplicas"`
+	CalmdownInts  int64 `json:"calmdownInts"`
+	CheckInterval int   `json:"checkInterval"`
+	UseV2         bool  `json:"usev2"`
+	// DryRun evaluates all rules and records the decisions, but never scales the target
+	DryRun bool `json:"dryRun"`
+	// MaxProposalAge in seconds after which the proposal of a rule is no longer considered, 0 allows three
+	// sampling intervals of the rule
+	MaxProposalAge int `json:"maxProposalAge"`
+	// FailurePolicy applies once a rule failed to fetch its metrics FailureThreshold times in a row: hold keeps the
+	// current replicas, fallback scales to FallbackReplicas and scaleUp adds a replica per evaluation
+	FailurePolicy    string `json:"failurePolicy"`
+	FailureThreshold int    `json:"failureThreshold"`
+	FallbackReplicas int    `json:"fallbackReplicas"`
+}
+
+const (
+	FailurePolicyHold     = "hold"
+	FailurePolicyFallback = "fallback"
+	FailurePolicyScaleUp  = "scaleUp"
+)
+
+// TargetConfig describes a scalable target. Every unset setting falls back to the global defaults.
+type TargetConfig struct {
+	Namespace        string   `json:"namespace"`
+	Name             string   `json:"name"`
+	Kind             string   `json:"kind"`
+	Rules            []string `json:"rules,omitempty"`
+	MinReplicas      *int     `json:"minReplicas,omitempty"`
+	MaxReplicas      *int     `json:"maxReplicas,omitempty"`
+	CalmdownInts     *int64   `json:"calmdownInts,omitempty"`
+	CheckInterval    *int     `json:"checkInterval,omitempty"`
+	UseV2            *bool    `json:"usev2,omitempty"`
+	DryRun           *bool    `json:"dryRun,omitempty"`
+	MaxProposalAge   *int     `json:"maxProposalAge,omitempty"`
+	FailurePolicy    *string  `json:"failurePolicy,omitempty"`
+	FailureThreshold *int     `json:"failureThreshold,omitempty"`
+	FallbackReplicas *int     `json:"fallbackReplicas,omitempty"`
+}
+
+type MetricsConfig struct {
+	CustomMetricsPath   string           `json:"customMetricsPath"`
+	ObjectSelector      string           `json:"objectSelector"`
+	ExternalMetricsPath string           `json:"externalMetricsPath"`
+	ResourceMetricsPath string           `json:"resourceMetricsPath"`
+	Prometheus          PrometheusConfig `json:"prometheus"`
+	Replay              ReplayConfig     `json:"replay"`
+	HTTP                HTTPConfig       `json:"http"`
+	// CacheTTL is the time in seconds fetched metrics are shared between rules, 0 only merges concurrent requests
+	CacheTTL int `json:"cacheTTL"`
+}
+
+// PrometheusConfig points the prometheus source to the HTTP API of a Prometheus server. Requests authenticate with
+// the bearer token or the basic auth credentials, if given. The timeout is given in seconds.
+type PrometheusConfig struct {
+	URL             string `json:"url"`
+	Timeout         int    `json:"timeout"`
+	BearerTokenFile string `json:"bearerTokenFile"`
+	Username        string `json:"username"`
+	PasswordFile    string `json:"passwordFile"`
+}
+
+// ReplayConfig points the replay source to recorded traces in CSV or JSONL format. The virtual clock starts at the
+// first recorded sample when the traces are loaded and runs Speed times as fast as the wall clock, optionally
+// looping the traces. The wall clock serves samples at their recorded time. Global replays the traces for all rules
+// regardless of their source.
+type ReplayConfig struct {
+	Files  []string `json:"files"`
+	Clock  string   `json:"clock"`
+	Speed  float64  `json:"speed"`
+	Loop   bool     `json:"loop"`
+	Global bool     `json:"global"`
+}
+
+// HTTPConfig holds the defaults of the http source scraping JSON documents. The timeout is given in seconds and
+// applies to rules that do not set their own. Rules may only scrape the AllowedHosts, given as host names, *.domain
+// wildcards, IPs or CIDR ranges, and the pods of their target when scraping per pod.
+type HTTPConfig struct {
+	Timeout      int      `json:"timeout"`
+	AllowedHosts []string `json:"allowedHosts"`
+}
+
+const (
+	ReplayClockVirtual = "virtual"
+	ReplayClockWall    = "wall"
+)
+
+type LoggingConfig struct {
+	Level  string `json:"level"`
+	Format string `json:"format"`
+}
+
+type ServerConfig struct {
+	Port int `json:"port"`
+}
+
+// WebhookConfig enables the endpoint receiving pushed samples and evaluation requests. Requests have to present the
+// content of the token file as bearer token.
+type WebhookConfig struct {
+	Enabled   bool   `json:"enabled"`
+	TokenFile string `json:"tokenFile"`
+}
+
+// ShardingConfig partitions the targets across the replicas of the controller. Every replica holds a Lease in the
+// given namespace, the targets are assigned to the live replicas by consistent hashing of their namespace/name.
+// Durations are given in seconds, the identity defaults to the hostname.
+type ShardingConfig struct {
+	Enabled          bool   `json:"enabled"`
+	Namespace        string `json:"namespace"`
+	Identity         string `json:"identity"`
+	LeaseDuration    int    `json:"leaseDuration"`
+	RenewInterval    int    `json:"renewInterval"`
+	HandoffConfigMap string `json:"handoffConfigMap"`
+	// HandoffTimeout is the time a new owner waits for the state of a target from its previous owner
+	HandoffTimeout int `json:"handoffTimeout"`
+}
+
+// PolicyConfig restricts which workloads the rules of a namespace may scale and which namespaces they may read
+// metrics from. Without a matching entry, rules may only affect their own namespace, if allowed at all. The policy
+// is enabled by default, rules scaling workloads in other namespaces require an allow entry.
+type PolicyConfig struct {
+	Enabled            bool          `json:"enabled"`
+	AllowSameNamespace bool          `json:"allowSameNamespace"`
+	Allow              []PolicyEntry `json:"allow"`
+}
+
+// PolicyEntry permits the rules in any of the rule namespaces to target the workloads in any of the target
+// namespaces, optionally only those matching the selector. Namespaces may be glob patterns like team-a-*.
+type PolicyEntry struct {
+	RuleNamespaces   []string              `json:"ruleNamespaces"`
+	TargetNamespaces []string              `json:"targetNamespaces"`
+	TargetSelector   *metav1.LabelSelector `json:"targetSelector,omitempty"`
+}
+
+// AdmissionConfig enables the validating admission webhook for rules, it is served via TLS on its own port.
+type AdmissionConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Port     int    `json:"port"`
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+}
+
+// IngestConfig enables the endpoint applications push samples to, served by the HTTP server at /push/<namespace>.
+// Requests have to authenticate with the bearer token or the basic auth credentials, one of them is required.
+// Pushed samples expire after TTL seconds. Namespaces restricts the namespaces samples may be pushed to, all
+// namespaces are allowed if it is empty.
+type IngestConfig struct {
+	Enabled      bool     `json:"enabled"`
+	TTL          int      `json:"ttl"`
+	TokenFile    string   `json:"tokenFile"`
+	Username     string   `json:"username"`
+	PasswordFile string   `json:"passwordFile"`
+	Namespaces   []string `json:"namespaces"`
+}
+
+// ResolvedTarget is a target with its defaults and overrides merged.
+type ResolvedTarget struct {
+	util.Target
+	Rules []string
+	Settings
+}
+
+func Default() *Config {
+	return &Config{
+		APIVersion:     APIVersion,
+		Kind:           Kind,
+		RulesNamespace: metav1.NamespaceAll,
+		Defaults: Settings{
+			MinReplicas:      1,
+			MaxReplicas:      10,
+			CalmdownInts:     3,
+			CheckInterval:    5,
+			UseV2:            true,
+			FailurePolicy:    FailurePolicyHold,
+			FailureThreshold: 3,
+		},
+		Metrics: MetricsConfig{
+			CustomMetricsPath:   "/apis/custom.metrics.k8s.io/v1beta1",
+			ObjectSelector:      "services/*",
+			ExternalMetricsPath: "/apis/external.metrics.k8s.io/v1beta1",
+			ResourceMetricsPath: "/apis/metrics.k8s.io/v1beta1",
+			Prometheus: PrometheusConfig{
+				Timeout: 5,
+			},
+			Replay: ReplayConfig{
+				Clock: ReplayClockVirtual,
+				Speed: 1,
+			},
+			HTTP: HTTPConfig{
+				Timeout: 5,
+			},
+			CacheTTL: 5,
+		},
+		Logging: LoggingConfig{
+			Level:  "debug",
+			Format: "text",
+		},
+		Server: ServerConfig{
+			Port: 8080,
+		},
+		Sharding: ShardingConfig{
+			Namespace:        "autoscaling",
+			LeaseDuration:    15,
+			RenewInterval:    5,
+			HandoffConfigMap: "gac-handoff",
+			HandoffTimeout:   30,
+		},
+		Policy: PolicyConfig{
+			Enabled:            true,
+			AllowSameNamespace: true,
+		},
+		Admission: AdmissionConfig{
+			Port: 8443,
+		},
+		Ingest: IngestConfig{
+			TTL: 300,
+		},
+	}
+}
+
+// Parse reads a configuration on top of the defaults. Unknown fields are rejected.
+func Parse(data []byte) (*Config, error) {
+	config := Default()
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("could not parse configuration: %v", err)
+	}
+	return config, nil
+}
+
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func (t TargetConfig) Key() string {
+	return fmt.Sprintf("%s/%s/%s", t.Kind, t.Namespace, t.Name)
+}
+
+func (t TargetConfig) resolve(defaults Settings) ResolvedTarget {
+	settings := defaults
+	if t.MinReplicas != nil {
+		settings.MinReplicas = *t.MinReplicas
+	}
+	if t.MaxReplicas != nil {
+		settings.MaxReplicas = *t.MaxReplicas
+	}
+	if t.CalmdownInts != nil {
+		settings.CalmdownInts = *t.CalmdownInts
+	}
+	if t.CheckInterval != nil {
+		settings.CheckInterval = *t.CheckInterval
+	}
+	if t.UseV2 != nil {
+		settings.UseV2 = *t.UseV2
+	}
+	if t.DryRun != nil {
+		settings.DryRun = *t.DryRun
+	}
+	if t.MaxProposalAge != nil {
+		settings.MaxProposalAge = *t.MaxProposalAge
+	}
+	if t.FailurePolicy != nil {
+		settings.FailurePolicy = *t.FailurePolicy
+	}
+	if t.FailureThreshold != nil {
+		settings.FailureThreshold = *t.FailureThreshold
+	}
+	if t.FallbackReplicas != nil {
+		settings.FallbackReplicas = *t.FallbackReplicas
+	}
+	return ResolvedTarget{Target: *util.NewTarget(t.Namespace, t.Name, t.Kind), Rules: t.Rules, Settings: settings}
+}
+
+// Selects reports whether the rule applies to the target. Rules are referenced by name or namespace/name,
+// a target without rule references uses all rules.
+func (t ResolvedTarget) Selects(rule *v1.AutoscalingRule) bool {
+	if len(t.Rules) == 0 {
+		return true
+	}
+	for _, name := range t.Rules {
+		if name == rule.Name || name == rule.Namespace+"/"+rule.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveTargets merges the global defaults into every configured target.
+func (c *Config) ResolveTargets() []ResolvedTarget {
+	targets := make([]ResolvedTarget, 0, len(c.Targets))
+	for _, target := range c.Targets {
+		targets = append(targets, target.resolve(c.Defaults))
+	}
+	return targets
+}
+
+func (s Settings) validate(prefix string) []error {
+	var errs []error
+	if s.MinReplicas < 0 {
+		errs = append(errs, fmt.Errorf("%s.minReplicas must not be negative", prefix))
+	}
+	if s.MaxReplicas < 1 || s.MaxReplicas < s.MinReplicas {
+		errs = append(errs, fmt.Errorf("%s.maxReplicas must be at least 1 and not lower than minReplicas", prefix))
+	}
+	if s.CalmdownInts < 0 {
+		errs = append(errs, fmt.Errorf("%s.calmdownInts must not be negative", prefix))
+	}
+	if s.CheckInterval < 1 {
+		errs = append(errs, fmt.Errorf("%s.checkInterval must be at least 1s", prefix))
+	}
+	if s.MaxProposalAge < 0 {
+		errs = append(errs, fmt.Errorf("%s.maxProposalAge must not be negative", prefix))
+	}
+	switch s.FailurePolicy {
+	case FailurePolicyHold, FailurePolicyScaleUp:
+	case FailurePolicyFallback:
+		if s.FallbackReplicas < s.MinReplicas || s.FallbackReplicas > s.MaxReplicas || s.FallbackReplicas < 1 {
+			errs = append(errs, fmt.Errorf("%s.fallbackReplicas must be at least 1 and within minReplicas and maxReplicas", prefix))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("%s.failurePolicy must be hold, fallback or scaleUp", prefix))
+	}
+	if s.FailureThreshold < 1 {
+		errs = append(errs, fmt.Errorf("%s.failureThreshold must be at least 1", prefix))
+	}
+	return errs
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.APIVersion != APIVersion {
+		errs = append(errs, fmt.Errorf("unsupported apiVersion %q, expected %q", c.APIVersion, APIVersion))
+	}
+	if c.Kind != Kind {
+		errs = append(errs, fmt.Errorf("unsupported kind %q, expected %q", c.Kind, Kind))
+	}
+
+	errs = append(errs, c.Defaults.validate("defaults")...)
+
+	if len(c.Targets) == 0 {
+		errs = append(errs, fmt.Errorf("at least one target is required"))
+	}
+	seen := make(map[string]bool)
+	for i, target := range c.ResolveTargets() {
+		prefix := fmt.Sprintf("targets[%d]", i)
+		if target.Name == "" {
+			errs = append(errs, fmt.Errorf("%s.name is required", prefix))
+		}
+		if target.Kind != "Deployment" && target.Kind != "StatefulSet" {
+			errs = append(errs, fmt.Errorf("%s.kind %q is not supported", prefix, target.Kind))
+		}
+		if key := c.Targets[i].Key(); seen[key] {
+			errs = append(errs, fmt.Errorf("%s: duplicate target %s", prefix, key))
+		} else {
+			seen[key] = true
+		}
+		errs = append(errs, target.Settings.validate(prefix)...)
+	}
+
+	if c.Metrics.CustomMetricsPath == "" {
+		errs = append(errs, fmt.Errorf("metrics.customMetricsPath is required"))
+	}
+	if c.Metrics.ObjectSelector == "" {
+		errs = append(errs, fmt.Errorf("metrics.objectSelector is required"))
+	}
+	if c.Metrics.ExternalMetricsPath == "" {
+		errs = append(errs, fmt.Errorf("metrics.externalMetricsPath is required"))
+	}
+	if c.Metrics.ResourceMetricsPath == "" {
+		errs = append(errs, fmt.Errorf("metrics.resourceMetricsPath is required"))
+	}
+	if c.Metrics.CacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("metrics.cacheTTL must not be negative"))
+	}
+	if replay := c.Metrics.Replay; replay.Clock != ReplayClockVirtual && replay.Clock != ReplayClockWall {
+		errs = append(errs, fmt.Errorf("metrics.replay.clock must be virtual or wall"))
+	} else if replay.Speed <= 0 {
+		errs = append(errs, fmt.Errorf("metrics.replay.speed must be positive"))
+	} else if replay.Global && len(replay.Files) == 0 {
+		errs = append(errs, fmt.Errorf("metrics.replay.global requires files"))
+	}
+	if c.Metrics.HTTP.Timeout < 1 {
+		errs = append(errs, fmt.Errorf("metrics.http.timeout must be at least 1s"))
+	}
+	for i, host := range c.Metrics.HTTP.AllowedHosts {
+		if !validAllowedHost(host) {
+			errs = append(errs, fmt.Errorf("metrics.http.allowedHosts[%d] %q must be a host name, *.domain, IP or CIDR range", i, host))
+		}
+	}
+	if prometheus := c.Metrics.Prometheus; prometheus.URL != "" {
+		if u, err := url.Parse(prometheus.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			errs = append(errs, fmt.Errorf("metrics.prometheus.url must be a http or https URL"))
+		}
+		if prometheus.Timeout < 1 {
+			errs = append(errs, fmt.Errorf("metrics.prometheus.timeout must be at least 1s"))
+		}
+		if prometheus.BearerTokenFile != "" && prometheus.Username != "" {
+			errs = append(errs, fmt.Errorf("metrics.prometheus accepts either a bearer token or basic auth"))
+		}
+	}
+
+	if _, err := log.ParseLevel(c.Logging.Level); err != nil {
+		errs = append(errs, fmt.Errorf("logging.level: %v", err))
+	}
+	if c.Logging.Format != "text" && c.Logging.Format != "json" {
+		errs = append(errs, fmt.Errorf("logging.format must be text or json"))
+	}
+
+	if c.Server.Port < 0 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port %d is out of range", c.Server.Port))
+	}
+	if c.Webhook.Enabled && c.Server.Port == 0 {
+		errs = append(errs, fmt.Errorf("webhook requires server.port to be set"))
+	}
+	if c.Webhook.Enabled && c.Webhook.TokenFile == "" {
+		errs = append(errs, fmt.Errorf("webhook requires tokenFile"))
+	}
+
+	if c.Sharding.Enabled {
+		if c.Sharding.Namespace == "" {
+			errs = append(errs, fmt.Errorf("sharding.namespace is required"))
+		}
+		if c.Sharding.HandoffConfigMap == "" {
+			errs = append(errs, fmt.Errorf("sharding.handoffConfigMap is required"))
+		}
+		if c.Sharding.RenewInterval < 1 || c.Sharding.LeaseDuration <= c.Sharding.RenewInterval {
+			errs = append(errs, fmt.Errorf("sharding.renewInterval must be at least 1s and lower than sharding.leaseDuration"))
+		}
+		if c.Sharding.HandoffTimeout < 0 {
+			errs = append(errs, fmt.Errorf("sharding.handoffTimeout must not be negative"))
+		}
+	}
+
+	for i, entry := range c.Policy.Allow {
+		prefix := fmt.Sprintf("policy.allow[%d]", i)
+		if len(entry.RuleNamespaces) == 0 || len(entry.TargetNamespaces) == 0 {
+			errs = append(errs, fmt.Errorf("%s requires ruleNamespaces and targetNamespaces", prefix))
+		}
+		for _, pattern := range append(append([]string(nil), entry.RuleNamespaces...), entry.TargetNamespaces...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid namespace pattern %q", prefix, pattern))
+			}
+		}
+		if _, err := metav1.LabelSelectorAsSelector(entry.TargetSelector); err != nil {
+			errs = append(errs, fmt.Errorf("%s.targetSelector: %v", prefix, err))
+		}
+	}
+
+	if c.Admission.Enabled {
+		if c.Admission.Port < 1 || c.Admission.Port > 65535 || c.Admission.Port == c.Server.Port {
+			errs = append(errs, fmt.Errorf("admission.port must be a valid port other than server.port"))
+		}
+		if c.Admission.CertFile == "" || c.Admission.KeyFile == "" {
+			errs = append(errs, fmt.Errorf("admission requires certFile and keyFile"))
+		}
+	}
+
+	if c.Ingest.Enabled {
+		if c.Server.Port < 1 {
+			errs = append(errs, fmt.Errorf("ingest requires the HTTP server, server.port must be set"))
+		}
+		if c.Ingest.TTL < 1 {
+			errs = append(errs, fmt.Errorf("ingest.ttl must be at least 1s"))
+		}
+		if c.Ingest.TokenFile != "" && c.Ingest.Username != "" {
+			errs = append(errs, fmt.Errorf("ingest accepts either a bearer token or basic auth"))
+		}
+		if c.Ingest.TokenFile == "" && c.Ingest.Username == "" {
+			errs = append(errs, fmt.Errorf("ingest requires tokenFile or username and passwordFile"))
+		}
+		if (c.Ingest.Username == "") != (c.Ingest.PasswordFile == "") {
+			errs = append(errs, fmt.Errorf("ingest basic auth requires username and passwordFile"))
+		}
+		for _, namespace := range c.Ingest.Namespaces {
+			if msgs := validation.IsDNS1123Label(namespace); len(msgs) > 0 {
+				errs = append(errs, fmt.Errorf("invalid ingest namespace %q: %s", namespace, strings.Join(msgs, ", ")))
+			}
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// validAllowedHost reports whether the entry of the allowed hosts of the http source is a host name, a wildcard
+// matching the subdomains of a domain, an IP or a CIDR range.
+func validAllowedHost(host string) bool {
+	if _, _, err := net.ParseCIDR(host); err == nil || net.ParseIP(host) != nil {
+		return true
+	}
+	return len(validation.IsDNS1123Subdomain(strings.TrimPrefix(host, "*."))) == 0
+}
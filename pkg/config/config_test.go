@@ -0,0 +1,302 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package config
+
+import (
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const validConfig = `
+apiVersion: bsinfo.hhu.de/v1
+kind: ControllerConfig
+defaults:
+  minReplicas: 2
+  maxReplicas: 8
+targets:
+  - namespace: shop
+    name: web
+    kind: Deployment
+    maxReplicas: 4
+    dryRun: true
+    rules: ["cpu-rule", "monitoring/latency-rule"]
+  - namespace: shop
+    name: db
+    kind: StatefulSet
+`
+
+func TestParse(t *testing.T) {
+	config, err := Parse([]byte(validConfig))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if config.Defaults.MinReplicas != 2 || config.Defaults.MaxReplicas != 8 {
+		t.Errorf("defaults not read: %+v", config.Defaults)
+	}
+	// Values missing in the file keep their defaults
+	if config.Defaults.CheckInterval != Default().Defaults.CheckInterval || config.Metrics.CacheTTL != Default().Metrics.CacheTTL {
+		t.Errorf("defaults not kept: %+v", config)
+	}
+	if len(config.Targets) != 2 || *config.Targets[0].MaxReplicas != 4 || config.Targets[1].MaxReplicas != nil {
+		t.Errorf("targets not read: %+v", config.Targets)
+	}
+}
+
+func TestParseRejectsUnknownFields(t *testing.T) {
+	_, err := Parse([]byte(validConfig + "unknown: true\n"))
+	if err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Errorf("expected unknown field to be rejected, got %v", err)
+	}
+	_, err = Parse([]byte(strings.Replace(validConfig, "minReplicas: 2", "minReplica: 2", 1)))
+	if err == nil {
+		t.Errorf("expected misspelled field to be rejected")
+	}
+}
+
+func TestValidateVersion(t *testing.T) {
+	for _, test := range []struct {
+		name, apiVersion, kind string
+		valid                  bool
+	}{
+		{"current", APIVersion, Kind, true},
+		{"other version", "bsinfo.hhu.de/v2", Kind, false},
+		{"missing version", "", Kind, false},
+		{"other kind", APIVersion, "AutoscalingRule", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := Parse([]byte(validConfig))
+			if err != nil {
+				t.Fatal(err)
+			}
+			config.APIVersion, config.Kind = test.apiVersion, test.kind
+			if err := config.Validate(); (err == nil) != test.valid {
+				t.Errorf("Validate() = %v, valid %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestValidateIngestCredentials(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		ingest IngestConfig
+		valid  bool
+	}{
+		{"token", IngestConfig{Enabled: true, TTL: 60, TokenFile: "/etc/gac/ingest-token"}, true},
+		{"basic auth", IngestConfig{Enabled: true, TTL: 60, Username: "app", PasswordFile: "/etc/gac/ingest-password"}, true},
+		{"without credentials", IngestConfig{Enabled: true, TTL: 60}, false},
+		{"both", IngestConfig{Enabled: true, TTL: 60, TokenFile: "/etc/gac/ingest-token", Username: "app", PasswordFile: "/etc/gac/ingest-password"}, false},
+		{"username without password", IngestConfig{Enabled: true, TTL: 60, Username: "app"}, false},
+		{"namespaces", IngestConfig{Enabled: true, TTL: 60, TokenFile: "/etc/gac/ingest-token", Namespaces: []string{"shop", "office"}}, true},
+		{"invalid namespace", IngestConfig{Enabled: true, TTL: 60, TokenFile: "/etc/gac/ingest-token", Namespaces: []string{"Shop_1"}}, false},
+		{"disabled", IngestConfig{}, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := Parse([]byte(validConfig))
+			if err != nil {
+				t.Fatal(err)
+			}
+			config.Server.Port = 8080
+			config.Ingest = test.ingest
+			if err := config.Validate(); (err == nil) != test.valid {
+				t.Errorf("Validate() = %v, valid %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestValidateAllowedHosts(t *testing.T) {
+	for _, test := range []struct {
+		host  string
+		valid bool
+	}{
+		{"stats.example.com", true},
+		{"*.svc.cluster.local", true},
+		{"10.0.0.0/8", true},
+		{"192.168.1.5", true},
+		{"fd00::/64", true},
+		{"", false},
+		{"*", false},
+		{"http://stats.example.com", false},
+		{"stats.example.com:8080", false},
+		{"10.0.0.0/33", false},
+	} {
+		config, err := Parse([]byte(validConfig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Metrics.HTTP.AllowedHosts = []string{test.host}
+		if err := config.Validate(); (err == nil) != test.valid {
+			t.Errorf("Validate() of allowed host %q = %v, valid %v", test.host, err, test.valid)
+		}
+	}
+}
+
+func TestValidateAggregatesErrors(t *testing.T) {
+	config, err := Parse([]byte(`
+apiVersion: bsinfo.hhu.de/v1
+kind: ControllerConfig
+defaults:
+  minReplicas: 5
+  maxReplicas: 2
+targets:
+  - namespace: shop
+    name: web
+    kind: ReplicaSet
+  - namespace: shop
+    name: web
+    kind: ReplicaSet
+    checkInterval: 0
+logging:
+  format: xml
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.Validate()
+	aggregate, ok := err.(utilerrors.Aggregate)
+	if !ok {
+		t.Fatalf("expected an aggregate error, got %v", err)
+	}
+	expected := []string{
+		"defaults.maxReplicas",
+		`targets[0].kind "ReplicaSet"`,
+		"targets[1]: duplicate target",
+		"targets[1].checkInterval",
+		"logging.format",
+	}
+	for _, message := range expected {
+		found := false
+		for _, err := range aggregate.Errors() {
+			if strings.Contains(err.Error(), message) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing error %q in %v", message, err)
+		}
+	}
+}
+
+func TestResolveTargets(t *testing.T) {
+	config, err := Parse([]byte(validConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := config.ResolveTargets()
+	web, db := targets[0], targets[1]
+
+	if web.MinReplicas != 2 || web.MaxReplicas != 4 || !web.DryRun {
+		t.Errorf("overrides not merged: %+v", web.Settings)
+	}
+	if db.MinReplicas != 2 || db.MaxReplicas != 8 || db.DryRun {
+		t.Errorf("defaults not applied: %+v", db.Settings)
+	}
+	if web.Target.Namespace != "shop" || web.Target.Name != "web" || web.Target.Kind != "Deployment" {
+		t.Errorf("unexpected target %+v", web.Target)
+	}
+
+	// Overrides are per target and do not leak into the defaults
+	if config.Defaults.MaxReplicas != 8 || config.Defaults.DryRun {
+		t.Errorf("defaults modified: %+v", config.Defaults)
+	}
+}
+
+func TestSelects(t *testing.T) {
+	config, err := Parse([]byte(validConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := config.ResolveTargets()
+	rule := func(namespace, name string) *v1.AutoscalingRule {
+		return &v1.AutoscalingRule{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+
+	for _, test := range []struct {
+		target   ResolvedTarget
+		rule     *v1.AutoscalingRule
+		selected bool
+	}{
+		{targets[0], rule("shop", "cpu-rule"), true},
+		{targets[0], rule("other", "cpu-rule"), true},
+		{targets[0], rule("monitoring", "latency-rule"), true},
+		{targets[0], rule("shop", "latency-rule"), false},
+		{targets[0], rule("shop", "memory-rule"), false},
+		{targets[1], rule("anywhere", "any-rule"), true},
+	} {
+		if selected := test.target.Selects(test.rule); selected != test.selected {
+			t.Errorf("%s selects %s/%s = %v, expected %v", test.target.Name, test.rule.Namespace, test.rule.Name, selected, test.selected)
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(path, []byte(validConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	prepare := func(config *Config) {
+		config.Defaults.CalmdownInts = 7
+	}
+	changes := make(chan *Config, 1)
+	watcher := NewWatcher(path, 10*time.Millisecond, prepare, func(config *Config) { changes <- config })
+
+	config, err := watcher.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if config.Defaults.CalmdownInts != 7 {
+		t.Errorf("prepare not applied before validation")
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go watcher.Run(stop)
+
+	// Invalid content is not handed to the callback
+	if err := ioutil.WriteFile(path, []byte(strings.Replace(validConfig, "maxReplicas: 8", "maxReplicas: 0", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case config := <-changes:
+		t.Fatalf("invalid configuration handed over: %+v", config.Defaults)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := ioutil.WriteFile(path, []byte(strings.Replace(validConfig, "maxReplicas: 8", "maxReplicas: 9", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case config := <-changes:
+		if config.Defaults.MaxReplicas != 9 || config.Defaults.CalmdownInts != 7 {
+			t.Errorf("unexpected reloaded configuration %+v", config.Defaults)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("changed configuration not reloaded")
+	}
+}
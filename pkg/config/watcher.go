@@ -0,0 +1,93 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	log "github.com/Sirupsen/logrus"
+	"io/ioutil"
+	"time"
+)
+
+// Watcher polls a configuration file and hands every changed and valid configuration to its callback.
+// Polling (instead of inotify) also catches the symlink swaps of mounted ConfigMaps.
+type Watcher struct {
+	path     string
+	interval time.Duration
+	prepare  func(*Config)
+	onChange func(*Config)
+	checksum []byte
+}
+
+// NewWatcher creates a watcher for the given file. prepare is applied to every parsed configuration before it
+// is validated, e.g. to let command line flags override file values.
+func NewWatcher(path string, interval time.Duration, prepare func(*Config), onChange func(*Config)) *Watcher {
+	return &Watcher{path: path, interval: interval, prepare: prepare, onChange: onChange}
+}
+
+// Load reads, prepares and validates the current file content.
+func (w *Watcher) Load() (*Config, error) {
+	data, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum := sha256.Sum256(data)
+	w.checksum = checksum[:]
+
+	config, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	w.prepare(config)
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (w *Watcher) changed() bool {
+	data, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		log.Errorf("Could not read configuration file %s: %v", w.path, err)
+		return false
+	}
+	checksum := sha256.Sum256(data)
+	return !bytes.Equal(checksum[:], w.checksum)
+}
+
+func (w *Watcher) Run(stopChan <-chan struct{}) {
+	log.Infof("Watching configuration file %s for changes (interval %v)", w.path, w.interval)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+			if !w.changed() {
+				continue
+			}
+			log.Infof("Configuration file %s changed, reloading..", w.path)
+			config, err := w.Load()
+			if err != nil {
+				// Keep running with the previous configuration
+				log.Errorf("Invalid configuration, keeping previous one: %v", err)
+				continue
+			}
+			w.onChange(config)
+		}
+	}
+}
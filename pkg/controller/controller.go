@@ -0,0 +1,279 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/autoscaler"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/client/clientset/versioned"
+	listers "github.com/grieshaber/generic-autoscaler-controller/pkg/client/listers/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/events"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/metrics"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/policy"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/sharding"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/status"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Controller runs one autoscaler per configured target and reconciles them whenever the configuration changes.
+// With sharding enabled, it only runs the autoscalers of the targets owned by this replica.
+type Controller struct {
+	kubeclientset *kubernetes.Clientset
+	rules         listers.AutoscalingRuleLister
+	statusUpdater *status.Updater
+	recorder      *events.Recorder
+	scalers       map[string]*autoscaler.Autoscaler
+	targets       map[string]config.ResolvedTarget
+	mutex         sync.Mutex
+
+	// sharding, handoff is nil if disabled
+	identity       string
+	ring           *sharding.Ring
+	handoff        *sharding.Handoff
+	handoffTimeout time.Duration
+	adopting       map[string]bool
+	stopped        bool
+}
+
+func New(kubeclientset *kubernetes.Clientset, rulesClientset versioned.Interface, rules listers.AutoscalingRuleLister) *Controller {
+	return &Controller{kubeclientset: kubeclientset, rules: rules, statusUpdater: status.NewUpdater(rulesClientset),
+		recorder: events.NewRecorder(kubeclientset), scalers: make(map[string]*autoscaler.Autoscaler),
+		targets: make(map[string]config.ResolvedTarget), adopting: make(map[string]bool)}
+}
+
+// EnableSharding restricts the controller to the targets owned by the given identity. No target is owned before
+// the first call of Rebalance. Targets changing their owner hand over their state through the handoff.
+func (c *Controller) EnableSharding(identity string, handoff *sharding.Handoff, handoffTimeout time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.identity = identity
+	c.handoff = handoff
+	c.handoffTimeout = handoffTimeout
+}
+
+// Apply starts, updates and stops autoscalers so that they match the given configuration.
+func (c *Controller) Apply(cfg *config.Config) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	metrics.Configure(cfg.Metrics)
+	policy.Configure(cfg.Policy)
+
+	targets := make(map[string]config.ResolvedTarget)
+	for i, target := range cfg.ResolveTargets() {
+		targets[cfg.Targets[i].Key()] = target
+	}
+	for key, running := range c.scalers {
+		if _, configured := targets[key]; !configured {
+			log.Infof("Target %s removed from configuration, stopping its autoscaler", key)
+			running.Stop()
+			delete(c.scalers, key)
+		}
+	}
+	c.targets = targets
+	c.reconcile(c.ring)
+}
+
+// Rebalance takes over and gives away targets after the shard members changed.
+func (c *Controller) Rebalance(previous, current *sharding.Ring) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.ring = current
+	c.reconcile(previous)
+}
+
+func shardKey(target config.ResolvedTarget) string {
+	return target.Namespace + "/" + target.Name
+}
+
+func (c *Controller) owns(target config.ResolvedTarget) bool {
+	return c.handoff == nil || c.ring.Owner(shardKey(target)) == c.identity
+}
+
+// reconcile runs the autoscalers of the owned targets. previous is the ring the current owners of newly owned
+// targets are looked up in.
+func (c *Controller) reconcile(previous *sharding.Ring) {
+	if c.stopped {
+		return
+	}
+
+	for key, target := range c.targets {
+		running, exists := c.scalers[key]
+		owned := c.owns(target)
+		switch {
+		case exists && owned:
+			log.Debugf("Updating settings of target %s", key)
+			running.Update(target)
+		case exists:
+			log.Infof("Target %s is now owned by %s, stopping its autoscaler", key, c.ring.Owner(shardKey(target)))
+			c.stop(key, true)
+		case owned && c.handoff == nil:
+			c.start(key, target, nil)
+		case owned && !c.adopting[key]:
+			c.adopt(key, previous.Owner(shardKey(target)))
+		}
+	}
+}
+
+func (c *Controller) start(key string, target config.ResolvedTarget, state *autoscaler.State) {
+	log.Infof("Starting autoscaler for target %s (minReplicas: %d, maxReplicas: %d, calmdownInts: %d, checkInterval: %ds, usev2: %v, dryRun: %v)",
+		key, target.MinReplicas, target.MaxReplicas, target.CalmdownInts, target.CheckInterval, target.UseV2, target.DryRun)
+	scaler := autoscaler.New(c.kubeclientset, target, c.rules, c.statusUpdater, c.recorder)
+	if state != nil {
+		scaler.Restore(*state)
+	}
+	scaler.Run()
+	c.scalers[key] = scaler
+}
+
+// stop stops the autoscaler of a target and optionally leaves its state for the next owner.
+func (c *Controller) stop(key string, handOver bool) {
+	running := c.scalers[key]
+	running.Stop()
+	delete(c.scalers, key)
+	if !handOver || c.handoff == nil {
+		return
+	}
+
+	data, err := json.Marshal(running.State())
+	if err != nil {
+		log.Errorf("Could not encode state of target %s: %v", key, err)
+		return
+	}
+	if err := c.handoff.Store(key, string(data)); err != nil {
+		log.Errorf("Could not hand over state of target %s: %v", key, err)
+	}
+}
+
+// adopt starts the autoscaler of a newly owned target in the background. If the previous owner is still alive, it
+// waits for the previous owner to stop its autoscaler and hand over the state, at most for the handoff timeout.
+func (c *Controller) adopt(key string, previousOwner string) {
+	c.adopting[key] = true
+	wait := previousOwner != "" && previousOwner != c.identity && c.ring.Has(previousOwner)
+	if wait {
+		log.Infof("Waiting up to %v for %s to hand over target %s", c.handoffTimeout, previousOwner, key)
+	}
+
+	go func() {
+		state := c.awaitHandoff(key, wait)
+
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		delete(c.adopting, key)
+
+		target, configured := c.targets[key]
+		if c.stopped || !configured || !c.owns(target) || c.scalers[key] != nil {
+			return
+		}
+		c.start(key, target, state)
+	}()
+}
+
+func (c *Controller) awaitHandoff(key string, wait bool) *autoscaler.State {
+	deadline := time.Now().Add(c.handoffTimeout)
+	for {
+		data, found, err := c.handoff.Take(key)
+		if err != nil {
+			log.Errorf("Could not take over state of target %s: %v", key, err)
+		} else if found {
+			var state autoscaler.State
+			if err := json.Unmarshal([]byte(data), &state); err != nil {
+				log.Errorf("Could not decode state of target %s: %v", key, err)
+				return nil
+			}
+			log.Infof("Took over state of target %s", key)
+			return &state
+		}
+
+		if !wait || time.Now().After(deadline) {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// Stop stops all autoscalers. With sharding enabled, their states are left for the next owners.
+func (c *Controller) Stop() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.stopped = true
+	for key := range c.scalers {
+		c.stop(key, true)
+	}
+}
+
+// Resolve finds a rule by namespace/name or, if unambiguous, by its name alone.
+func (c *Controller) Resolve(reference string) (*v1.AutoscalingRule, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(reference)
+	if err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
+	if namespace != "" {
+		return c.rules.AutoscalingRules(namespace).Get(name)
+	}
+
+	rules, err := c.rules.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var found *v1.AutoscalingRule
+	for _, rule := range rules {
+		if rule.Name != name {
+			continue
+		}
+		if found != nil {
+			return nil, errors.NewBadRequest(fmt.Sprintf("rule name %s is ambiguous, use namespace/name", name))
+		}
+		found = rule
+	}
+	if found == nil {
+		return nil, errors.NewNotFound(v1.Resource("autoscalingrules"), name)
+	}
+	return found, nil
+}
+
+// Trigger requests an immediate evaluation of every running target the rule applies to. The optional push is used
+// as the rule's next sample. The keys of the triggered targets are returned.
+func (c *Controller) Trigger(rule *v1.AutoscalingRule, push *autoscaler.Push) []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var triggered []string
+	for key, scaler := range c.scalers {
+		target := c.targets[key]
+		if !target.Selects(rule) {
+			continue
+		}
+		if err := policy.MaySelect(rule, target.Namespace); err != nil {
+			log.Warnf("Not triggering %s for rule %s/%s: %v", key, rule.Namespace, rule.Name, err)
+			continue
+		}
+		scaler.Trigger(rule.Namespace+"/"+rule.Name, push)
+		triggered = append(triggered, key)
+	}
+	sort.Strings(triggered)
+	return triggered
+}
@@ -0,0 +1,62 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package events
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"os"
+	"time"
+)
+
+const component = "generic-autoscaler-controller"
+
+// Recorder creates Kubernetes events for objects touched by the controller.
+type Recorder struct {
+	kubeclientset kubernetes.Interface
+	host          string
+}
+
+func NewRecorder(kubeclientset kubernetes.Interface) *Recorder {
+	host, _ := os.Hostname()
+	return &Recorder{kubeclientset: kubeclientset, host: host}
+}
+
+// Eventf records an event of the given type (corev1.EventTypeNormal or corev1.EventTypeWarning). Failures are
+// only logged, an event must never block the evaluation.
+func (r *Recorder) Eventf(object corev1.ObjectReference, eventType string, reason string, messageFmt string, args ...interface{}) {
+	now := metav1.NewTime(time.Now())
+	message := fmt.Sprintf(messageFmt, args...)
+
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%v.%x", object.Name, now.UnixNano()),
+			Namespace: object.Namespace,
+		},
+		InvolvedObject: object,
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: component, Host: r.host},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	if _, err := r.kubeclientset.CoreV1().Events(object.Namespace).Create(event); err != nil {
+		log.Errorf("Could not record event %s for %s %s/%s: %v", reason, object.Kind, object.Namespace, object.Name, err)
+	}
+}
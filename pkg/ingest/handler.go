@@ -0,0 +1,123 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package ingest
+
+import (
+	"crypto/subtle"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/monitoring"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// PathPrefix is the path the endpoint is served at, followed by the namespace the samples are pushed to.
+const PathPrefix = "/push/"
+
+var (
+	samplesCounter = monitoring.NewCounterVec("gac_ingested_samples_total", "Samples pushed to the ingestion endpoint.", "namespace")
+	seriesGauge    = monitoring.NewGaugeVec("gac_ingested_series", "Pushed series kept in memory.", "namespace")
+)
+
+// Credentials protect the endpoint with a bearer token or basic auth. Without any, every request is rejected.
+// Namespaces restricts the namespaces the credentials may push to, all namespaces are allowed if it is empty.
+type Credentials struct {
+	Token      string
+	Username   string
+	Password   string
+	Namespaces []string
+}
+
+// Complete reports whether the credentials contain a token or a username and password.
+func (c Credentials) Complete() bool {
+	return c.Token != "" || (c.Username != "" && c.Password != "")
+}
+
+// permits reports whether the credentials may push to the namespace.
+func (c Credentials) permits(namespace string) bool {
+	if len(c.Namespaces) == 0 {
+		return true
+	}
+	for _, permitted := range c.Namespaces {
+		if permitted == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+type handler struct {
+	store       *Store
+	credentials Credentials
+}
+
+// Handler creates the ingestion endpoint. Samples are posted to /push/<namespace> in the OpenMetrics or
+// Prometheus text format.
+func Handler(store *Store, credentials Credentials) http.Handler {
+	return &handler{store: store, credentials: credentials}
+}
+
+func equal(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func (h *handler) authorized(r *http.Request) bool {
+	switch {
+	case h.credentials.Token != "":
+		return equal(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), h.credentials.Token)
+	case h.credentials.Username != "" && h.credentials.Password != "":
+		username, password, ok := r.BasicAuth()
+		return ok && equal(username, h.credentials.Username) && equal(password, h.credentials.Password)
+	default:
+		return false
+	}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "only POST and PUT are supported", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="gac-ingest"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	namespace := strings.Trim(strings.TrimPrefix(r.URL.Path, PathPrefix), "/")
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		http.Error(w, fmt.Sprintf("invalid namespace %q: %s", namespace, strings.Join(errs, ", ")), http.StatusBadRequest)
+		return
+	}
+	if !h.credentials.permits(namespace) {
+		http.Error(w, fmt.Sprintf("pushing to namespace %s is not permitted", namespace), http.StatusForbidden)
+		return
+	}
+
+	openMetrics := strings.HasPrefix(r.Header.Get("Content-Type"), "application/openmetrics-text")
+	samples, err := Parse(http.MaxBytesReader(w, r.Body, 1<<20), openMetrics, time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid samples: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := h.store.Add(namespace, samples); err != nil {
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+	log.Debugf("Ingested %d samples into namespace %s", len(samples), namespace)
+	samplesCounter.Add(float64(len(samples)), namespace)
+
+	w.WriteHeader(http.StatusNoContent)
+}
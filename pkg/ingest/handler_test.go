@@ -0,0 +1,108 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package ingest
+
+import (
+	"k8s.io/apimachinery/pkg/labels"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	timestamp := time.Now().Add(-time.Second).Truncate(time.Second)
+	seconds := strconv.FormatInt(timestamp.Unix(), 10)
+	milliseconds := strconv.FormatInt(timestamp.Unix()*1000, 10)
+
+	for _, test := range []struct {
+		name        string
+		credentials Credentials
+		method      string
+		path        string
+		contentType string
+		body        string
+		auth        func(r *http.Request)
+		status      int
+	}{
+		{"bearer token", Credentials{Token: "s3cret"}, http.MethodPost, "/push/shop", "text/plain", "queue_length 4 " + milliseconds,
+			func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusNoContent},
+		{"openmetrics", Credentials{Token: "s3cret"}, http.MethodPut, "/push/shop/", "application/openmetrics-text; version=1.0.0", "queue_length 4 " + seconds + "\n# EOF\n",
+			func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusNoContent},
+		{"basic auth", Credentials{Username: "app", Password: "pa55"}, http.MethodPost, "/push/shop", "", "queue_length 4 " + milliseconds,
+			func(r *http.Request) { r.SetBasicAuth("app", "pa55") }, http.StatusNoContent},
+		{"wrong token", Credentials{Token: "s3cret"}, http.MethodPost, "/push/shop", "", "queue_length 4",
+			func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") }, http.StatusUnauthorized},
+		{"missing token", Credentials{Token: "s3cret"}, http.MethodPost, "/push/shop", "", "queue_length 4",
+			func(r *http.Request) {}, http.StatusUnauthorized},
+		{"wrong password", Credentials{Username: "app", Password: "pa55"}, http.MethodPost, "/push/shop", "", "queue_length 4",
+			func(r *http.Request) { r.SetBasicAuth("app", "guess") }, http.StatusUnauthorized},
+		{"without credentials", Credentials{}, http.MethodPost, "/push/shop", "", "queue_length 4",
+			func(r *http.Request) {}, http.StatusUnauthorized},
+		{"username without password", Credentials{Username: "app"}, http.MethodPost, "/push/shop", "", "queue_length 4",
+			func(r *http.Request) { r.SetBasicAuth("app", "") }, http.StatusUnauthorized},
+		{"method", Credentials{Token: "s3cret"}, http.MethodGet, "/push/shop", "", "",
+			func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusMethodNotAllowed},
+		{"invalid namespace", Credentials{Token: "s3cret"}, http.MethodPost, "/push/Shop_1", "", "queue_length 4",
+			func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusBadRequest},
+		{"malformed samples", Credentials{Token: "s3cret"}, http.MethodPost, "/push/shop", "", "queue_length",
+			func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusBadRequest},
+		{"permitted namespace", Credentials{Token: "s3cret", Namespaces: []string{"office", "shop"}}, http.MethodPost, "/push/shop", "", "queue_length 4 " + milliseconds,
+			func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusNoContent},
+		{"other namespace", Credentials{Token: "s3cret", Namespaces: []string{"office"}}, http.MethodPost, "/push/shop", "", "queue_length 4 " + milliseconds,
+			func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusForbidden},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore(time.Minute)
+			request := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			if test.contentType != "" {
+				request.Header.Set("Content-Type", test.contentType)
+			}
+			test.auth(request)
+			response := httptest.NewRecorder()
+			Handler(store, test.credentials).ServeHTTP(response, request)
+
+			if response.Code != test.status {
+				t.Fatalf("status %d (%s), expected %d", response.Code, strings.TrimSpace(response.Body.String()), test.status)
+			}
+			samples := store.Latest("shop", "queue_length", labels.Everything())
+			if test.status != http.StatusNoContent {
+				if len(samples) != 0 {
+					t.Errorf("rejected request stored %+v", samples)
+				}
+				return
+			}
+			if len(samples) != 1 || samples[0].Value != 4 || !samples[0].Timestamp.Equal(timestamp) {
+				t.Errorf("stored %+v, expected 4 at %v", samples, timestamp)
+			}
+		})
+	}
+}
+
+func TestCredentialsComplete(t *testing.T) {
+	for _, test := range []struct {
+		credentials Credentials
+		expected    bool
+	}{
+		{Credentials{}, false},
+		{Credentials{Token: "s3cret"}, true},
+		{Credentials{Username: "app", Password: "pa55"}, true},
+		{Credentials{Username: "app"}, false},
+		{Credentials{Password: "pa55"}, false},
+	} {
+		if complete := test.credentials.Complete(); complete != test.expected {
+			t.Errorf("%+v.Complete() = %v, expected %v", test.credentials, complete, test.expected)
+		}
+	}
+}
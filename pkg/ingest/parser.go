@@ -0,0 +1,149 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package ingest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNamePattern  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Parse reads samples in the OpenMetrics or Prometheus text format. Comments, metadata and samples that are not a
+// number are skipped. Timestamps are seconds in OpenMetrics and milliseconds in the Prometheus format, samples
+// without one are stamped with the given time.
+func Parse(reader io.Reader, openMetrics bool, now time.Time) ([]Sample, error) {
+	var samples []Sample
+	scanner := bufio.NewScanner(reader)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sample, err := parseLine(line, openMetrics, now)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	return samples, scanner.Err()
+}
+
+func parseLine(line string, openMetrics bool, now time.Time) (Sample, error) {
+	sample := Sample{Labels: map[string]string{}, Timestamp: now}
+
+	end := strings.IndexAny(line, "{ \t")
+	if end < 0 {
+		return sample, fmt.Errorf("missing value")
+	}
+	sample.Name = line[:end]
+	if !metricNamePattern.MatchString(sample.Name) {
+		return sample, fmt.Errorf("invalid metric name %q", sample.Name)
+	}
+	rest := line[end:]
+
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		if rest, err = parseLabels(rest[1:], sample.Labels); err != nil {
+			return sample, err
+		}
+	}
+
+	if exemplar := strings.Index(rest, " # "); exemplar >= 0 {
+		rest = rest[:exemplar]
+	}
+	fields := strings.Fields(rest)
+	if len(fields) < 1 || len(fields) > 2 {
+		return sample, fmt.Errorf("expected a value and an optional timestamp, got %q", rest)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("invalid value %q", fields[0])
+	}
+	sample.Value = value
+
+	if len(fields) == 2 {
+		timestamp, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return sample, fmt.Errorf("invalid timestamp %q", fields[1])
+		}
+		if openMetrics {
+			sample.Timestamp = time.Unix(0, int64(timestamp*float64(time.Second)))
+		} else {
+			sample.Timestamp = time.Unix(0, int64(timestamp)*int64(time.Millisecond))
+		}
+	}
+	return sample, nil
+}
+
+// parseLabels reads the labels up to the closing brace and returns the remainder of the line.
+func parseLabels(rest string, sampleLabels map[string]string) (string, error) {
+	for {
+		rest = strings.TrimLeft(rest, " \t,")
+		if strings.HasPrefix(rest, "}") {
+			return rest[1:], nil
+		}
+
+		equals := strings.Index(rest, "=")
+		if equals < 0 {
+			return "", fmt.Errorf("unterminated labels")
+		}
+		name := strings.TrimSpace(rest[:equals])
+		if !labelNamePattern.MatchString(name) {
+			return "", fmt.Errorf("invalid label name %q", name)
+		}
+		rest = strings.TrimLeft(rest[equals+1:], " \t")
+		if !strings.HasPrefix(rest, `"`) {
+			return "", fmt.Errorf("value of label %s is not quoted", name)
+		}
+
+		var value strings.Builder
+		closed := false
+		i := 1
+		for ; i < len(rest); i++ {
+			c := rest[i]
+			if c == '\\' && i+1 < len(rest) {
+				i++
+				switch rest[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(rest[i])
+				}
+				continue
+			}
+			if c == '"' {
+				closed = true
+				break
+			}
+			value.WriteByte(c)
+		}
+		if !closed {
+			return "", fmt.Errorf("unterminated value of label %s", name)
+		}
+		sampleLabels[name] = value.String()
+		rest = rest[i+1:]
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package ingest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var parseTime = time.Date(2019, 6, 8, 13, 20, 0, 0, time.UTC)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		input       string
+		openMetrics bool
+		expected    []Sample
+	}{
+		{
+			name:     "plain sample",
+			input:    "queue_length 17\n",
+			expected: []Sample{{Name: "queue_length", Labels: map[string]string{}, Value: 17, Timestamp: parseTime}},
+		},
+		{
+			name: "metadata, comments and blank lines",
+			input: `# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+
+http_requests_total{code="200"} 1027
+# EOF
+`,
+			openMetrics: true,
+			expected:    []Sample{{Name: "http_requests_total", Labels: map[string]string{"code": "200"}, Value: 1027, Timestamp: parseTime}},
+		},
+		{
+			name:     "label escapes",
+			input:    `log{path="C:\\tmp",quote="say \"hi\"",text="a\nb"} 1`,
+			expected: []Sample{{Name: "log", Labels: map[string]string{"path": `C:\tmp`, "quote": `say "hi"`, "text": "a\nb"}, Value: 1, Timestamp: parseTime}},
+		},
+		{
+			name:     "label whitespace and trailing comma",
+			input:    `jobs{ queue = "mail" , priority="high", } -2.5`,
+			expected: []Sample{{Name: "jobs", Labels: map[string]string{"queue": "mail", "priority": "high"}, Value: -2.5, Timestamp: parseTime}},
+		},
+		{
+			name:     "braces and spaces in label values",
+			input:    `route{path="/a b/{id}"} 1e3`,
+			expected: []Sample{{Name: "route", Labels: map[string]string{"path": "/a b/{id}"}, Value: 1000, Timestamp: parseTime}},
+		},
+		{
+			name:        "openmetrics timestamp in seconds",
+			input:       "queue_length 3 1560000000.5",
+			openMetrics: true,
+			expected:    []Sample{{Name: "queue_length", Labels: map[string]string{}, Value: 3, Timestamp: time.Unix(1560000000, 500000000)}},
+		},
+		{
+			name:     "prometheus timestamp in milliseconds",
+			input:    "queue_length 3 1560000000500",
+			expected: []Sample{{Name: "queue_length", Labels: map[string]string{}, Value: 3, Timestamp: time.Unix(1560000000, 500000000)}},
+		},
+		{
+			name:        "exemplar",
+			input:       `latency_bucket{le="0.5"} 12 # {trace_id="4f2a"} 0.31 1560000000`,
+			openMetrics: true,
+			expected:    []Sample{{Name: "latency_bucket", Labels: map[string]string{"le": "0.5"}, Value: 12, Timestamp: parseTime}},
+		},
+		{
+			name:     "not a number",
+			input:    "a NaN\nb +Inf\nc -Inf\nd 4",
+			expected: []Sample{{Name: "d", Labels: map[string]string{}, Value: 4, Timestamp: parseTime}},
+		},
+		{
+			name:  "empty",
+			input: "# nothing\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			samples, err := Parse(strings.NewReader(test.input), test.openMetrics, parseTime)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if len(samples) != len(test.expected) {
+				t.Fatalf("samples %+v, expected %+v", samples, test.expected)
+			}
+			for i := range samples {
+				if !reflect.DeepEqual(samples[i].Labels, test.expected[i].Labels) || samples[i].Name != test.expected[i].Name ||
+					samples[i].Value != test.expected[i].Value || !samples[i].Timestamp.Equal(test.expected[i].Timestamp) {
+					t.Errorf("sample %+v, expected %+v", samples[i], test.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected string
+	}{
+		{"queue_length", "missing value"},
+		{`queue{a="b"}`, "expected a value"},
+		{"1queue 2", "invalid metric name"},
+		{"queue-length 2", "invalid metric name"},
+		{`queue{1a="x"} 2`, "invalid label name"},
+		{`queue{a=x} 2`, "not quoted"},
+		{`queue{a="x} 2`, "unterminated value of label a"},
+		{`queue{a="x" 2`, "unterminated labels"},
+		{"queue many", `invalid value "many"`},
+		{"queue 1 2 3", "expected a value and an optional timestamp"},
+		{"queue 1 yesterday", `invalid timestamp "yesterday"`},
+		{"ok 1\n\nbroken", "line 3: missing value"},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			samples, err := Parse(strings.NewReader(test.input), false, parseTime)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("Parse() = %v, expected an error containing %q", err, test.expected)
+			}
+			if samples != nil {
+				t.Errorf("samples %+v returned with an error", samples)
+			}
+		})
+	}
+}
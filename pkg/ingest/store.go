@@ -0,0 +1,203 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+// Package ingest receives samples that applications push in the OpenMetrics text format and keeps them in memory
+// until they expire, for the push metric source.
+package ingest
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/labels"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxPoints bounds the points kept per series
+	maxPoints = 60
+	// maxSeries bounds the series kept per namespace, pushes adding more are rejected
+	maxSeries = 10000
+	// maxNamespaces bounds the namespaces kept, pushes to further namespaces are rejected until others expired
+	maxNamespaces = 100
+)
+
+// Sample is a pushed value of a series.
+type Sample struct {
+	Name      string
+	Labels    map[string]string
+	Value     float64
+	Timestamp time.Time
+}
+
+type point struct {
+	value     float64
+	timestamp time.Time
+}
+
+type series struct {
+	name   string
+	labels map[string]string
+	points []point
+}
+
+// Store holds the pushed series per namespace. Points older than the TTL are dropped, series without points are
+// removed.
+type Store struct {
+	mutex      sync.RWMutex
+	ttl        time.Duration
+	namespaces map[string]map[string]*series
+}
+
+func NewStore(ttl time.Duration) *Store {
+	return &Store{ttl: ttl, namespaces: make(map[string]map[string]*series)}
+}
+
+// seriesKey identifies a series by its name and sorted labels.
+func seriesKey(name string, seriesLabels map[string]string) string {
+	names := make([]string, 0, len(seriesLabels))
+	for label := range seriesLabels {
+		names = append(names, label)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	key.WriteString(name)
+	for _, label := range names {
+		fmt.Fprintf(&key, ",%s=%q", label, seriesLabels[label])
+	}
+	return key.String()
+}
+
+// Add stores the samples in the namespace. Samples older than the TTL are ignored. A batch adding more series than
+// the namespace may keep, or adding a namespace to a store that is full, is rejected as a whole.
+func (s *Store) Add(namespace string, samples []Sample) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	oldest := time.Now().Add(-s.ttl)
+	stored := s.namespaces[namespace]
+	added := make(map[string]bool)
+	for _, sample := range samples {
+		if sample.Timestamp.Before(oldest) {
+			continue
+		}
+		if key := seriesKey(sample.Name, sample.Labels); stored[key] == nil {
+			added[key] = true
+		}
+	}
+	if len(stored)+len(added) > maxSeries {
+		return fmt.Errorf("namespace %s exceeds %d series", namespace, maxSeries)
+	}
+
+	if stored == nil {
+		if len(added) == 0 {
+			return nil
+		}
+		if len(s.namespaces) >= maxNamespaces {
+			return fmt.Errorf("namespace %s exceeds the %d namespaces pushed to", namespace, maxNamespaces)
+		}
+		stored = make(map[string]*series)
+		s.namespaces[namespace] = stored
+	}
+	defer func() { seriesGauge.Set(float64(len(stored)), namespace) }()
+
+	for _, sample := range samples {
+		if sample.Timestamp.Before(oldest) {
+			continue
+		}
+		key := seriesKey(sample.Name, sample.Labels)
+		current, exists := stored[key]
+		if !exists {
+			current = &series{name: sample.Name, labels: sample.Labels}
+			stored[key] = current
+		}
+
+		p := point{value: sample.Value, timestamp: sample.Timestamp}
+		if n := len(current.points); n > 0 && !p.timestamp.After(current.points[n-1].timestamp) {
+			// Out of order points replace the latest one if they are not older
+			if p.timestamp.Equal(current.points[n-1].timestamp) {
+				current.points[n-1] = p
+			}
+			continue
+		}
+		current.points = append(current.points, p)
+		if len(current.points) > maxPoints {
+			current.points = append(current.points[:0], current.points[len(current.points)-maxPoints:]...)
+		}
+	}
+	return nil
+}
+
+// Latest returns the latest sample of every unexpired series of the metric in the namespace matching the selector.
+func (s *Store) Latest(namespace string, name string, selector labels.Selector) []Sample {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	oldest := time.Now().Add(-s.ttl)
+	var samples []Sample
+	for _, current := range s.namespaces[namespace] {
+		if current.name != name || len(current.points) == 0 || !selector.Matches(labels.Set(current.labels)) {
+			continue
+		}
+		latest := current.points[len(current.points)-1]
+		if latest.timestamp.Before(oldest) {
+			continue
+		}
+		samples = append(samples, Sample{Name: name, Labels: current.labels, Value: latest.value, Timestamp: latest.timestamp})
+	}
+	return samples
+}
+
+// Expire drops the points older than the TTL and removes empty series and namespaces.
+func (s *Store) Expire() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	oldest := time.Now().Add(-s.ttl)
+	for namespace, stored := range s.namespaces {
+		for key, current := range stored {
+			start := 0
+			for start < len(current.points) && current.points[start].timestamp.Before(oldest) {
+				start++
+			}
+			current.points = append(current.points[:0], current.points[start:]...)
+			if len(current.points) == 0 {
+				delete(stored, key)
+			}
+		}
+		if len(stored) == 0 {
+			delete(s.namespaces, namespace)
+		}
+		seriesGauge.Set(float64(len(stored)), namespace)
+	}
+}
+
+// Run expires old points until the stop channel is closed.
+func (s *Store) Run(stopChan <-chan struct{}) {
+	interval := s.ttl / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+			s.Expire()
+		}
+	}
+}
@@ -0,0 +1,210 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package ingest
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/labels"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sampleAt(name string, queue string, value float64, timestamp time.Time) Sample {
+	return Sample{Name: name, Labels: map[string]string{"queue": queue}, Value: value, Timestamp: timestamp}
+}
+
+// latestValues returns the latest value per queue label.
+func latestValues(store *Store, namespace string, name string, selector labels.Selector) map[string]float64 {
+	values := make(map[string]float64)
+	for _, sample := range store.Latest(namespace, name, selector) {
+		values[sample.Labels["queue"]] = sample.Value
+	}
+	return values
+}
+
+func TestStoreLatest(t *testing.T) {
+	store := NewStore(time.Minute)
+	now := time.Now()
+	err := store.Add("shop", []Sample{
+		sampleAt("queue_length", "mail", 1, now.Add(-20*time.Second)),
+		sampleAt("queue_length", "mail", 2, now.Add(-10*time.Second)),
+		sampleAt("queue_length", "print", 5, now.Add(-10*time.Second)),
+		sampleAt("queue_age", "mail", 60, now.Add(-10*time.Second)),
+		// Expired samples are ignored
+		sampleAt("queue_length", "fax", 9, now.Add(-2*time.Minute)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values := latestValues(store, "shop", "queue_length", labels.Everything()); len(values) != 2 || values["mail"] != 2 || values["print"] != 5 {
+		t.Errorf("latest values %v, expected mail 2 and print 5", values)
+	}
+	selector := labels.SelectorFromSet(labels.Set{"queue": "print"})
+	if values := latestValues(store, "shop", "queue_length", selector); len(values) != 1 || values["print"] != 5 {
+		t.Errorf("latest values %v of the selected series, expected print 5", values)
+	}
+	if values := latestValues(store, "other", "queue_length", labels.Everything()); len(values) != 0 {
+		t.Errorf("samples %v leaked into another namespace", values)
+	}
+}
+
+func TestStoreOutOfOrder(t *testing.T) {
+	store := NewStore(time.Minute)
+	now := time.Now()
+	latest := now.Add(-10 * time.Second)
+	store.Add("shop", []Sample{sampleAt("queue_length", "mail", 1, latest)})
+
+	// Older points are dropped, points at the same time replace the latest one
+	store.Add("shop", []Sample{sampleAt("queue_length", "mail", 7, latest.Add(-time.Second))})
+	if values := latestValues(store, "shop", "queue_length", labels.Everything()); values["mail"] != 1 {
+		t.Errorf("latest value %v after an older point, expected 1", values["mail"])
+	}
+	store.Add("shop", []Sample{sampleAt("queue_length", "mail", 3, latest)})
+	if values := latestValues(store, "shop", "queue_length", labels.Everything()); values["mail"] != 3 {
+		t.Errorf("latest value %v after a point at the same time, expected 3", values["mail"])
+	}
+}
+
+func TestStoreBoundsPoints(t *testing.T) {
+	store := NewStore(time.Hour)
+	start := time.Now().Add(-30 * time.Minute)
+	var samples []Sample
+	for i := 0; i < maxPoints+15; i++ {
+		samples = append(samples, sampleAt("queue_length", "mail", float64(i), start.Add(time.Duration(i)*time.Second)))
+	}
+	if err := store.Add("shop", samples); err != nil {
+		t.Fatal(err)
+	}
+
+	current := store.namespaces["shop"][seriesKey("queue_length", map[string]string{"queue": "mail"})]
+	if len(current.points) != maxPoints {
+		t.Fatalf("%d points kept, expected %d", len(current.points), maxPoints)
+	}
+	if first := current.points[0].value; first != 15 {
+		t.Errorf("oldest point %v kept, expected 15", first)
+	}
+}
+
+func TestStoreBoundsSeries(t *testing.T) {
+	store := NewStore(time.Minute)
+	now := time.Now().Add(-time.Second)
+	samples := make([]Sample, 0, maxSeries)
+	for i := 0; i < maxSeries-1; i++ {
+		samples = append(samples, sampleAt("queue_length", fmt.Sprintf("q%d", i), 1, now))
+	}
+	if err := store.Add("shop", samples); err != nil {
+		t.Fatal(err)
+	}
+
+	// A batch exceeding the limit is rejected without storing any of its samples
+	err := store.Add("shop", []Sample{
+		sampleAt("queue_length", "q0", 2, now.Add(time.Millisecond)),
+		sampleAt("queue_length", "new1", 1, now),
+		sampleAt("queue_length", "new2", 1, now),
+	})
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatalf("Add() = %v, expected the series limit to be exceeded", err)
+	}
+	values := latestValues(store, "shop", "queue_length", labels.Everything())
+	if len(values) != maxSeries-1 || values["q0"] != 1 {
+		t.Fatalf("rejected batch was partially stored: %d series, q0 = %v", len(values), values["q0"])
+	}
+
+	// Samples of the same new series count once, existing series can still be updated
+	err = store.Add("shop", []Sample{
+		sampleAt("queue_length", "q0", 2, now.Add(time.Millisecond)),
+		sampleAt("queue_length", "new1", 1, now),
+		sampleAt("queue_length", "new1", 2, now.Add(time.Millisecond)),
+	})
+	if err != nil {
+		t.Fatalf("batch filling the namespace rejected: %v", err)
+	}
+	if err := store.Add("shop", []Sample{sampleAt("queue_length", "q0", 3, now.Add(2*time.Millisecond))}); err != nil {
+		t.Errorf("update of a full namespace rejected: %v", err)
+	}
+	if err := store.Add("other", []Sample{sampleAt("queue_length", "new2", 1, now)}); err != nil {
+		t.Errorf("limit applied across namespaces: %v", err)
+	}
+}
+
+func TestStoreBoundsNamespaces(t *testing.T) {
+	store := NewStore(time.Minute)
+	now := time.Now().Add(-time.Second)
+	for i := 0; i < maxNamespaces; i++ {
+		if err := store.Add(fmt.Sprintf("ns%d", i), []Sample{sampleAt("queue_length", "mail", 1, now)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := store.Add("shop", []Sample{sampleAt("queue_length", "mail", 1, now)})
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatalf("Add() = %v, expected the namespace limit to be exceeded", err)
+	}
+	if err := store.Add("ns0", []Sample{sampleAt("queue_length", "print", 1, now)}); err != nil {
+		t.Errorf("series added to a known namespace of a full store rejected: %v", err)
+	}
+	// Batches without samples to keep do not occupy a namespace
+	if err := store.Add("shop", []Sample{sampleAt("queue_length", "mail", 1, now.Add(-time.Hour))}); err != nil {
+		t.Errorf("batch of expired samples rejected: %v", err)
+	}
+	if _, exists := store.namespaces["shop"]; exists || len(store.namespaces) != maxNamespaces {
+		t.Errorf("%d namespaces stored", len(store.namespaces))
+	}
+
+	store.mutex.Lock()
+	store.namespaces["ns1"][seriesKey("queue_length", map[string]string{"queue": "mail"})].points[0].timestamp = now.Add(-time.Hour)
+	store.mutex.Unlock()
+	store.Expire()
+	if err := store.Add("shop", []Sample{sampleAt("queue_length", "mail", 1, now)}); err != nil {
+		t.Errorf("namespace rejected after another one expired: %v", err)
+	}
+}
+
+func TestStoreExpire(t *testing.T) {
+	store := NewStore(time.Minute)
+	now := time.Now()
+	store.Add("shop", []Sample{
+		sampleAt("queue_length", "mail", 1, now.Add(-50*time.Second)),
+		sampleAt("queue_length", "mail", 2, now.Add(-5*time.Second)),
+		sampleAt("queue_length", "print", 3, now.Add(-50*time.Second)),
+	})
+	store.Add("office", []Sample{sampleAt("queue_length", "fax", 1, now.Add(-50*time.Second))})
+
+	store.ttl = 30 * time.Second
+	store.Expire()
+
+	if _, exists := store.namespaces["office"]; exists {
+		t.Error("namespace without series not removed")
+	}
+	stored := store.namespaces["shop"]
+	if len(stored) != 1 {
+		t.Fatalf("%d series kept, expected 1", len(stored))
+	}
+	if current := stored[seriesKey("queue_length", map[string]string{"queue": "mail"})]; current == nil || len(current.points) != 1 || current.points[0].value != 2 {
+		t.Errorf("series %+v, expected the recent point only", current)
+	}
+}
+
+func TestSeriesKey(t *testing.T) {
+	a := seriesKey("queue_length", map[string]string{"queue": "mail", "zone": "a"})
+	b := seriesKey("queue_length", map[string]string{"zone": "a", "queue": "mail"})
+	if a != b {
+		t.Errorf("keys %q and %q differ by label order", a, b)
+	}
+	// Quoting keeps values containing separators apart
+	c := seriesKey("queue_length", map[string]string{"queue": `mail",zone="a`})
+	if a == c {
+		t.Errorf("keys of different series collide: %q", a)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAggregation combines the series of rules that do not name an aggregation. It takes the first series like
+// the controller did before series were aggregated, so existing rules keep their behaviour.
+const DefaultAggregation = "first"
+
+// ValidateAggregation checks an aggregation name: first, avg, sum, min, max, median, count or a percentile pN with N
+// between 0 and 100.
+func ValidateAggregation(aggregation string) error {
+	switch aggregation {
+	case "first", "avg", "sum", "min", "max", "median", "count":
+		return nil
+	}
+	if _, err := percentile(aggregation); err != nil {
+		return err
+	}
+	return nil
+}
+
+// percentilePattern matches the percentiles the CRD accepts, ParseFloat alone would also accept NaN, Inf or hex floats.
+var percentilePattern = regexp.MustCompile(`^p(100|[0-9]{1,2}(\.[0-9]+)?)$`)
+
+func percentile(aggregation string) (float64, error) {
+	if !strings.HasPrefix(aggregation, "p") {
+		return 0, fmt.Errorf("unknown aggregation %q", aggregation)
+	}
+	if !percentilePattern.MatchString(aggregation) {
+		return 0, fmt.Errorf("invalid percentile %q", aggregation)
+	}
+	n, err := strconv.ParseFloat(aggregation[1:], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid percentile %q", aggregation)
+	}
+	return n, nil
+}
+
+// quantile interpolates linearly between the closest ranks of the sorted values.
+func quantile(sorted []float64, q float64) float64 {
+	position := q * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	upper := int(math.Ceil(position))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(position-float64(lower))
+}
+
+// Aggregate combines the values of all series into one. The timestamp of the result is the one of the oldest
+// sample, so it is never more recent than the data it is based on.
+func Aggregate(samples []Sample, aggregation string) (resource.Quantity, time.Time, error) {
+	if aggregation == "count" {
+		timestamp := time.Now()
+		for _, sample := range samples {
+			if sample.Timestamp.Before(timestamp) {
+				timestamp = sample.Timestamp
+			}
+		}
+		return *resource.NewQuantity(int64(len(samples)), resource.DecimalSI), timestamp, nil
+	}
+	if len(samples) == 0 {
+		return resource.Quantity{}, time.Time{}, fmt.Errorf("no series to aggregate")
+	}
+	if len(samples) == 1 || aggregation == "first" {
+		return samples[0].Value, samples[0].Timestamp, nil
+	}
+
+	values := make([]float64, 0, len(samples))
+	timestamp := samples[0].Timestamp
+	var sum float64
+	for _, sample := range samples {
+		value := float64(sample.Value.MilliValue()) / 1000
+		values = append(values, value)
+		sum += value
+		if sample.Timestamp.Before(timestamp) {
+			timestamp = sample.Timestamp
+		}
+	}
+	sort.Float64s(values)
+
+	var result float64
+	switch aggregation {
+	case "avg":
+		result = sum / float64(len(values))
+	case "sum":
+		result = sum
+	case "min":
+		result = values[0]
+	case "max":
+		result = values[len(values)-1]
+	case "median":
+		result = quantile(values, 0.5)
+	default:
+		n, err := percentile(aggregation)
+		if err != nil {
+			return resource.Quantity{}, time.Time{}, err
+		}
+		result = quantile(values, n/100)
+	}
+	return floatQuantity(result), timestamp, nil
+}
@@ -0,0 +1,115 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func samplesOf(values ...float64) []Sample {
+	base := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	samples := make([]Sample, len(values))
+	for i, value := range values {
+		// The second series is the oldest
+		offset := time.Duration(i) * time.Second
+		if i == 1 {
+			offset = -time.Minute
+		}
+		samples[i] = Sample{Value: floatQuantity(value), Timestamp: base.Add(offset)}
+	}
+	return samples
+}
+
+func TestAggregate(t *testing.T) {
+	values := samplesOf(4, 1, 3, 2, 10)
+	for _, test := range []struct {
+		aggregation string
+		samples     []Sample
+		expected    float64
+	}{
+		{"first", values, 4},
+		{DefaultAggregation, values, 4},
+		{"avg", values, 4},
+		{"sum", values, 20},
+		{"min", values, 1},
+		{"max", values, 10},
+		{"median", values, 3},
+		{"median", samplesOf(4, 1, 3, 2), 2.5},
+		{"count", values, 5},
+		{"count", nil, 0},
+		{"p0", values, 1},
+		{"p100", values, 10},
+		{"p50", values, 3},
+		{"p90", values, 7.6},
+		{"p95", samplesOf(1, 2), 1.95},
+		{"p99.9", samplesOf(0, 1000), 999},
+		{"max", samplesOf(0.0015, 0.001), 0.002},
+		{"avg", samplesOf(7), 7},
+		{"p95", samplesOf(7), 7},
+	} {
+		value, timestamp, err := Aggregate(test.samples, test.aggregation)
+		if err != nil {
+			t.Errorf("%s: %v", test.aggregation, err)
+			continue
+		}
+		if got := float64(value.MilliValue()) / 1000; math.Abs(got-test.expected) > 0.0005 {
+			t.Errorf("%s of %d series = %v, expected %v", test.aggregation, len(test.samples), got, test.expected)
+		}
+		// The result is as old as the oldest series it is based on, the first series only on itself
+		switch {
+		case len(test.samples) == 0:
+		case test.aggregation == "first" || test.aggregation == DefaultAggregation || len(test.samples) == 1:
+			if !timestamp.Equal(test.samples[0].Timestamp) {
+				t.Errorf("%s: timestamp %v, expected the one of the first series", test.aggregation, timestamp)
+			}
+		default:
+			if !timestamp.Equal(test.samples[1].Timestamp) {
+				t.Errorf("%s: timestamp %v, expected the oldest", test.aggregation, timestamp)
+			}
+		}
+	}
+}
+
+func TestAggregateErrors(t *testing.T) {
+	if _, _, err := Aggregate(nil, "avg"); err == nil {
+		t.Errorf("aggregated no series")
+	}
+	for _, aggregation := range []string{"p101", "p-1", "pNaN", "pInf", "p+Inf", "p0x1p4"} {
+		if _, _, err := Aggregate(samplesOf(1, 2), aggregation); err == nil {
+			t.Errorf("aggregated with invalid percentile %q", aggregation)
+		}
+	}
+}
+
+func TestValidateAggregation(t *testing.T) {
+	for aggregation, valid := range map[string]bool{
+		"first": true, "avg": true, "sum": true, "min": true, "max": true, "median": true, "count": true,
+		"p0": true, "p50": true, "p99.9": true, "p100": true,
+		"": false, "mean": false, "p": false, "p-1": false, "p101": false, "p100.5": false, "pfifty": false, "P95": false,
+		"pNaN": false, "pnan": false, "pInf": false, "p+Inf": false, "p1e1": false, "p0x1p4": false, "p 50": false, "p50.": false,
+	} {
+		if err := ValidateAggregation(aggregation); (err == nil) != valid {
+			t.Errorf("ValidateAggregation(%q) = %v, expected valid %v", aggregation, err, valid)
+		}
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	sorted := []float64{10, 20, 30, 40}
+	for q, expected := range map[float64]float64{0: 10, 1: 40, 0.5: 25, 0.25: 17.5, 1.0 / 3: 20, 0.9: 37} {
+		if got := quantile(sorted, q); math.Abs(got-expected) > 1e-9 {
+			t.Errorf("quantile(%v) = %v, expected %v", q, got, expected)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"context"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyedSource is implemented by sources whose result depends on more of the query than the namespace, metric and
+// selector, e.g. on the target. The returned string is added to the cache key.
+type KeyedSource interface {
+	CacheKey(query Query) string
+}
+
+// Rebalancer is implemented by sources whose cached result is completed per query, e.g. with the thresholds of the
+// rule. The samples passed are a copy of the cached ones.
+type Rebalancer interface {
+	Rebalance(query Query, samples []Sample) ([]Sample, error)
+}
+
+// call is a fetch in flight, concurrent requests for the same key wait for it instead of fetching again.
+type call struct {
+	done    chan struct{}
+	samples []Sample
+	err     error
+}
+
+type cacheEntry struct {
+	samples []Sample
+	expires time.Time
+}
+
+// Cache shares fetched metrics between the rules of all targets for a short time, so rules using the same metric
+// cause a single request per interval. Errors are not cached.
+type Cache struct {
+	mutex    sync.Mutex
+	entries  map[string]cacheEntry
+	inflight map[string]*call
+}
+
+func NewCache() *Cache {
+	return &Cache{entries: make(map[string]cacheEntry), inflight: make(map[string]*call)}
+}
+
+var sharedCache = NewCache()
+
+// Fetch queries the source through the shared cache.
+func Fetch(ctx context.Context, source MetricSource, query Query) ([]Sample, error) {
+	return sharedCache.Fetch(ctx, source, query)
+}
+
+// cacheKey identifies the result of a query by source, namespace, metric and selector. Rules of different targets
+// share it unless the source adds the target through KeyedSource.
+func cacheKey(source MetricSource, query Query) (string, error) {
+	selector, err := query.MetricSelector()
+	if err != nil {
+		return "", NewError(ErrorInvalid, source.Name(), err)
+	}
+	key := strings.Join([]string{source.Name(), query.Namespace, query.Metric, selector}, "|")
+	if keyed, ok := source.(KeyedSource); ok {
+		key += "|" + keyed.CacheKey(query)
+	}
+	return key, nil
+}
+
+// targetKey is the part of the cache key of sources reading the target's pods.
+func targetKey(target util.Target) string {
+	return strings.Join([]string{target.Kind, target.Namespace, target.Name}, "|")
+}
+
+// Fetch returns the cached samples of the query if they did not expire yet. Otherwise the source is queried once,
+// callers asking for the same key meanwhile share the result.
+func (c *Cache) Fetch(ctx context.Context, source MetricSource, query Query) ([]Sample, error) {
+	key, err := cacheKey(source, query)
+	if err != nil {
+		return nil, err
+	}
+	ttl := time.Duration(currentSettings().CacheTTL) * time.Second
+
+	c.mutex.Lock()
+	now := time.Now()
+	if entry, cached := c.entries[key]; cached && now.Before(entry.expires) {
+		c.mutex.Unlock()
+		log.Debugf("Using cached metric %s", key)
+		return rebalance(source, query, copySamples(entry.samples), nil)
+	}
+	if pending, running := c.inflight[key]; running {
+		c.mutex.Unlock()
+		log.Debugf("Waiting for pending request of metric %s", key)
+		select {
+		case <-pending.done:
+			return rebalance(source, query, copySamples(pending.samples), pending.err)
+		case <-ctx.Done():
+			return nil, NewError(ErrorTransient, source.Name(), fmt.Errorf("metric %s: %v", query.Metric, ctx.Err()))
+		}
+	}
+	pending := &call{done: make(chan struct{})}
+	c.inflight[key] = pending
+	c.mutex.Unlock()
+
+	pending.samples, pending.err = source.Fetch(ctx, query)
+
+	c.mutex.Lock()
+	delete(c.inflight, key)
+	if pending.err == nil && ttl > 0 {
+		c.expire(now)
+		c.entries[key] = cacheEntry{samples: pending.samples, expires: time.Now().Add(ttl)}
+	}
+	c.mutex.Unlock()
+	close(pending.done)
+
+	return rebalance(source, query, copySamples(pending.samples), pending.err)
+}
+
+// rebalance completes the samples of the query if the source is a Rebalancer.
+func rebalance(source MetricSource, query Query, samples []Sample, err error) ([]Sample, error) {
+	if rebalancer, ok := source.(Rebalancer); ok && err == nil {
+		return rebalancer.Rebalance(query, samples)
+	}
+	return samples, err
+}
+
+// expire removes entries that expired before the given time. The lock has to be held.
+func (c *Cache) expire(now time.Time) {
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// copySamples protects the cached samples from callers modifying their result, including their labels.
+func copySamples(samples []Sample) []Sample {
+	if samples == nil {
+		return nil
+	}
+	copied := make([]Sample, len(samples))
+	for i, sample := range samples {
+		copied[i] = sample
+		copied[i].Value = sample.Value.DeepCopy()
+		if sample.Labels != nil {
+			copied[i].Labels = make(map[string]string, len(sample.Labels))
+			for name, value := range sample.Labels {
+				copied[i].Labels[name] = value
+			}
+		}
+	}
+	return copied
+}
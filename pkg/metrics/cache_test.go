@@ -0,0 +1,140 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"context"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingSource struct {
+	fetches int32
+	delay   time.Duration
+}
+
+func (s *countingSource) Name() string {
+	return "counting"
+}
+
+func (s *countingSource) Fetch(ctx context.Context, query Query) ([]Sample, error) {
+	atomic.AddInt32(&s.fetches, 1)
+	time.Sleep(s.delay)
+	return []Sample{{Value: floatQuantity(1), Timestamp: time.Now(), Labels: map[string]string{"name": "web"}}}, nil
+}
+
+func testQuery(metric string) Query {
+	return Query{Rule: &v1.AutoscalingRule{}, Namespace: "shop", Metric: metric, Target: util.Target{Kind: "Deployment", Namespace: "shop", Name: "web"}}
+}
+
+func TestCacheSharesResults(t *testing.T) {
+	Configure(config.Default().Metrics)
+	cache := NewCache()
+	source := &countingSource{delay: 20 * time.Millisecond}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.Fetch(context.Background(), source, testQuery("requests")); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := cache.Fetch(context.Background(), source, testQuery("requests")); err != nil {
+		t.Fatal(err)
+	}
+	if fetches := atomic.LoadInt32(&source.fetches); fetches != 1 {
+		t.Errorf("%d fetches for concurrent and cached requests, expected 1", fetches)
+	}
+
+	if _, err := cache.Fetch(context.Background(), source, testQuery("latency")); err != nil {
+		t.Fatal(err)
+	}
+	if fetches := atomic.LoadInt32(&source.fetches); fetches != 2 {
+		t.Errorf("other metric served from the cache")
+	}
+}
+
+func TestCacheCopiesSamples(t *testing.T) {
+	Configure(config.Default().Metrics)
+	cache := NewCache()
+	source := &countingSource{}
+
+	samples, err := cache.Fetch(context.Background(), source, testQuery("requests"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples[0].Labels["name"] = "modified"
+	samples[0].Labels["added"] = "label"
+	samples[0].Value.Add(floatQuantity(5))
+
+	cached, err := cache.Fetch(context.Background(), source, testQuery("requests"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached[0].Labels["name"] != "web" || len(cached[0].Labels) != 1 {
+		t.Errorf("cached labels modified by caller: %v", cached[0].Labels)
+	}
+	if cached[0].Value.MilliValue() != 1000 {
+		t.Errorf("cached value modified by caller: %v", cached[0].Value.String())
+	}
+}
+
+func TestCacheKeyTargets(t *testing.T) {
+	perPod := func(query Query) Query {
+		query.Rule = query.Rule.DeepCopy()
+		query.Rule.Spec.PerPod = true
+		return query
+	}
+	document := &v1.HTTPSource{URL: "http://stats/queue"}
+	targetURL := &v1.HTTPSource{URL: "http://stats/{{.Target.Name}}/queue"}
+
+	tests := []struct {
+		name   string
+		source MetricSource
+		query  Query
+		shared bool
+	}{
+		{"resource", NewResourceSource(nil), testQuery("cpu"), false},
+		{"prometheus", NewPrometheusSource(), testQuery("sum(queue_length)"), true},
+		{"prometheus template of the target", NewPrometheusSource(), testQuery(`sum(queue_length{app="{{.Target.Name}}"})`), false},
+		{"external", NewExternalSource(nil), testQuery("queue_length"), true},
+		{"custom objects", NewCustomSource(nil, nil), testQuery("queue_length"), true},
+		{"custom per pod", NewCustomSource(nil, nil), perPod(testQuery("queue_length")), false},
+		{"http document", NewHTTPSource(nil), httpQuery("$.queue", document), true},
+		{"http url of the target", NewHTTPSource(nil), httpQuery("$.queue", targetURL), false},
+		{"http per pod", NewHTTPSource(nil), perPod(httpQuery("$.queue", document)), false},
+	}
+	for _, test := range tests {
+		other := test.query
+		other.Target = util.Target{Kind: "Deployment", Namespace: "shop", Name: "checkout"}
+		key, err := cacheKey(test.source, test.query)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		otherKey, err := cacheKey(test.source, other)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if (key == otherKey) != test.shared {
+			t.Errorf("%s: keys %q and %q of different targets, expected shared %v", test.name, key, otherKey, test.shared)
+		}
+	}
+}
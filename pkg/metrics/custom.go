@@ -0,0 +1,149 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sync"
+	"time"
+)
+
+// CustomName is the name of the source reading the custom metrics API.
+const CustomName = "custom"
+
+var (
+	settingsMutex sync.RWMutex
+	settings      = config.Default().Metrics
+)
+
+// customMetricList is the part of a custom.metrics.k8s.io MetricValueList the source works with.
+type customMetricList struct {
+	Items []struct {
+		DescribedObject struct {
+			Kind      string `json:"kind"`
+			Namespace string `json:"namespace"`
+			Name      string `json:"name"`
+		} `json:"describedObject"`
+		Timestamp  time.Time `json:"timestamp"`
+		MetricName string    `json:"metricName"`
+		Value      string    `json:"value"`
+	} `json:"items"`
+}
+
+// Configure sets the custom metrics API path and the described objects to query.
+func Configure(metricsConfig config.MetricsConfig) {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	settings = metricsConfig
+}
+
+func currentSettings() config.MetricsConfig {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+	return settings
+}
+
+type customSource struct {
+	client        rest.Interface
+	kubeclientset kubernetes.Interface
+	podValues     *podValues
+}
+
+// NewCustomSource reads metrics of the configured objects in the rule's target namespace from the custom metrics
+// API. Rules reading per pod metrics get the metrics of the ready pods of their target instead.
+func NewCustomSource(client rest.Interface, kubeclientset kubernetes.Interface) MetricSource {
+	return &customSource{client: client, kubeclientset: kubeclientset, podValues: newPodValues()}
+}
+
+// CacheKey separates per pod metrics, which are read for the target, from the metrics of the configured objects.
+func (s *customSource) CacheKey(query Query) string {
+	if query.Rule.Spec.PerPod {
+		return "pods|" + targetKey(query.Target)
+	}
+	return ""
+}
+
+func (s *customSource) Name() string {
+	return CustomName
+}
+
+func (s *customSource) Fetch(ctx context.Context, query Query) ([]Sample, error) {
+	selector, err := query.MetricSelector()
+	if err != nil {
+		return nil, NewError(ErrorInvalid, CustomName, err)
+	}
+
+	settings := currentSettings()
+	var (
+		request *rest.Request
+		ready   map[string]corev1.Pod
+	)
+	if query.Rule.Spec.PerPod {
+		podSelector, pods, err := readyPods(s.kubeclientset, CustomName, query.Target)
+		if err != nil {
+			return nil, err
+		}
+		if len(pods) == 0 {
+			return nil, NewError(ErrorNotFound, CustomName, fmt.Errorf("no ready pods of %s %s/%s", query.Target.Kind, query.Target.Namespace, query.Target.Name))
+		}
+		ready = pods
+		request = s.client.Get().AbsPath(settings.CustomMetricsPath, "namespaces", query.Target.Namespace, "pods/*", query.Metric).
+			Param("labelSelector", podSelector.String())
+	} else {
+		request = s.client.Get().AbsPath(settings.CustomMetricsPath, "namespaces", query.Namespace, settings.ObjectSelector, query.Metric)
+	}
+	if selector != "" {
+		request = request.Param("metricLabelSelector", selector)
+	}
+	data, err := request.Context(ctx).DoRaw()
+	if err != nil {
+		return nil, classify(CustomName, err)
+	}
+
+	var list customMetricList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, NewError(ErrorTransient, CustomName, fmt.Errorf("could not decode metric %s: %v", query.Metric, err))
+	}
+
+	samples := make([]Sample, 0, len(list.Items))
+	for _, item := range list.Items {
+		if _, isReady := ready[item.DescribedObject.Name]; ready != nil && !isReady {
+			// Pods that are not ready or terminating
+			continue
+		}
+		value, err := resource.ParseQuantity(item.Value)
+		if err != nil {
+			return nil, NewError(ErrorInvalid, CustomName, fmt.Errorf("could not parse metric %s: %v", query.Metric, err))
+		}
+		samples = append(samples, Sample{Value: value, Timestamp: item.Timestamp, Labels: map[string]string{
+			"kind":      item.DescribedObject.Kind,
+			"namespace": item.DescribedObject.Namespace,
+			"name":      item.DescribedObject.Name,
+		}})
+	}
+
+	if ready != nil {
+		for _, sample := range samples {
+			log.Debugf("Metric %s of pod %s/%s: %v", query.Metric, query.Target.Namespace, sample.Labels["name"], sample.Value.String())
+		}
+		s.podValues.export(query.Target, query.Metric, samples)
+	}
+	return samples, nil
+}
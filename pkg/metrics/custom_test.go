@@ -0,0 +1,74 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"context"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// podMetricList is a custom metrics MetricValueList of the given pods.
+func podMetricList(metric string, names ...string) map[string]interface{} {
+	items := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		items = append(items, map[string]interface{}{
+			"describedObject": map[string]string{"kind": "Pod", "namespace": "shop", "name": name},
+			"timestamp":       time.Now().UTC().Format(time.RFC3339),
+			"metricName":      metric,
+			"value":           "10",
+		})
+	}
+	return map[string]interface{}{"items": items}
+}
+
+func TestCustomSourcePerPod(t *testing.T) {
+	Configure(config.Default().Metrics)
+	terminating := testPod("web-c", "", true)
+	deleted := metav1.Now()
+	terminating.DeletionTimestamp = &deleted
+	pending := testPod("web-d", "", false)
+	pending.Status.Phase = corev1.PodPending
+	pods := []corev1.Pod{testPod("web-a", "", true), testPod("web-b", "", false), terminating, pending, testPod("web-e", "", true)}
+
+	// The pods of the target report metrics before they are ready and until they are gone
+	metrics := podMetricList("queue_length", "web-a", "web-b", "web-c", "web-d", "web-e")
+	clientset := newPodServer(t, pods, map[string]interface{}{"/apis/custom.metrics.k8s.io/v1beta1/namespaces/shop/pods/*/queue_length": metrics})
+	source := NewCustomSource(clientset.Discovery().RESTClient(), clientset)
+
+	query := testQuery("queue_length")
+	query.Rule.Spec.PerPod = true
+	samples, err := source.Fetch(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, sample := range samples {
+		names = append(names, sample.Labels["name"])
+	}
+	sort.Strings(names)
+	if expected := []string{"web-a", "web-e"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("got samples of the pods %v, expected %v", names, expected)
+	}
+
+	unready := newPodServer(t, []corev1.Pod{testPod("web-b", "", false), terminating, pending}, map[string]interface{}{
+		"/apis/custom.metrics.k8s.io/v1beta1/namespaces/shop/pods/*/queue_length": metrics,
+	})
+	if _, err := NewCustomSource(unready.Discovery().RESTClient(), unready).Fetch(context.Background(), query); !IsNotFound(err) {
+		t.Errorf("expected not found without ready pods, got %v", err)
+	}
+}
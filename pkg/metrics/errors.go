@@ -0,0 +1,84 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ErrorKind classifies why a metric could not be retrieved.
+type ErrorKind string
+
+const (
+	// ErrorTransient errors may disappear with the next attempt, e.g. timeouts or unavailable backends
+	ErrorTransient ErrorKind = "transient"
+	// ErrorNotFound is returned if the backend does not know the metric or has no series for it
+	ErrorNotFound ErrorKind = "not found"
+	// ErrorStale is returned if all series are older than the maximum metric age of the rule
+	ErrorStale ErrorKind = "stale"
+	// ErrorInvalid errors persist until the rule or configuration is fixed
+	ErrorInvalid ErrorKind = "invalid"
+)
+
+type Error struct {
+	Kind   ErrorKind
+	Source string
+	Err    error
+}
+
+func NewError(kind ErrorKind, source string, err error) *Error {
+	return &Error{Kind: kind, Source: source, Err: err}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%s, source %s)", e.Err, e.Kind, e.Source)
+}
+
+// Kind returns the classification of an error returned by a source, unclassified errors are considered transient.
+func Kind(err error) ErrorKind {
+	if e, ok := err.(*Error); ok {
+		return e.Kind
+	}
+	return ErrorTransient
+}
+
+func IsTransient(err error) bool {
+	return Kind(err) == ErrorTransient
+}
+
+func IsNotFound(err error) bool {
+	return Kind(err) == ErrorNotFound
+}
+
+func IsStale(err error) bool {
+	return Kind(err) == ErrorStale
+}
+
+func IsInvalid(err error) bool {
+	return Kind(err) == ErrorInvalid
+}
+
+// classify wraps an error of a request against the Kubernetes API.
+func classify(source string, err error) error {
+	switch {
+	case err == context.DeadlineExceeded || err == context.Canceled:
+		return NewError(ErrorTransient, source, err)
+	case errors.IsNotFound(err):
+		return NewError(ErrorNotFound, source, err)
+	case errors.IsBadRequest(err), errors.IsForbidden(err), errors.IsUnauthorized(err), errors.IsInvalid(err), errors.IsMethodNotSupported(err):
+		return NewError(ErrorInvalid, source, err)
+	default:
+		return NewError(ErrorTransient, source, err)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/rest"
+	"time"
+)
+
+// ExternalName is the name of the source reading the external metrics API, e.g. queue depths or cloud metrics.
+const ExternalName = "external"
+
+// externalMetricList is the part of an external.metrics.k8s.io ExternalMetricValueList the source works with.
+type externalMetricList struct {
+	Items []struct {
+		MetricName   string            `json:"metricName"`
+		MetricLabels map[string]string `json:"metricLabels"`
+		Timestamp    time.Time         `json:"timestamp"`
+		Value        string            `json:"value"`
+	} `json:"items"`
+}
+
+type externalSource struct {
+	client rest.Interface
+}
+
+// NewExternalSource reads metrics of the rule's target namespace from the external metrics API, restricted by the
+// metric selectors of the rule.
+func NewExternalSource(client rest.Interface) MetricSource {
+	return &externalSource{client: client}
+}
+
+func (s *externalSource) Name() string {
+	return ExternalName
+}
+
+func (s *externalSource) Fetch(ctx context.Context, query Query) ([]Sample, error) {
+	selector, err := query.MetricSelector()
+	if err != nil {
+		return nil, NewError(ErrorInvalid, ExternalName, err)
+	}
+
+	request := s.client.Get().AbsPath(currentSettings().ExternalMetricsPath, "namespaces", query.Namespace, query.Metric)
+	if selector != "" {
+		request = request.Param("labelSelector", selector)
+	}
+	data, err := request.Context(ctx).DoRaw()
+	if err != nil {
+		return nil, classify(ExternalName, err)
+	}
+
+	var list externalMetricList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, NewError(ErrorTransient, ExternalName, fmt.Errorf("could not decode metric %s: %v", query.Metric, err))
+	}
+
+	samples := make([]Sample, 0, len(list.Items))
+	for _, item := range list.Items {
+		value, err := resource.ParseQuantity(item.Value)
+		if err != nil {
+			return nil, NewError(ErrorInvalid, ExternalName, fmt.Errorf("could not parse metric %s: %v", query.Metric, err))
+		}
+		samples = append(samples, Sample{Value: value, Timestamp: item.Timestamp, Labels: item.MetricLabels})
+	}
+	return samples, nil
+}
@@ -0,0 +1,112 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newExternalServer emulates the external metrics API serving the metric queue_length of the namespace shop for the
+// queues orders and payments. Like the API it only returns the series matching the label selector.
+func newExternalServer(t *testing.T) rest.Interface {
+	series := []map[string]string{{"queue": "orders", "tier": "gold"}, {"queue": "payments", "tier": "gold"}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+		if r.URL.Path != "/apis/external.metrics.k8s.io/v1beta1/namespaces/shop/queue_length" || err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		items := []map[string]interface{}{}
+		for i, metricLabels := range series {
+			if selector.Matches(labels.Set(metricLabels)) {
+				items = append(items, map[string]interface{}{
+					"metricName":   "queue_length",
+					"metricLabels": metricLabels,
+					"timestamp":    time.Now().UTC().Format(time.RFC3339),
+					"value":        []string{"12", "30"}[i],
+				})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+	}))
+	t.Cleanup(server.Close)
+
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientset.Discovery().RESTClient()
+}
+
+func TestExternalSourceSelectors(t *testing.T) {
+	Configure(config.Default().Metrics)
+	source := NewExternalSource(newExternalServer(t))
+	orders := &metav1.LabelSelector{MatchLabels: map[string]string{"queue": "orders"}}
+	payments := &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+		{Key: "queue", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"orders"}},
+	}}
+
+	tests := []struct {
+		name          string
+		selector      *metav1.LabelSelector
+		deltaSelector *metav1.LabelSelector
+		delta         bool
+		queues        string
+	}{
+		{"all series", nil, nil, false, "orders=12,payments=30"},
+		{"matching labels", orders, nil, false, "orders=12"},
+		{"matching expressions", payments, nil, false, "payments=30"},
+		{"delta with the metric selector", orders, nil, true, "orders=12"},
+		{"delta with its own selector", orders, payments, true, "payments=30"},
+		{"delta selector only applies to the delta", orders, payments, false, "orders=12"},
+	}
+	for _, test := range tests {
+		query := testQuery("queue_length")
+		query.Rule.Spec.MetricSelector, query.Rule.Spec.DeltaMetricSelector = test.selector, test.deltaSelector
+		query.Delta = test.delta
+		samples, err := source.Fetch(context.Background(), query)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var queues []string
+		for _, sample := range samples {
+			queues = append(queues, sample.Labels["queue"]+"="+sample.Value.String())
+		}
+		sort.Strings(queues)
+		if strings.Join(queues, ",") != test.queues {
+			t.Errorf("%s: got %v, expected %s", test.name, queues, test.queues)
+		}
+	}
+
+	invalid := testQuery("queue_length")
+	invalid.Rule.Spec.MetricSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "queue", Operator: "Near"}}}
+	if _, err := source.Fetch(context.Background(), invalid); !IsInvalid(err) {
+		t.Errorf("expected an invalid selector to be rejected, got %v", err)
+	}
+	if _, err := source.Fetch(context.Background(), testQuery("queue_age")); !IsNotFound(err) {
+		t.Errorf("expected an unknown metric not to be found, got %v", err)
+	}
+}
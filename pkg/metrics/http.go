@@ -0,0 +1,380 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"io"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// HTTPName is the name of the source scraping JSON documents, e.g. the statistics of services without Prometheus
+// metrics. The metric names of rules using it are JSONPath expressions selecting numbers, numeric strings or
+// booleans from the document configured by the rule's http settings.
+const HTTPName = "http"
+
+// maxDocumentSize limits the size of scraped documents.
+const maxDocumentSize = 4 << 20
+
+// urlData are the variables available in URL templates.
+type urlData struct {
+	Namespace string
+	Target    util.Target
+	Pod       podData
+}
+
+type podData struct {
+	Name string
+	IP   string
+}
+
+// document is a scraped JSON document. It is shared by the metrics read from it until it expires, concurrent
+// requests wait for the scrape in flight.
+type document struct {
+	done    chan struct{}
+	content interface{}
+	err     error
+	scraped time.Time
+	expires time.Time
+}
+
+type httpSource struct {
+	client        *http.Client
+	kubeclientset kubernetes.Interface
+	podValues     *podValues
+
+	mutex     sync.Mutex
+	documents map[string]*document
+}
+
+// NewHTTPSource scrapes the JSON documents of rules, per ready pod of the target if the rule asks for it. Documents
+// are scraped at most once per cache TTL, however many metrics are read from them. Only the allowed hosts of the
+// configuration and the pods of the target are scraped.
+func NewHTTPSource(kubeclientset kubernetes.Interface) MetricSource {
+	return &httpSource{
+		client:        &http.Client{CheckRedirect: checkRedirect},
+		kubeclientset: kubeclientset,
+		podValues:     newPodValues(),
+		documents:     make(map[string]*document),
+	}
+}
+
+func (s *httpSource) Name() string {
+	return HTTPName
+}
+
+// CacheKey separates rules reading the same path from different documents. The url is rendered, so it includes the
+// target only if its template refers to it, per pod scrapes always do.
+func (s *httpSource) CacheKey(query Query) string {
+	spec := query.Rule.Spec.HTTP
+	if spec == nil {
+		return ""
+	}
+	url, err := renderURL(spec.URL, urlData{Namespace: query.Namespace, Target: query.Target})
+	if err != nil {
+		url = spec.URL
+	}
+	key := url + "|" + headerKey(spec.Headers)
+	if query.Rule.Spec.PerPod {
+		key += "|pods|" + targetKey(query.Target)
+	}
+	return key
+}
+
+func headerKey(headers map[string]string) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+headers[name])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// allowedHost reports whether rules may scrape the host of the URL: one of the allowed hosts or, when scraping
+// per pod, the pod itself.
+func allowedHost(endpoint *url.URL, allowedHosts []string, podIP string) bool {
+	host := strings.ToLower(endpoint.Hostname())
+	if host == "" {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if podIP != "" && ip != nil && ip.Equal(net.ParseIP(podIP)) {
+		return true
+	}
+	for _, allowed := range allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if _, network, err := net.ParseCIDR(allowed); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+		} else if strings.HasPrefix(allowed, "*.") {
+			if strings.HasSuffix(host, allowed[1:]) {
+				return true
+			}
+		} else if host == allowed || (ip != nil && ip.Equal(net.ParseIP(allowed))) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRedirect follows redirects within the host of the request and to the allowed hosts only.
+func checkRedirect(request *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	if request.URL.Host != via[0].URL.Host && !allowedHost(request.URL, currentSettings().HTTP.AllowedHosts, "") {
+		return fmt.Errorf("redirect to host %s is not allowed", request.URL.Host)
+	}
+	return nil
+}
+
+func renderURL(text string, data urlData) (string, error) {
+	tmpl, err := template.New("url").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
+
+func (s *httpSource) Fetch(ctx context.Context, query Query) ([]Sample, error) {
+	spec := query.Rule.Spec.HTTP
+	if spec == nil || spec.URL == "" {
+		return nil, NewError(ErrorInvalid, HTTPName, fmt.Errorf("rule %s has no http url", query.Rule.Name))
+	}
+	path, err := parseJSONPath(query.Metric)
+	if err != nil {
+		return nil, NewError(ErrorInvalid, HTTPName, err)
+	}
+	selectorString, err := query.MetricSelector()
+	if err != nil {
+		return nil, NewError(ErrorInvalid, HTTPName, err)
+	}
+	selector, err := labels.Parse(selectorString)
+	if err != nil {
+		return nil, NewError(ErrorInvalid, HTTPName, err)
+	}
+
+	data := urlData{Namespace: query.Namespace, Target: query.Target}
+	if !query.Rule.Spec.PerPod {
+		return s.scrape(ctx, query, spec, path, selector, data, nil)
+	}
+
+	_, pods, err := readyPods(s.kubeclientset, HTTPName, query.Target)
+	if err != nil {
+		return nil, err
+	}
+	if len(pods) == 0 {
+		return nil, NewError(ErrorNotFound, HTTPName, fmt.Errorf("no ready pods of %s %s/%s", query.Target.Kind, query.Target.Namespace, query.Target.Name))
+	}
+	names := make([]string, 0, len(pods))
+	for name := range pods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([][]Sample, len(names))
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			podData := data
+			podData.Pod.Name, podData.Pod.IP = name, pods[name].Status.PodIP
+			results[i], errs[i] = s.scrape(ctx, query, spec, path, selector, podData,
+				map[string]string{"namespace": query.Target.Namespace, "name": name})
+		}(i, name)
+	}
+	wg.Wait()
+
+	var samples []Sample
+	var lastErr error
+	for i, name := range names {
+		if errs[i] != nil {
+			// A single unreachable pod does not fail the rule, the remaining pods are aggregated
+			log.Warnf("Could not scrape metric %s of pod %s/%s: %v", query.Metric, query.Target.Namespace, name, errs[i])
+			lastErr = errs[i]
+			continue
+		}
+		samples = append(samples, results[i]...)
+	}
+	if len(samples) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	for _, sample := range samples {
+		log.Debugf("Metric %s of pod %s/%s: %v", query.Metric, query.Target.Namespace, sample.Labels["name"], sample.Value.String())
+	}
+	s.podValues.export(query.Target, query.Metric, samples)
+	return samples, nil
+}
+
+// scrape reads the values selected by the path from the document at the rendered URL. The given labels are added
+// to those of the samples.
+func (s *httpSource) scrape(ctx context.Context, query Query, spec *v1.HTTPSource, path jsonPath, selector labels.Selector, data urlData, podLabels map[string]string) ([]Sample, error) {
+	endpoint, err := renderURL(spec.URL, data)
+	if err != nil {
+		return nil, NewError(ErrorInvalid, HTTPName, fmt.Errorf("invalid url template %q: %v", spec.URL, err))
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, NewError(ErrorInvalid, HTTPName, fmt.Errorf("%q is not a http or https URL", endpoint))
+	}
+	if !allowedHost(parsed, currentSettings().HTTP.AllowedHosts, data.Pod.IP) {
+		return nil, NewError(ErrorInvalid, HTTPName, fmt.Errorf("host %s of %s is not allowed by metrics.http.allowedHosts", parsed.Host, endpoint))
+	}
+	content, timestamp, err := s.document(ctx, endpoint, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := path.find(content)
+	if len(matches) == 0 {
+		return nil, NewError(ErrorNotFound, HTTPName, fmt.Errorf("path %s selects nothing in %s", query.Metric, endpoint))
+	}
+	samples := make([]Sample, 0, len(matches))
+	for _, match := range matches {
+		value, err := jsonNumber(match.value)
+		if err != nil {
+			return nil, NewError(ErrorInvalid, HTTPName, fmt.Errorf("%s of %s: %v", match.path, endpoint, err))
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		sampleLabels := map[string]string{"path": match.path}
+		for name, value := range podLabels {
+			sampleLabels[name] = value
+		}
+		if !selector.Matches(labels.Set(sampleLabels)) {
+			continue
+		}
+		samples = append(samples, Sample{Value: floatQuantity(value), Timestamp: timestamp, Labels: sampleLabels})
+	}
+	return samples, nil
+}
+
+// document returns the decoded document at the URL and the time it was scraped, from the documents scraped within
+// the cache TTL if possible. Failed scrapes are not kept.
+func (s *httpSource) document(ctx context.Context, endpoint string, spec *v1.HTTPSource) (interface{}, time.Time, error) {
+	key := endpoint + "|" + headerKey(spec.Headers)
+
+	s.mutex.Lock()
+	now := time.Now()
+	if cached, exists := s.documents[key]; exists {
+		select {
+		case <-cached.done:
+			if cached.err == nil && now.Before(cached.expires) {
+				s.mutex.Unlock()
+				return cached.content, cached.scraped, nil
+			}
+		default:
+			s.mutex.Unlock()
+			select {
+			case <-cached.done:
+				return cached.content, cached.scraped, cached.err
+			case <-ctx.Done():
+				return nil, time.Time{}, NewError(ErrorTransient, HTTPName, fmt.Errorf("scraping %s: %v", endpoint, ctx.Err()))
+			}
+		}
+	}
+	s.expire(now)
+	pending := &document{done: make(chan struct{})}
+	s.documents[key] = pending
+	s.mutex.Unlock()
+
+	pending.content, pending.err = s.get(ctx, endpoint, spec)
+	pending.scraped = time.Now()
+	pending.expires = pending.scraped.Add(time.Duration(currentSettings().CacheTTL) * time.Second)
+	close(pending.done)
+	return pending.content, pending.scraped, pending.err
+}
+
+// expire removes scraped documents that expired before the given time. The lock has to be held.
+func (s *httpSource) expire(now time.Time) {
+	for key, cached := range s.documents {
+		select {
+		case <-cached.done:
+			if cached.err != nil || !now.Before(cached.expires) {
+				delete(s.documents, key)
+			}
+		default:
+		}
+	}
+}
+
+func (s *httpSource) get(ctx context.Context, endpoint string, spec *v1.HTTPSource) (interface{}, error) {
+	timeout := time.Duration(currentSettings().HTTP.Timeout) * time.Second
+	if spec.Timeout != nil && spec.Timeout.Duration > 0 {
+		timeout = spec.Timeout.Duration
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	request, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, NewError(ErrorInvalid, HTTPName, err)
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Accept", "application/json")
+	for name, value := range spec.Headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, NewError(ErrorTransient, HTTPName, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, io.LimitReader(response.Body, maxDocumentSize))
+		return nil, NewError(classifyStatus(response.StatusCode), HTTPName, fmt.Errorf("%s returned status %d", endpoint, response.StatusCode))
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxDocumentSize+1))
+	if err != nil {
+		return nil, NewError(ErrorTransient, HTTPName, err)
+	}
+	if len(body) > maxDocumentSize {
+		return nil, NewError(ErrorInvalid, HTTPName, fmt.Errorf("document at %s exceeds %d bytes", endpoint, maxDocumentSize))
+	}
+
+	var content interface{}
+	if err := json.Unmarshal(body, &content); err != nil {
+		return nil, NewError(ErrorTransient, HTTPName, fmt.Errorf("could not decode document at %s: %v", endpoint, err))
+	}
+	return content, nil
+}
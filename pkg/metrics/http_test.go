@@ -0,0 +1,321 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"context"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// configureHTTP configures the http source to allow the given hosts until the test ends.
+func configureHTTP(t *testing.T, allowedHosts ...string) {
+	metricsConfig := config.Default().Metrics
+	metricsConfig.HTTP.AllowedHosts = allowedHosts
+	Configure(metricsConfig)
+	t.Cleanup(func() { Configure(config.Default().Metrics) })
+}
+
+func httpQuery(metric string, spec *v1.HTTPSource) Query {
+	query := testQuery(metric)
+	query.Rule.Name = "stats"
+	query.Rule.Spec.HTTP = spec
+	return query
+}
+
+func sampleValues(samples []Sample) map[string]int64 {
+	values := make(map[string]int64, len(samples))
+	for _, sample := range samples {
+		values[sample.Labels["name"]+sample.Labels["path"]] = sample.Value.MilliValue()
+	}
+	return values
+}
+
+func TestRenderURL(t *testing.T) {
+	data := urlData{
+		Namespace: "shop",
+		Target:    util.Target{Kind: "Deployment", Namespace: "store", Name: "web"},
+		Pod:       podData{Name: "web-1", IP: "10.1.2.3"},
+	}
+	for _, test := range []struct {
+		template string
+		expected string
+		valid    bool
+	}{
+		{"http://stats.example.com/queue", "http://stats.example.com/queue", true},
+		{"http://{{.Target.Name}}.{{.Target.Namespace}}.svc/{{.Namespace}}/{{.Target.Kind}}", "http://web.store.svc/shop/Deployment", true},
+		{"http://{{.Pod.IP}}:8080/stats?pod={{.Pod.Name}}", "http://10.1.2.3:8080/stats?pod=web-1", true},
+		{"http://{{.Target.Name", "", false},
+		{"http://{{.Service}}/stats", "", false},
+	} {
+		rendered, err := renderURL(test.template, data)
+		if (err == nil) != test.valid || rendered != test.expected {
+			t.Errorf("renderURL(%q) = %q, %v, expected %q and valid %v", test.template, rendered, err, test.expected, test.valid)
+		}
+	}
+}
+
+func TestHTTPCacheKey(t *testing.T) {
+	source := NewHTTPSource(nil).(*httpSource)
+	if key := source.CacheKey(testQuery("$.queue")); key != "" {
+		t.Errorf("cache key %q of a rule without http settings", key)
+	}
+
+	spec := &v1.HTTPSource{URL: "http://stats/queue", Headers: map[string]string{"X-Tenant": "shop", "Accept": "application/json"}}
+	same := &v1.HTTPSource{URL: "http://stats/queue", Headers: map[string]string{"Accept": "application/json", "X-Tenant": "shop"}}
+	otherHeader := &v1.HTTPSource{URL: "http://stats/queue", Headers: map[string]string{"Accept": "application/json", "X-Tenant": "office"}}
+	otherURL := &v1.HTTPSource{URL: "http://stats/jobs", Headers: spec.Headers}
+
+	key := source.CacheKey(httpQuery("$.queue", spec))
+	if key != source.CacheKey(httpQuery("$.queue", same)) {
+		t.Error("cache key depends on the order of the headers")
+	}
+	if key == source.CacheKey(httpQuery("$.queue", otherHeader)) || key == source.CacheKey(httpQuery("$.queue", otherURL)) {
+		t.Error("documents of different requests share a cache key")
+	}
+	perPod := httpQuery("$.queue", spec)
+	perPod.Rule.Spec.PerPod = true
+	if key == source.CacheKey(perPod) {
+		t.Error("per pod scrapes share the cache key of the document")
+	}
+}
+
+func TestAllowedHost(t *testing.T) {
+	allowed := []string{"stats.example.com", "*.svc.cluster.local", "10.0.0.0/8", "192.168.1.5", "fd00::1"}
+	for _, test := range []struct {
+		url      string
+		podIP    string
+		expected bool
+	}{
+		{"http://stats.example.com/queue", "", true},
+		{"https://STATS.example.com:8443/queue", "", true},
+		{"http://other.example.com/queue", "", false},
+		{"http://stats.example.com.evil.net/queue", "", false},
+		{"http://web.shop.svc.cluster.local/stats", "", true},
+		{"http://svc.cluster.local/stats", "", false},
+		{"http://evilsvc.cluster.local/stats", "", false},
+		{"http://10.20.30.40:8080/stats", "", true},
+		{"http://11.0.0.1/stats", "", false},
+		{"http://192.168.1.5/stats", "", true},
+		{"http://192.168.1.6/stats", "", false},
+		{"http://[fd00::1]:8080/stats", "", true},
+		{"http://169.254.169.254/latest/meta-data", "", false},
+		{"http://172.17.0.4:8080/stats", "172.17.0.4", true},
+		{"http://172.17.0.5:8080/stats", "172.17.0.4", false},
+		{"http://localhost/stats", "127.0.0.1", false},
+		{"http:///stats", "", false},
+	} {
+		parsed, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result := allowedHost(parsed, allowed, test.podIP); result != test.expected {
+			t.Errorf("allowedHost(%s, pod %q) = %v, expected %v", test.url, test.podIP, result, test.expected)
+		}
+	}
+	if parsed, _ := url.Parse("http://stats.example.com/queue"); allowedHost(parsed, nil, "") {
+		t.Error("host allowed without allowed hosts")
+	}
+}
+
+func TestHTTPSource(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/shop/web/stats":
+			if r.Header.Get("Accept") != "application/json" || r.Header.Get("X-Tenant") != "shop" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(statsDocument))
+		case "/moved":
+			http.Redirect(w, r, "/shop/web/stats", http.StatusFound)
+		case "/elsewhere":
+			http.Redirect(w, r, strings.Replace(serverURL(r), "127.0.0.1", "localhost", 1)+"/shop/web/stats", http.StatusFound)
+		case "/broken":
+			w.Write([]byte(`{"queue":`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	configureHTTP(t, "127.0.0.1")
+
+	source := NewHTTPSource(nil)
+	spec := &v1.HTTPSource{URL: server.URL + "/{{.Namespace}}/{{.Target.Name}}/stats", Headers: map[string]string{"X-Tenant": "shop"}}
+	samples, err := source.Fetch(context.Background(), httpQuery("$.workers[*].load", spec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values := sampleValues(samples); len(values) != 2 || values["$.workers[0].load"] != 500 || values["$.workers[1].load"] != 1500 {
+		t.Errorf("values %v, expected the load of both workers", values)
+	}
+
+	// Metrics of the same document share a scrape
+	samples, err = source.Fetch(context.Background(), httpQuery("$.queue.age", spec))
+	if err != nil || len(samples) != 1 || samples[0].Value.MilliValue() != 12500 {
+		t.Errorf("Fetch() = %+v, %v, expected the age of the queue", samples, err)
+	}
+	if requests != 1 {
+		t.Errorf("%d requests, expected the document to be scraped once", requests)
+	}
+
+	for _, test := range []struct {
+		name   string
+		metric string
+		spec   *v1.HTTPSource
+		check  func(error) bool
+	}{
+		{"no http settings", "$.queue.length", nil, IsInvalid},
+		{"invalid path", "$..length", spec, IsInvalid},
+		{"path selects nothing", "$.queue.size", spec, IsNotFound},
+		{"not a number", "$.queue", spec, IsInvalid},
+		{"status", "$.queue.length", &v1.HTTPSource{URL: server.URL + "/missing"}, IsNotFound},
+		{"forbidden", "$.queue.length", &v1.HTTPSource{URL: server.URL + "/shop/web/stats"}, IsInvalid},
+		{"invalid document", "$.queue.length", &v1.HTTPSource{URL: server.URL + "/broken"}, IsTransient},
+		{"invalid template", "$.queue.length", &v1.HTTPSource{URL: server.URL + "/{{.Service}}"}, IsInvalid},
+		{"scheme", "$.queue.length", &v1.HTTPSource{URL: "file:///etc/passwd"}, IsInvalid},
+		{"host not allowed", "$.queue.length", &v1.HTTPSource{URL: strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/shop/web/stats"}, IsInvalid},
+		{"redirect to a host not allowed", "$.queue.length", &v1.HTTPSource{URL: server.URL + "/elsewhere", Headers: spec.Headers}, IsTransient},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := source.Fetch(context.Background(), httpQuery(test.metric, test.spec)); !test.check(err) {
+				t.Errorf("Fetch() = %v, expected an error of another kind", err)
+			}
+		})
+	}
+
+	moved := &v1.HTTPSource{URL: server.URL + "/moved", Headers: spec.Headers}
+	if samples, err := source.Fetch(context.Background(), httpQuery("$.queue.length", moved)); err != nil || len(samples) != 1 {
+		t.Errorf("Fetch() following a redirect within the host = %+v, %v", samples, err)
+	}
+
+	// Without allowed hosts only the pods of the target may be scraped
+	configureHTTP(t)
+	before := atomic.LoadInt32(&requests)
+	if _, err := source.Fetch(context.Background(), httpQuery("$.queue.length", &v1.HTTPSource{URL: server.URL + "/other/stats"})); !IsInvalid(err) {
+		t.Errorf("Fetch() without allowed hosts = %v, expected invalid", err)
+	}
+	if atomic.LoadInt32(&requests) != before {
+		t.Error("host that is not allowed was requested")
+	}
+}
+
+func serverURL(r *http.Request) string {
+	return "http://" + r.Host
+}
+
+func TestHTTPSourceRetriesFailedScrapes(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"queue": {"length": 5}}`))
+	}))
+	defer server.Close()
+	configureHTTP(t, "127.0.0.1")
+
+	source := NewHTTPSource(nil)
+	query := httpQuery("$.queue.length", &v1.HTTPSource{URL: server.URL})
+	if _, err := source.Fetch(context.Background(), query); !IsTransient(err) {
+		t.Fatalf("Fetch() = %v, expected a transient error", err)
+	}
+	if samples, err := source.Fetch(context.Background(), query); err != nil || len(samples) != 1 {
+		t.Errorf("failed scrape was cached: %+v, %v", samples, err)
+	}
+}
+
+func TestHTTPSourcePerPod(t *testing.T) {
+	var mutex sync.Mutex
+	var scraped []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pod := strings.TrimPrefix(r.URL.Path, "/pods/")
+		mutex.Lock()
+		scraped = append(scraped, pod)
+		mutex.Unlock()
+		switch pod {
+		case "web-a":
+			w.Write([]byte(`{"queue": {"length": 3}}`))
+		case "web-b":
+			w.Write([]byte(`{"queue": {"length": 7}}`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+	// The pods of the target may be scraped without allowing their hosts
+	configureHTTP(t)
+
+	clientset := newPodServer(t, []corev1.Pod{testPod("web-a", "127.0.0.1", true), testPod("web-b", "127.0.0.1", true),
+		testPod("web-c", "127.0.0.1", false), testPod("web-d", "127.0.0.1", true)}, nil)
+	source := NewHTTPSource(clientset)
+	query := httpQuery("$.queue.length", &v1.HTTPSource{URL: "http://{{.Pod.IP}}" + port + "/pods/{{.Pod.Name}}"})
+	query.Rule.Spec.PerPod = true
+
+	samples, err := source.Fetch(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The unavailable pod web-d does not fail the rule, the pod web-c is not ready
+	if values := sampleValues(samples); len(values) != 2 || values["web-a$.queue.length"] != 3000 || values["web-b$.queue.length"] != 7000 {
+		t.Errorf("values %v, expected 3 of web-a and 7 of web-b", values)
+	}
+	for _, sample := range samples {
+		if sample.Labels["namespace"] != "shop" {
+			t.Errorf("sample labels %v lack the namespace of the pod", sample.Labels)
+		}
+	}
+	sort.Strings(scraped)
+	if strings.Join(scraped, ",") != "web-a,web-b,web-d" {
+		t.Errorf("scraped %v, expected the ready pods", scraped)
+	}
+
+	// Samples are selected by the name of their pod
+	selected := query
+	selected.Rule = query.Rule.DeepCopy()
+	selected.Rule.Spec.MetricSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"name": "web-b"}}
+	if samples, err := source.Fetch(context.Background(), selected); err != nil || len(samples) != 1 || samples[0].Value.MilliValue() != 7000 {
+		t.Errorf("Fetch() of the selected pod = %+v, %v", samples, err)
+	}
+
+	// Hosts other than the pod's IP are not allowed
+	query.Rule.Spec.HTTP = &v1.HTTPSource{URL: "http://localhost" + port + "/pods/{{.Pod.Name}}"}
+	if _, err := source.Fetch(context.Background(), query); !IsInvalid(err) {
+		t.Errorf("Fetch() of another host per pod = %v, expected invalid", err)
+	}
+
+	// All pods failing fails the rule
+	query.Rule.Spec.HTTP = &v1.HTTPSource{URL: "http://{{.Pod.IP}}" + port + "/pods/down"}
+	if _, err := source.Fetch(context.Background(), query); !IsTransient(err) {
+		t.Errorf("Fetch() = %v, expected a transient error", err)
+	}
+
+	noPods := NewHTTPSource(newPodServer(t, []corev1.Pod{testPod("web-c", "127.0.0.1", false)}, nil))
+	if _, err := noPods.Fetch(context.Background(), query); !IsNotFound(err) {
+		t.Errorf("Fetch() without ready pods = %v, expected not found", err)
+	}
+}
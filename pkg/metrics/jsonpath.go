@@ -0,0 +1,176 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a parsed JSONPath expression. Only a subset is supported: the root $, child members as .name or
+// ['name'], array indices, negative ones counting from the end, and the wildcards .* and [*]. The kubectl style
+// {.items[0].name} is accepted as well.
+type jsonPath []pathStep
+
+type pathStep struct {
+	member   string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// jsonMatch is a value selected by a path, located by the path without wildcards.
+type jsonMatch struct {
+	path  string
+	value interface{}
+}
+
+func parseJSONPath(expression string) (jsonPath, error) {
+	text := strings.TrimSpace(expression)
+	if strings.HasPrefix(text, "{") && strings.HasSuffix(text, "}") {
+		text = strings.TrimSpace(text[1 : len(text)-1])
+	}
+	text = strings.TrimPrefix(text, "$")
+	if text == "" {
+		return nil, fmt.Errorf("empty path %q", expression)
+	}
+
+	var path jsonPath
+	for text != "" {
+		switch text[0] {
+		case '.':
+			text = text[1:]
+			end := strings.IndexAny(text, ".[")
+			if end < 0 {
+				end = len(text)
+			}
+			name := text[:end]
+			if name == "" {
+				return nil, fmt.Errorf("missing member name in path %q", expression)
+			}
+			if name == "*" {
+				path = append(path, pathStep{wildcard: true})
+			} else {
+				path = append(path, pathStep{member: name})
+			}
+			text = text[end:]
+		case '[':
+			end := strings.IndexByte(text, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated bracket in path %q", expression)
+			}
+			step, err := parseBracket(strings.TrimSpace(text[1:end]))
+			if err != nil {
+				return nil, fmt.Errorf("path %q: %v", expression, err)
+			}
+			path = append(path, step)
+			text = text[end+1:]
+		default:
+			if len(path) > 0 {
+				return nil, fmt.Errorf("unexpected %q in path %q", text[0], expression)
+			}
+			// A leading member without a dot, e.g. items[0]
+			text = "." + text
+		}
+	}
+	return path, nil
+}
+
+func parseBracket(content string) (pathStep, error) {
+	switch {
+	case content == "*":
+		return pathStep{wildcard: true}, nil
+	case len(content) >= 2 && (content[0] == '\'' || content[0] == '"') && content[len(content)-1] == content[0]:
+		return pathStep{member: content[1 : len(content)-1]}, nil
+	default:
+		index, err := strconv.Atoi(content)
+		if err != nil {
+			return pathStep{}, fmt.Errorf("unsupported selector [%s]", content)
+		}
+		return pathStep{index: index, isIndex: true}, nil
+	}
+}
+
+// find returns the values of a decoded JSON document selected by the path.
+func (p jsonPath) find(document interface{}) []jsonMatch {
+	matches := []jsonMatch{{path: "$", value: document}}
+	for _, step := range p {
+		var next []jsonMatch
+		for _, match := range matches {
+			next = append(next, step.apply(match)...)
+		}
+		matches = next
+	}
+	return matches
+}
+
+func (s pathStep) apply(match jsonMatch) []jsonMatch {
+	switch value := match.value.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			members := make([]string, 0, len(value))
+			for member := range value {
+				members = append(members, member)
+			}
+			sort.Strings(members)
+			matches := make([]jsonMatch, 0, len(members))
+			for _, member := range members {
+				matches = append(matches, jsonMatch{path: match.path + "." + member, value: value[member]})
+			}
+			return matches
+		}
+		if child, ok := value[s.member]; ok && !s.isIndex {
+			return []jsonMatch{{path: match.path + "." + s.member, value: child}}
+		}
+	case []interface{}:
+		if s.wildcard {
+			matches := make([]jsonMatch, 0, len(value))
+			for i, child := range value {
+				matches = append(matches, jsonMatch{path: fmt.Sprintf("%s[%d]", match.path, i), value: child})
+			}
+			return matches
+		}
+		if s.isIndex {
+			index := s.index
+			if index < 0 {
+				index += len(value)
+			}
+			if index >= 0 && index < len(value) {
+				return []jsonMatch{{path: fmt.Sprintf("%s[%d]", match.path, index), value: value[index]}}
+			}
+		}
+	}
+	return nil
+}
+
+// jsonNumber converts a selected value to a number, numeric strings and booleans are accepted.
+func jsonNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", v)
+		}
+		return number, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("%v is not a number", value)
+	}
+}
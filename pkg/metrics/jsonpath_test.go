@@ -0,0 +1,116 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const statsDocument = `{
+	"queue": {"length": 5, "age": "12.5"},
+	"workers": [{"busy": true, "load": 0.5}, {"busy": false, "load": 1.5}],
+	"odd.key": 3,
+	"items": [1, 2, 3]
+}`
+
+func decodeDocument(t *testing.T, text string) interface{} {
+	var document interface{}
+	if err := json.Unmarshal([]byte(text), &document); err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
+
+func TestJSONPathFind(t *testing.T) {
+	document := decodeDocument(t, statsDocument)
+	for _, test := range []struct {
+		expression string
+		expected   []jsonMatch
+	}{
+		{"$.queue.length", []jsonMatch{{"$.queue.length", 5.0}}},
+		{"queue.length", []jsonMatch{{"$.queue.length", 5.0}}},
+		{"{.queue.length}", []jsonMatch{{"$.queue.length", 5.0}}},
+		{" $.queue.age ", []jsonMatch{{"$.queue.age", "12.5"}}},
+		{"$['queue'][\"length\"]", []jsonMatch{{"$.queue.length", 5.0}}},
+		{"$['odd.key']", []jsonMatch{{"$.odd.key", 3.0}}},
+		{"$.workers[*].load", []jsonMatch{{"$.workers[0].load", 0.5}, {"$.workers[1].load", 1.5}}},
+		{"$.workers[ * ].busy", []jsonMatch{{"$.workers[0].busy", true}, {"$.workers[1].busy", false}}},
+		{"$.workers[-1].load", []jsonMatch{{"$.workers[1].load", 1.5}}},
+		{"$.queue.*", []jsonMatch{{"$.queue.age", "12.5"}, {"$.queue.length", 5.0}}},
+		{"$.queue[*]", []jsonMatch{{"$.queue.age", "12.5"}, {"$.queue.length", 5.0}}},
+		{"items[0]", []jsonMatch{{"$.items[0]", 1.0}}},
+		{"$.items[3]", nil},
+		{"$.items[-4]", nil},
+		{"$.queue[0]", nil},
+		{"$.items.length", nil},
+		{"$.missing.length", nil},
+		{"$.queue.length.value", nil},
+	} {
+		t.Run(test.expression, func(t *testing.T) {
+			path, err := parseJSONPath(test.expression)
+			if err != nil {
+				t.Fatalf("parseJSONPath failed: %v", err)
+			}
+			if matches := path.find(document); !reflect.DeepEqual(matches, test.expected) {
+				t.Errorf("matches %+v, expected %+v", matches, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseJSONPathErrors(t *testing.T) {
+	for _, test := range []struct {
+		expression string
+		expected   string
+	}{
+		{"", "empty path"},
+		{"$", "empty path"},
+		{"{}", "empty path"},
+		{"$..length", "missing member name"},
+		{"$.queue.", "missing member name"},
+		{"$.items[0", "unterminated bracket"},
+		{"$.items[?(@.busy)]", "unsupported selector"},
+		{"$.items[first]", "unsupported selector"},
+		{"$.items[0]x", `unexpected 'x'`},
+	} {
+		if _, err := parseJSONPath(test.expression); err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("parseJSONPath(%q) = %v, expected an error containing %q", test.expression, err, test.expected)
+		}
+	}
+}
+
+func TestJSONNumber(t *testing.T) {
+	for _, test := range []struct {
+		value    interface{}
+		expected float64
+		valid    bool
+	}{
+		{2.5, 2.5, true},
+		{"12.5", 12.5, true},
+		{" -3 ", -3, true},
+		{"1e3", 1000, true},
+		{true, 1, true},
+		{false, 0, true},
+		{"many", 0, false},
+		{nil, 0, false},
+		{map[string]interface{}{"value": 1.0}, 0, false},
+		{[]interface{}{1.0}, 0, false},
+	} {
+		number, err := jsonNumber(test.value)
+		if (err == nil) != test.valid || number != test.expected {
+			t.Errorf("jsonNumber(%#v) = %v, %v, expected %v and valid %v", test.value, number, err, test.expected, test.valid)
+		}
+	}
+}
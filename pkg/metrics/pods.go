@@ -0,0 +1,114 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"fmt"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/monitoring"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"sync"
+	"time"
+)
+
+var podValueGauge = monitoring.NewGaugeVec("gac_pod_metric_value", "Latest value of a metric read per pod of a target.", "kind", "namespace", "name", "metric", "pod")
+
+// targetSelector returns the pod selector of the target workload.
+func targetSelector(kubeclientset kubernetes.Interface, source string, target util.Target) (labels.Selector, error) {
+	var selector *metav1.LabelSelector
+	switch target.Kind {
+	case "Deployment":
+		deployment, err := kubeclientset.AppsV1().Deployments(target.Namespace).Get(target.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, classify(source, err)
+		}
+		selector = deployment.Spec.Selector
+	case "StatefulSet":
+		statefulset, err := kubeclientset.AppsV1().StatefulSets(target.Namespace).Get(target.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, classify(source, err)
+		}
+		selector = statefulset.Spec.Selector
+	default:
+		return nil, NewError(ErrorInvalid, source, fmt.Errorf("unsupported target kind %s", target.Kind))
+	}
+
+	parsed, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, NewError(ErrorInvalid, source, err)
+	}
+	return parsed, nil
+}
+
+func podReady(pod *corev1.Pod) (bool, time.Time) {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue, condition.LastTransitionTime.Time
+		}
+	}
+	return false, time.Time{}
+}
+
+// readyPods returns the selector of the target's pods and those that are running, ready and not terminating by
+// name.
+func readyPods(kubeclientset kubernetes.Interface, source string, target util.Target) (labels.Selector, map[string]corev1.Pod, error) {
+	selector, err := targetSelector(kubeclientset, source, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	pods, err := kubeclientset.CoreV1().Pods(target.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, nil, classify(source, err)
+	}
+
+	ready := make(map[string]corev1.Pod, len(pods.Items))
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if isReady, _ := podReady(pod); isReady && pod.DeletionTimestamp == nil && pod.Status.Phase == corev1.PodRunning {
+			ready[pod.Name] = *pod
+		}
+	}
+	return selector, ready, nil
+}
+
+// podValues exports the per pod values of the targets' metrics for debugging. Values of pods that are gone are
+// removed.
+type podValues struct {
+	mutex    sync.Mutex
+	exported map[string]map[string]bool
+}
+
+func newPodValues() *podValues {
+	return &podValues{exported: make(map[string]map[string]bool)}
+}
+
+func (v *podValues) export(target util.Target, metric string, samples []Sample) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	key := target.Kind + "/" + target.Namespace + "/" + target.Name + "/" + metric
+	current := make(map[string]bool, len(samples))
+	for _, sample := range samples {
+		pod := sample.Labels["name"]
+		current[pod] = true
+		podValueGauge.Set(float64(sample.Value.MilliValue())/1000, target.Kind, target.Namespace, target.Name, metric, pod)
+	}
+	for pod := range v.exported[key] {
+		if !current[pod] {
+			podValueGauge.Delete(target.Kind, target.Namespace, target.Name, metric, pod)
+		}
+	}
+	v.exported[key] = current
+}
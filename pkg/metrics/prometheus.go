@@ -0,0 +1,242 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// PrometheusName is the name of the source querying the Prometheus HTTP API. The metric names of rules using it
+// are PromQL queries, they may refer to {{.Namespace}}, {{.Metric}} and the {{.Target.Namespace}},
+// {{.Target.Name}} and {{.Target.Kind}} of the workload.
+const PrometheusName = "prometheus"
+
+// queryData are the variables available in query templates.
+type queryData struct {
+	Namespace string
+	Metric    string
+	Target    util.Target
+}
+
+// prometheusResponse is the envelope of /api/v1/query responses.
+type prometheusResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+type prometheusVector []struct {
+	Metric map[string]string `json:"metric"`
+	Value  prometheusValue   `json:"value"`
+}
+
+// prometheusValue is a [timestamp, "value"] pair.
+type prometheusValue [2]interface{}
+
+func (v prometheusValue) sample() (time.Time, float64, error) {
+	seconds, ok := v[0].(float64)
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("invalid timestamp %v", v[0])
+	}
+	text, ok := v[1].(string)
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("invalid value %v", v[1])
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("invalid value %q", text)
+	}
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9)), value, nil
+}
+
+type prometheusSource struct {
+	client *http.Client
+}
+
+// NewPrometheusSource evaluates PromQL queries against the Prometheus server of the metrics configuration.
+func NewPrometheusSource() MetricSource {
+	return &prometheusSource{client: &http.Client{}}
+}
+
+func (s *prometheusSource) Name() string {
+	return PrometheusName
+}
+
+// CacheKey is the rendered query, it includes the target only if the template of the query refers to it.
+func (s *prometheusSource) CacheKey(query Query) string {
+	promql, err := renderQuery(query)
+	if err != nil {
+		return ""
+	}
+	return promql
+}
+
+func renderQuery(query Query) (string, error) {
+	tmpl, err := template.New("query").Option("missingkey=error").Parse(query.Metric)
+	if err != nil {
+		return "", err
+	}
+	var promql bytes.Buffer
+	if err := tmpl.Execute(&promql, queryData{Namespace: query.Namespace, Metric: query.Metric, Target: query.Target}); err != nil {
+		return "", err
+	}
+	return promql.String(), nil
+}
+
+func authorize(request *http.Request, prometheus config.PrometheusConfig) error {
+	if prometheus.BearerTokenFile != "" {
+		token, err := ioutil.ReadFile(prometheus.BearerTokenFile)
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	} else if prometheus.Username != "" {
+		var password []byte
+		if prometheus.PasswordFile != "" {
+			var err error
+			if password, err = ioutil.ReadFile(prometheus.PasswordFile); err != nil {
+				return err
+			}
+		}
+		request.SetBasicAuth(prometheus.Username, strings.TrimSpace(string(password)))
+	}
+	return nil
+}
+
+func (s *prometheusSource) Fetch(ctx context.Context, query Query) ([]Sample, error) {
+	prometheus := currentSettings().Prometheus
+	if prometheus.URL == "" {
+		return nil, NewError(ErrorInvalid, PrometheusName, fmt.Errorf("no prometheus url configured"))
+	}
+
+	promql, err := renderQuery(query)
+	if err != nil {
+		return nil, NewError(ErrorInvalid, PrometheusName, fmt.Errorf("invalid query template %q: %v", query.Metric, err))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(prometheus.Timeout)*time.Second)
+	defer cancel()
+
+	endpoint := strings.TrimSuffix(prometheus.URL, "/") + "/api/v1/query"
+	request, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(url.Values{"query": {promql}}.Encode()))
+	if err != nil {
+		return nil, NewError(ErrorInvalid, PrometheusName, err)
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := authorize(request, prometheus); err != nil {
+		return nil, NewError(ErrorInvalid, PrometheusName, fmt.Errorf("could not read credentials: %v", err))
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, NewError(ErrorTransient, PrometheusName, err)
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, NewError(ErrorTransient, PrometheusName, err)
+	}
+	return parsePrometheusResponse(promql, response.StatusCode, body)
+}
+
+// parsePrometheusResponse validates the shape of a query result, only instant vectors and scalars are accepted.
+func parsePrometheusResponse(promql string, statusCode int, body []byte) ([]Sample, error) {
+	var result prometheusResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		if statusCode != http.StatusOK {
+			return nil, NewError(classifyStatus(statusCode), PrometheusName, fmt.Errorf("query %q failed with status %d", promql, statusCode))
+		}
+		return nil, NewError(ErrorTransient, PrometheusName, fmt.Errorf("could not decode result of query %q: %v", promql, err))
+	}
+	if result.Status != "success" {
+		kind := classifyStatus(statusCode)
+		if result.ErrorType == "timeout" || result.ErrorType == "canceled" || result.ErrorType == "unavailable" {
+			kind = ErrorTransient
+		}
+		return nil, NewError(kind, PrometheusName, fmt.Errorf("query %q failed: %s: %s", promql, result.ErrorType, result.Error))
+	}
+
+	switch result.Data.ResultType {
+	case "vector":
+		var vector prometheusVector
+		if err := json.Unmarshal(result.Data.Result, &vector); err != nil {
+			return nil, NewError(ErrorInvalid, PrometheusName, fmt.Errorf("invalid vector result of query %q: %v", promql, err))
+		}
+		samples := make([]Sample, 0, len(vector))
+		for _, series := range vector {
+			timestamp, value, err := series.Value.sample()
+			if err != nil {
+				return nil, NewError(ErrorInvalid, PrometheusName, fmt.Errorf("query %q: %v", promql, err))
+			}
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				continue
+			}
+			samples = append(samples, Sample{Value: floatQuantity(value), Timestamp: timestamp, Labels: series.Metric})
+		}
+		return samples, nil
+	case "scalar":
+		var scalar prometheusValue
+		if err := json.Unmarshal(result.Data.Result, &scalar); err != nil {
+			return nil, NewError(ErrorInvalid, PrometheusName, fmt.Errorf("invalid scalar result of query %q: %v", promql, err))
+		}
+		timestamp, value, err := scalar.sample()
+		if err != nil {
+			return nil, NewError(ErrorInvalid, PrometheusName, fmt.Errorf("query %q: %v", promql, err))
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil, nil
+		}
+		return []Sample{{Value: floatQuantity(value), Timestamp: timestamp}}, nil
+	default:
+		return nil, NewError(ErrorInvalid, PrometheusName, fmt.Errorf("query %q returned a %s, expected a vector or scalar", promql, result.Data.ResultType))
+	}
+}
+
+// classifyStatus classifies a failed request by its HTTP status.
+func classifyStatus(statusCode int) ErrorKind {
+	switch {
+	case statusCode == http.StatusTooManyRequests || statusCode >= 500:
+		return ErrorTransient
+	case statusCode == http.StatusNotFound:
+		return ErrorNotFound
+	case statusCode >= 400:
+		return ErrorInvalid
+	default:
+		return ErrorTransient
+	}
+}
+
+// floatQuantity converts a float with milli precision, the precision of the thresholds of rules.
+func floatQuantity(value float64) resource.Quantity {
+	return *resource.NewMilliQuantity(int64(math.Round(value*1000)), resource.DecimalSI)
+}
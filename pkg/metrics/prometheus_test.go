@@ -0,0 +1,179 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParsePrometheusResponse(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		status  int
+		body    string
+		values  []int64 // milli values
+		labels  []string
+		kind    ErrorKind
+		invalid bool
+	}{
+		{"vector", 200, `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"pod":"web-1"},"value":[1560000000.5,"12.5"]},
+			{"metric":{"pod":"web-2"},"value":[1560000000.5,"7"]}]}}`, []int64{12500, 7000}, []string{"web-1", "web-2"}, "", false},
+		{"vector without finite values", 200, `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{},"value":[1560000000,"NaN"]},{"metric":{},"value":[1560000000,"+Inf"]}]}}`, nil, nil, "", false},
+		{"empty vector", 200, `{"status":"success","data":{"resultType":"vector","result":[]}}`, nil, nil, "", false},
+		{"scalar", 200, `{"status":"success","data":{"resultType":"scalar","result":[1560000000,"0.25"]}}`, []int64{250}, []string{""}, "", false},
+		{"matrix", 200, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1560000000,"1"]]}]}}`, nil, nil, ErrorInvalid, true},
+		{"invalid value", 200, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1560000000,"many"]}]}}`, nil, nil, ErrorInvalid, true},
+		{"bad query", 400, `{"status":"error","errorType":"bad_data","error":"parse error"}`, nil, nil, ErrorInvalid, true},
+		{"timeout", 503, `{"status":"error","errorType":"timeout","error":"query timed out"}`, nil, nil, ErrorTransient, true},
+		{"canceled with status 422", 422, `{"status":"error","errorType":"canceled","error":"canceled"}`, nil, nil, ErrorTransient, true},
+		{"proxy error", 502, `<html>bad gateway</html>`, nil, nil, ErrorTransient, true},
+		{"not found", 404, `not found`, nil, nil, ErrorNotFound, true},
+		{"garbage", 200, `{"status":`, nil, nil, ErrorTransient, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			samples, err := parsePrometheusResponse("up", test.status, []byte(test.body))
+			if test.invalid {
+				if err == nil || Kind(err) != test.kind {
+					t.Fatalf("error = %v, expected kind %s", err, test.kind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(samples) != len(test.values) {
+				t.Fatalf("%d samples, expected %d", len(samples), len(test.values))
+			}
+			for i, sample := range samples {
+				if sample.Value.MilliValue() != test.values[i] || sample.Labels["pod"] != test.labels[i] {
+					t.Errorf("sample %d = %s %v, expected %dm %s", i, sample.Value.String(), sample.Labels, test.values[i], test.labels[i])
+				}
+				if !sample.Timestamp.Equal(time.Unix(1560000000, 0)) && !sample.Timestamp.Equal(time.Unix(1560000000, 5e8)) {
+					t.Errorf("unexpected timestamp %v", sample.Timestamp)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderQuery(t *testing.T) {
+	query := testQuery(`sum(rate(http_requests_total{namespace="{{.Target.Namespace}}", deployment="{{.Target.Name}}"}[1m])) / {{.Namespace}}`)
+	promql, err := renderQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `sum(rate(http_requests_total{namespace="shop", deployment="web"}[1m])) / shop`; promql != expected {
+		t.Errorf("rendered %s, expected %s", promql, expected)
+	}
+
+	if promql, err := renderQuery(testQuery("up")); err != nil || promql != "up" {
+		t.Errorf("plain query rendered as %q, %v", promql, err)
+	}
+	for _, invalid := range []string{"{{.Target.Name", "{{.Unknown}}", "{{.Target.Replicas}}"} {
+		if _, err := renderQuery(testQuery(invalid)); err == nil {
+			t.Errorf("invalid template %s rendered", invalid)
+		}
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPrometheusSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prometheus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if r.URL.Path != "/prometheus/api/v1/query" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.FormValue("query") != `up{namespace="shop"}` {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"status":"error","errorType":"bad_data","error":"unexpected query %s"}`, r.FormValue("query"))
+			return
+		}
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"pod":"web-1"},"value":[1560000000,"1"]}]}}`)
+	}))
+	defer server.Close()
+
+	source := NewPrometheusSource()
+	query := testQuery(`up{namespace="{{.Target.Namespace}}"}`)
+	settings := config.Default().Metrics
+
+	for _, test := range []struct {
+		name          string
+		prometheus    config.PrometheusConfig
+		authorization string
+	}{
+		{"anonymous", config.PrometheusConfig{}, ""},
+		{"bearer token", config.PrometheusConfig{BearerTokenFile: writeFile(t, dir, "token", "s3cret\n")}, "Bearer s3cret"},
+		{"basic auth", config.PrometheusConfig{Username: "gac", PasswordFile: writeFile(t, dir, "password", "pa55\n")}, "Basic Z2FjOnBhNTU="},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			settings.Prometheus = test.prometheus
+			settings.Prometheus.URL = server.URL + "/prometheus/"
+			settings.Prometheus.Timeout = 5
+			Configure(settings)
+
+			samples, err := source.Fetch(context.Background(), query)
+			if err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+			if len(samples) != 1 || samples[0].Labels["pod"] != "web-1" {
+				t.Errorf("unexpected samples %v", samples)
+			}
+			if authorization != test.authorization {
+				t.Errorf("authorization %q, expected %q", authorization, test.authorization)
+			}
+		})
+	}
+
+	settings.Prometheus = config.PrometheusConfig{URL: server.URL + "/prometheus", Timeout: 5, BearerTokenFile: filepath.Join(dir, "missing")}
+	Configure(settings)
+	if _, err := source.Fetch(context.Background(), query); !IsInvalid(err) {
+		t.Errorf("missing token file: %v", err)
+	}
+
+	settings.Prometheus = config.PrometheusConfig{URL: server.URL + "/prometheus", Timeout: 5}
+	Configure(settings)
+	if _, err := source.Fetch(context.Background(), testQuery("down")); !IsInvalid(err) {
+		t.Errorf("rejected query: %v", err)
+	}
+
+	settings.Prometheus = config.PrometheusConfig{}
+	Configure(settings)
+	if _, err := source.Fetch(context.Background(), query); !IsInvalid(err) {
+		t.Errorf("missing url: %v", err)
+	}
+}
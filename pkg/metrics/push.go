@@ -0,0 +1,62 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/ingest"
+	"k8s.io/apimachinery/pkg/labels"
+	"math"
+)
+
+// PushName is the name of the source reading samples pushed to the ingestion endpoint.
+const PushName = "push"
+
+type pushSource struct {
+	store *ingest.Store
+}
+
+// NewPushSource reads the samples pushed to the rule's target namespace, restricted by the metric selectors of the
+// rule.
+func NewPushSource(store *ingest.Store) MetricSource {
+	return &pushSource{store: store}
+}
+
+func (s *pushSource) Name() string {
+	return PushName
+}
+
+func (s *pushSource) Fetch(ctx context.Context, query Query) ([]Sample, error) {
+	selectorString, err := query.MetricSelector()
+	if err != nil {
+		return nil, NewError(ErrorInvalid, PushName, err)
+	}
+	selector, err := labels.Parse(selectorString)
+	if err != nil {
+		return nil, NewError(ErrorInvalid, PushName, err)
+	}
+
+	pushed := s.store.Latest(query.Namespace, query.Metric, selector)
+	if len(pushed) == 0 {
+		return nil, NewError(ErrorNotFound, PushName, fmt.Errorf("no samples of metric %s pushed to namespace %s", query.Metric, query.Namespace))
+	}
+
+	samples := make([]Sample, 0, len(pushed))
+	for _, sample := range pushed {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		samples = append(samples, Sample{Value: floatQuantity(sample.Value), Timestamp: sample.Timestamp, Labels: sample.Labels})
+	}
+	return samples, nil
+}
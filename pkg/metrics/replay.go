@@ -0,0 +1,331 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	"io"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplayName is the name of the source serving recorded traces.
+const ReplayName = "replay"
+
+type replayPoint struct {
+	timestamp time.Time
+	value     float64
+}
+
+type replaySeries struct {
+	metric    string
+	namespace string
+	labels    map[string]string
+	points    []replayPoint
+}
+
+// trace holds the recorded series of all configured files, the clock starts when it is loaded.
+type trace struct {
+	config config.ReplayConfig
+	series []*replaySeries
+	start  time.Time
+	end    time.Time
+	loaded time.Time
+}
+
+type replaySource struct {
+	mutex sync.Mutex
+	trace *trace
+}
+
+// NewReplaySource serves the samples recorded in the configured trace files. Traces are (re)loaded when their
+// configuration changes.
+func NewReplaySource() MetricSource {
+	return &replaySource{}
+}
+
+func (s *replaySource) Name() string {
+	return ReplayName
+}
+
+// currentTrace returns the trace of the current configuration, loading it if the configuration changed.
+func (s *replaySource) currentTrace() (*trace, error) {
+	replayConfig := currentSettings().Replay
+	if len(replayConfig.Files) == 0 {
+		return nil, fmt.Errorf("no trace files configured")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.trace != nil && sameReplay(s.trace.config, replayConfig) {
+		return s.trace, nil
+	}
+
+	t, err := loadTrace(replayConfig)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Replaying %d series recorded from %v to %v on the %s clock", len(t.series), t.start, t.end, replayConfig.Clock)
+	s.trace = t
+	return t, nil
+}
+
+// sameReplay reports whether both configurations replay the same files on the same clock. Global only selects the
+// rules the traces are replayed for.
+func sameReplay(a config.ReplayConfig, b config.ReplayConfig) bool {
+	if len(a.Files) != len(b.Files) || a.Clock != b.Clock || a.Speed != b.Speed || a.Loop != b.Loop {
+		return false
+	}
+	for i := range a.Files {
+		if a.Files[i] != b.Files[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// now returns the time of the trace at the given wall time.
+func (t *trace) now(wall time.Time) time.Time {
+	if t.config.Clock == config.ReplayClockWall {
+		return wall
+	}
+	elapsed := time.Duration(float64(wall.Sub(t.loaded)) * t.config.Speed)
+	if length := t.end.Sub(t.start); t.config.Loop && length > 0 {
+		elapsed %= length
+	}
+	return t.start.Add(elapsed)
+}
+
+func (s *replaySource) Fetch(ctx context.Context, query Query) ([]Sample, error) {
+	t, err := s.currentTrace()
+	if err != nil {
+		return nil, NewError(ErrorInvalid, ReplayName, err)
+	}
+	selectorString, err := query.MetricSelector()
+	if err != nil {
+		return nil, NewError(ErrorInvalid, ReplayName, err)
+	}
+	selector, err := labels.Parse(selectorString)
+	if err != nil {
+		return nil, NewError(ErrorInvalid, ReplayName, err)
+	}
+
+	wall := time.Now()
+	traceNow := t.now(wall)
+	var samples []Sample
+	for _, series := range t.series {
+		if series.metric != query.Metric || (series.namespace != "" && series.namespace != query.Namespace) || !selector.Matches(labels.Set(series.labels)) {
+			continue
+		}
+		// Latest point recorded up to the current time of the trace
+		i := sort.Search(len(series.points), func(i int) bool { return series.points[i].timestamp.After(traceNow) })
+		if i == 0 {
+			continue
+		}
+		point := series.points[i-1]
+		// Samples age as fast as the trace runs, so staleness is judged by the time of the trace
+		age := time.Duration(float64(traceNow.Sub(point.timestamp)) / t.config.Speed)
+		samples = append(samples, Sample{Value: floatQuantity(point.value), Timestamp: wall.Add(-age), Labels: series.labels})
+	}
+
+	if len(samples) == 0 {
+		return nil, NewError(ErrorNotFound, ReplayName, fmt.Errorf("no samples of metric %s recorded until %v", query.Metric, traceNow))
+	}
+	return samples, nil
+}
+
+// replayRecord is a single line of a trace.
+type replayRecord struct {
+	Timestamp json.RawMessage   `json:"timestamp"`
+	Metric    string            `json:"metric"`
+	Value     float64           `json:"value"`
+	Namespace string            `json:"namespace"`
+	Labels    map[string]string `json:"labels"`
+}
+
+func loadTrace(replayConfig config.ReplayConfig) (*trace, error) {
+	index := make(map[string]*replaySeries)
+	add := func(timestamp time.Time, metric string, namespace string, seriesLabels map[string]string, value float64) {
+		key := namespace + "/" + labels.Set(seriesLabels).String() + "/" + metric
+		series, exists := index[key]
+		if !exists {
+			series = &replaySeries{metric: metric, namespace: namespace, labels: seriesLabels}
+			index[key] = series
+		}
+		series.points = append(series.points, replayPoint{timestamp: timestamp, value: value})
+	}
+
+	for _, file := range replayConfig.Files {
+		if err := readTraceFile(file, add); err != nil {
+			return nil, fmt.Errorf("trace %s: %v", file, err)
+		}
+	}
+	if len(index) == 0 {
+		return nil, fmt.Errorf("traces %v contain no samples", replayConfig.Files)
+	}
+
+	t := &trace{config: replayConfig, loaded: time.Now()}
+	for _, series := range index {
+		sort.Slice(series.points, func(i, j int) bool { return series.points[i].timestamp.Before(series.points[j].timestamp) })
+		first, last := series.points[0].timestamp, series.points[len(series.points)-1].timestamp
+		if t.start.IsZero() || first.Before(t.start) {
+			t.start = first
+		}
+		if last.After(t.end) {
+			t.end = last
+		}
+		t.series = append(t.series, series)
+	}
+	return t, nil
+}
+
+type addFunc func(timestamp time.Time, metric string, namespace string, seriesLabels map[string]string, value float64)
+
+// readTraceFile reads JSONL files (.jsonl, .ndjson) with one record per line, or CSV files with a header naming the
+// timestamp, metric and value columns, an optional namespace column and further columns as labels.
+func readTraceFile(file string, add addFunc) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		return readCSVTrace(f, add)
+	case ".jsonl", ".ndjson":
+		return readJSONLTrace(f, add)
+	default:
+		return fmt.Errorf("unknown trace format, expected .csv, .jsonl or .ndjson")
+	}
+}
+
+func readJSONLTrace(reader io.Reader, add addFunc) error {
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var record replayRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		var timestamp interface{}
+		if err := json.Unmarshal(record.Timestamp, &timestamp); err != nil {
+			return fmt.Errorf("line %d: invalid timestamp: %v", line, err)
+		}
+		parsed, err := parseTraceTimestamp(fmt.Sprint(timestamp))
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		if strings.TrimSpace(record.Metric) == "" {
+			return fmt.Errorf("line %d: missing metric", line)
+		}
+		add(parsed, record.Metric, record.Namespace, record.Labels, record.Value)
+	}
+	return scanner.Err()
+}
+
+func readCSVTrace(reader io.Reader, add addFunc) error {
+	records := csv.NewReader(reader)
+	records.TrimLeadingSpace = true
+	header, err := records.Read()
+	if err != nil {
+		return fmt.Errorf("missing header: %v", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if _, exists := columns[name]; exists {
+			return fmt.Errorf("header names the %s column twice", name)
+		}
+		switch name {
+		case "timestamp", "metric", "value", "namespace":
+		default:
+			// Further columns are labels the rules select series by
+			if errs := validation.IsQualifiedName(name); len(errs) > 0 {
+				return fmt.Errorf("invalid label column %q: %s", name, strings.Join(errs, ", "))
+			}
+		}
+		columns[name] = i
+	}
+	for _, required := range []string{"timestamp", "metric", "value"} {
+		if _, exists := columns[required]; !exists {
+			return fmt.Errorf("header lacks the %s column", required)
+		}
+	}
+
+	for line := 2; ; line++ {
+		record, err := records.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+
+		timestamp, err := parseTraceTimestamp(record[columns["timestamp"]])
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		metric := strings.TrimSpace(record[columns["metric"]])
+		if metric == "" {
+			return fmt.Errorf("line %d: missing metric", line)
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(record[columns["value"]]), 64)
+		// ParseFloat accepts NaN and Inf, they would poison every aggregation and algorithm of the replayed rules
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("line %d: invalid value %q", line, record[columns["value"]])
+		}
+		var namespace string
+		seriesLabels := make(map[string]string)
+		for name, i := range columns {
+			switch name {
+			case "timestamp", "metric", "value":
+			case "namespace":
+				namespace = record[i]
+			default:
+				if record[i] != "" {
+					seriesLabels[name] = record[i]
+				}
+			}
+		}
+		add(timestamp, metric, namespace, seriesLabels, value)
+	}
+}
+
+// parseTraceTimestamp accepts RFC 3339 timestamps and (fractional) unix seconds.
+func parseTraceTimestamp(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(seconds) && !math.IsInf(seconds, 0) {
+		return time.Unix(0, int64(seconds*float64(time.Second))), nil
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q, expected RFC 3339 or unix seconds", value)
+	}
+	return timestamp, nil
+}
@@ -0,0 +1,308 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"context"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var traceEpoch = time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+type tracedSample struct {
+	timestamp time.Time
+	metric    string
+	namespace string
+	labels    map[string]string
+	value     float64
+}
+
+// collect returns an addFunc recording the added samples.
+func collect(samples *[]tracedSample) addFunc {
+	return func(timestamp time.Time, metric string, namespace string, seriesLabels map[string]string, value float64) {
+		*samples = append(*samples, tracedSample{timestamp: timestamp, metric: metric, namespace: namespace, labels: seriesLabels, value: value})
+	}
+}
+
+func equalTraced(a, b []tracedSample) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].timestamp.Equal(b[i].timestamp) || a[i].metric != b[i].metric || a[i].namespace != b[i].namespace ||
+			a[i].value != b[i].value || (len(a[i].labels) > 0 || len(b[i].labels) > 0) && !reflect.DeepEqual(a[i].labels, b[i].labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReadCSVTrace(t *testing.T) {
+	var samples []tracedSample
+	err := readCSVTrace(strings.NewReader(`timestamp, metric, value, namespace, queue
+2019-06-01T12:00:00Z, queue_length, 3, shop, mail
+1559390410.5, queue_length, 4.5, , print
+2019-06-01T12:00:20+02:00,queue_length, -1,shop,
+`), collect(&samples))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []tracedSample{
+		{traceEpoch, "queue_length", "shop", map[string]string{"queue": "mail"}, 3},
+		{traceEpoch.Add(10500 * time.Millisecond), "queue_length", "", map[string]string{"queue": "print"}, 4.5},
+		{traceEpoch.Add(20*time.Second - 2*time.Hour), "queue_length", "shop", nil, -1},
+	}
+	if !equalTraced(samples, expected) {
+		t.Errorf("samples %+v, expected %+v", samples, expected)
+	}
+}
+
+func TestReadCSVTraceErrors(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"empty", "", "missing header"},
+		{"missing metric column", "timestamp,value\n1,2\n", "header lacks the metric column"},
+		{"missing value column", "timestamp,metric\n1,queue\n", "header lacks the value column"},
+		{"duplicate column", "timestamp,metric,value,metric\n1,queue,2,queue\n", "names the metric column twice"},
+		{"invalid label column", "timestamp,metric,value,queue name\n1,queue,2,mail\n", `invalid label column "queue name"`},
+		{"empty label column", "timestamp,metric,value,\n1,queue,2,mail\n", `invalid label column ""`},
+		{"empty metric", "timestamp,metric,value\n1,queue,2\n2, ,3\n", "line 3: missing metric"},
+		{"invalid value", "timestamp,metric,value\n1,queue,many\n", `line 2: invalid value "many"`},
+		{"invalid timestamp", "timestamp,metric,value\nyesterday,queue,1\n", `line 2: invalid timestamp "yesterday"`},
+		{"NaN value", "timestamp,metric,value\n1,queue,2\n2,queue,NaN\n", `line 3: invalid value "NaN"`},
+		{"infinite value", "timestamp,metric,value\n1,queue,+Inf\n", `line 2: invalid value "+Inf"`},
+		{"negative infinite value", "timestamp,metric,value\n1,queue,-infinity\n", `line 2: invalid value "-infinity"`},
+		{"overflowing value", "timestamp,metric,value\n1,queue,1e400\n", `line 2: invalid value "1e400"`},
+		{"NaN timestamp", "timestamp,metric,value\nNaN,queue,1\n", `line 2: invalid timestamp "NaN"`},
+		{"missing field", "timestamp,metric,value\n1,queue\n", "line 2:"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var samples []tracedSample
+			err := readCSVTrace(strings.NewReader(test.input), collect(&samples))
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("readCSVTrace() = %v, expected an error containing %q", err, test.expected)
+			}
+		})
+	}
+}
+
+func TestReadJSONLTrace(t *testing.T) {
+	var samples []tracedSample
+	err := readJSONLTrace(strings.NewReader(`{"timestamp": "2019-06-01T12:00:00Z", "metric": "queue_length", "value": 3, "namespace": "shop", "labels": {"queue": "mail"}}
+
+{"timestamp": 1559390410.5, "metric": "queue_length", "value": 4.5}
+{"timestamp": "1559390420", "metric": "queue_age", "value": 60}
+`), collect(&samples))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []tracedSample{
+		{traceEpoch, "queue_length", "shop", map[string]string{"queue": "mail"}, 3},
+		{traceEpoch.Add(10500 * time.Millisecond), "queue_length", "", nil, 4.5},
+		{traceEpoch.Add(20 * time.Second), "queue_age", "", nil, 60},
+	}
+	if !equalTraced(samples, expected) {
+		t.Errorf("samples %+v, expected %+v", samples, expected)
+	}
+
+	for _, test := range []struct {
+		input    string
+		expected string
+	}{
+		{`{"timestamp": 1, "metric": "queue_length", "value": 3`, "line 1:"},
+		{`{"metric": "queue_length", "value": 3}`, "line 1: invalid timestamp"},
+		{`{"timestamp": true, "metric": "queue_length", "value": 3}`, `line 1: invalid timestamp "true"`},
+		{`{"timestamp": "Inf", "metric": "queue_length", "value": 3}`, `line 1: invalid timestamp "Inf"`},
+		{"{\"timestamp\": 1, \"value\": 3}", "line 1: missing metric"},
+		{`{"timestamp": 1, "metric": "queue_length", "value": "3"}`, "line 1:"},
+	} {
+		if err := readJSONLTrace(strings.NewReader(test.input), collect(&samples)); err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("readJSONLTrace(%s) = %v, expected an error containing %q", test.input, err, test.expected)
+		}
+	}
+}
+
+// writeTrace writes the trace file into a new temporary directory.
+func writeTrace(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return writeFile(t, dir, name, content)
+}
+
+func TestLoadTrace(t *testing.T) {
+	csvFile := writeTrace(t, "queue.csv", "timestamp,metric,value,queue\n20,queue_length,2,mail\n10,queue_length,1,mail\n15,queue_length,7,print\n")
+	jsonlFile := writeTrace(t, "age.ndjson", `{"timestamp": 30, "metric": "queue_age", "value": 60}`)
+
+	trace, err := loadTrace(config.ReplayConfig{Files: []string{csvFile, jsonlFile}, Clock: config.ReplayClockVirtual, Speed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !trace.start.Equal(time.Unix(10, 0)) || !trace.end.Equal(time.Unix(30, 0)) {
+		t.Errorf("trace from %v to %v, expected 10s to 30s", trace.start.Unix(), trace.end.Unix())
+	}
+	if len(trace.series) != 3 {
+		t.Fatalf("%d series, expected 3", len(trace.series))
+	}
+	for _, series := range trace.series {
+		if series.labels["queue"] == "mail" && (len(series.points) != 2 || series.points[0].value != 1 || series.points[1].value != 2) {
+			t.Errorf("points %+v not sorted by time", series.points)
+		}
+	}
+
+	for _, test := range []struct {
+		name     string
+		files    []string
+		expected string
+	}{
+		{"unknown format", []string{writeTrace(t, "queue.txt", "queue_length 1")}, "unknown trace format"},
+		{"missing file", []string{csvFile + ".missing"}, "no such file"},
+		{"no samples", []string{writeTrace(t, "empty.csv", "timestamp,metric,value\n")}, "contain no samples"},
+		{"invalid file", []string{csvFile, writeTrace(t, "broken.csv", "timestamp,value\n")}, "broken.csv: header lacks the metric column"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadTrace(config.ReplayConfig{Files: test.files, Clock: config.ReplayClockVirtual, Speed: 1})
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("loadTrace() = %v, expected an error containing %q", err, test.expected)
+			}
+		})
+	}
+}
+
+func TestTraceNow(t *testing.T) {
+	loaded := time.Now()
+	start := traceEpoch
+	for _, test := range []struct {
+		name     string
+		config   config.ReplayConfig
+		elapsed  time.Duration
+		expected time.Time
+	}{
+		{"virtual", config.ReplayConfig{Clock: config.ReplayClockVirtual, Speed: 1}, 30 * time.Second, start.Add(30 * time.Second)},
+		{"speed", config.ReplayConfig{Clock: config.ReplayClockVirtual, Speed: 4}, 30 * time.Second, start.Add(2 * time.Minute)},
+		{"slow motion", config.ReplayConfig{Clock: config.ReplayClockVirtual, Speed: 0.5}, 30 * time.Second, start.Add(15 * time.Second)},
+		{"past the end", config.ReplayConfig{Clock: config.ReplayClockVirtual, Speed: 1}, 5 * time.Minute, start.Add(5 * time.Minute)},
+		{"loop", config.ReplayConfig{Clock: config.ReplayClockVirtual, Speed: 1, Loop: true}, 5 * time.Minute, start.Add(time.Minute)},
+		{"loop with speed", config.ReplayConfig{Clock: config.ReplayClockVirtual, Speed: 2, Loop: true}, 150 * time.Second, start.Add(time.Minute)},
+		{"wall", config.ReplayConfig{Clock: config.ReplayClockWall, Speed: 4}, 30 * time.Second, loaded.Add(30 * time.Second)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			trace := &trace{config: test.config, start: start, end: start.Add(2 * time.Minute), loaded: loaded}
+			if now := trace.now(loaded.Add(test.elapsed)); !now.Equal(test.expected) {
+				t.Errorf("trace time %v, expected %v", now, test.expected)
+			}
+		})
+	}
+}
+
+func TestSameReplay(t *testing.T) {
+	base := config.ReplayConfig{Files: []string{"a.csv", "b.csv"}, Clock: config.ReplayClockVirtual, Speed: 1}
+	if !sameReplay(base, base) {
+		t.Error("configuration differs from itself")
+	}
+	global := base
+	global.Global = true
+	if !sameReplay(base, global) {
+		t.Error("replaying for all rules must not reload the traces")
+	}
+
+	for name, change := range map[string]func(c *config.ReplayConfig){
+		"files":     func(c *config.ReplayConfig) { c.Files = []string{"a.csv"} },
+		"file name": func(c *config.ReplayConfig) { c.Files = []string{"a.csv", "c.csv"} },
+		"joined":    func(c *config.ReplayConfig) { c.Files = []string{"a.csv\x00b.csv"} },
+		"order":     func(c *config.ReplayConfig) { c.Files = []string{"b.csv", "a.csv"} },
+		"clock":     func(c *config.ReplayConfig) { c.Clock = config.ReplayClockWall },
+		"speed":     func(c *config.ReplayConfig) { c.Speed = 2 },
+		"loop":      func(c *config.ReplayConfig) { c.Loop = true },
+	} {
+		changed := base
+		changed.Files = append([]string(nil), base.Files...)
+		change(&changed)
+		if sameReplay(base, changed) {
+			t.Errorf("change of the %s not detected", name)
+		}
+	}
+}
+
+func TestReplaySource(t *testing.T) {
+	file := writeTrace(t, "queue.csv", `timestamp,metric,value,namespace,queue
+2019-06-01T12:00:00Z,queue_length,1,shop,mail
+2019-06-01T12:00:10Z,queue_length,2,shop,mail
+2019-06-01T12:00:20Z,queue_length,3,shop,mail
+2019-06-01T12:00:05Z,queue_length,9,other,mail
+2019-06-01T12:00:05Z,queue_length,5,,print
+`)
+	metricsConfig := config.Default().Metrics
+	metricsConfig.Replay.Files = []string{file}
+	Configure(metricsConfig)
+	defer Configure(config.Default().Metrics)
+
+	source := NewReplaySource().(*replaySource)
+	trace, err := source.currentTrace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Move the virtual clock to 12:00:15
+	trace.loaded = time.Now().Add(-15 * time.Second)
+
+	samples, err := source.Fetch(context.Background(), testQuery("queue_length"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]int64)
+	for _, sample := range samples {
+		values[sample.Labels["queue"]] = sample.Value.MilliValue()
+		if age := time.Since(sample.Timestamp); sample.Labels["queue"] == "mail" && (age < 5*time.Second || age > 6*time.Second) {
+			t.Errorf("sample aged %v, expected 5s as recorded at 12:00:10", age)
+		}
+	}
+	if !reflect.DeepEqual(values, map[string]int64{"mail": 2000, "print": 5000}) {
+		t.Errorf("values %v, expected mail 2 of the namespace and print 5 of all namespaces", values)
+	}
+
+	query := testQuery("queue_length")
+	query.Rule.Spec.MetricSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"queue": "print"}}
+	if samples, err := source.Fetch(context.Background(), query); err != nil || len(samples) != 1 || samples[0].Value.MilliValue() != 5000 {
+		t.Errorf("Fetch() of the selected series = %+v, %v", samples, err)
+	}
+	if _, err := source.Fetch(context.Background(), testQuery("queue_age")); !IsNotFound(err) {
+		t.Errorf("Fetch() of an unrecorded metric = %v, expected not found", err)
+	}
+
+	// The trace is kept while the configuration stays the same and reloaded if it changes
+	if current, _ := source.currentTrace(); current != trace {
+		t.Error("trace reloaded without a change of the configuration")
+	}
+	metricsConfig.Replay.Speed = 2
+	Configure(metricsConfig)
+	if current, _ := source.currentTrace(); current == trace || current.config.Speed != 2 {
+		t.Error("trace not reloaded after changing the speed")
+	}
+
+	metricsConfig.Replay.Files = nil
+	Configure(metricsConfig)
+	if _, err := source.Fetch(context.Background(), testQuery("queue_length")); !IsInvalid(err) {
+		t.Errorf("Fetch() without traces = %v, expected invalid", err)
+	}
+}
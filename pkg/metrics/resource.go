@@ -0,0 +1,232 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"time"
+)
+
+// ResourceName is the name of the source computing the utilization of the target's pods from the resource metrics
+// API. The metric of a rule is the resource, cpu or memory, its value the utilization in percent of the requests.
+const ResourceName = "resource"
+
+// States of the pods in the cached samples of the resource source.
+const (
+	stateReady   = "ready"
+	stateUnready = "unready"
+	stateMissing = "missing"
+)
+
+const (
+	// cpuInitializationPeriod and initialReadinessDelay match the defaults of the HorizontalPodAutoscaler
+	cpuInitializationPeriod = 5 * time.Minute
+	initialReadinessDelay   = 30 * time.Second
+)
+
+// podMetricsList is the part of a metrics.k8s.io PodMetricsList the source works with.
+type podMetricsList struct {
+	Items []podMetrics `json:"items"`
+}
+
+type podMetrics struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Window     metav1.Duration `json:"window"`
+	Containers []struct {
+		Name  string              `json:"name"`
+		Usage corev1.ResourceList `json:"usage"`
+	} `json:"containers"`
+}
+
+type resourceSource struct {
+	kubeclientset kubernetes.Interface
+}
+
+// NewResourceSource reads the pod metrics of the target's pods from the resource metrics API.
+func NewResourceSource(kubeclientset kubernetes.Interface) MetricSource {
+	return &resourceSource{kubeclientset: kubeclientset}
+}
+
+func (s *resourceSource) Name() string {
+	return ResourceName
+}
+
+// CacheKey separates the pods of different targets, the rules of a target share them.
+func (s *resourceSource) CacheKey(query Query) string {
+	return targetKey(query.Target)
+}
+
+// targetUtilization is the utilization the rule aims for, either its desired usage or the middle of its thresholds.
+// It decides whether pods without usable metrics are rebalanced for scaling up or down.
+func targetUtilization(query Query) float64 {
+	if desired := query.Rule.Spec.AutoMode.Limits.DesiredUsage; !desired.IsZero() {
+		return float64(desired.MilliValue()) / 1000
+	}
+	thresholds := query.Rule.Spec.Thresholds
+	return float64(thresholds.UpperThreshold.MilliValue()+thresholds.LowerThreshold.MilliValue()) / 2000
+}
+
+// unready reports whether the metric of a pod has to be ignored, like the HorizontalPodAutoscaler does for cpu:
+// pods that are not ready, and pods that became ready so recently that the metric still covers their startup.
+func unready(pod *corev1.Pod, metric podMetrics, resourceName corev1.ResourceName) bool {
+	if resourceName != corev1.ResourceCPU {
+		return false
+	}
+	if pod.Status.StartTime == nil {
+		return true
+	}
+	ready, transition := podReady(pod)
+	if pod.Status.StartTime.Add(cpuInitializationPeriod).After(time.Now()) {
+		return !ready || metric.Timestamp.Before(transition.Add(metric.Window.Duration))
+	}
+	return !ready && pod.Status.StartTime.Add(initialReadinessDelay).After(transition)
+}
+
+func podRequest(pod *corev1.Pod, resourceName corev1.ResourceName) (int64, error) {
+	var request int64
+	for _, container := range pod.Spec.Containers {
+		quantity, exists := container.Resources.Requests[resourceName]
+		if !exists {
+			return 0, fmt.Errorf("container %s of pod %s has no %s request", container.Name, pod.Name, resourceName)
+		}
+		request += quantity.MilliValue()
+	}
+	return request, nil
+}
+
+func podUsage(metric podMetrics, resourceName corev1.ResourceName) int64 {
+	var usage int64
+	for _, container := range metric.Containers {
+		if quantity, exists := container.Usage[resourceName]; exists {
+			usage += quantity.MilliValue()
+		}
+	}
+	return usage
+}
+
+func (s *resourceSource) Fetch(ctx context.Context, query Query) ([]Sample, error) {
+	resourceName := corev1.ResourceName(query.Metric)
+	if resourceName != corev1.ResourceCPU && resourceName != corev1.ResourceMemory {
+		return nil, NewError(ErrorInvalid, ResourceName, fmt.Errorf("unsupported resource %q, expected cpu or memory", query.Metric))
+	}
+
+	selector, err := targetSelector(s.kubeclientset, ResourceName, query.Target)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := s.kubeclientset.CoreV1().Pods(query.Target.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, classify(ResourceName, err)
+	}
+
+	data, err := s.kubeclientset.Discovery().RESTClient().Get().
+		AbsPath(currentSettings().ResourceMetricsPath, "namespaces", query.Target.Namespace, "pods").
+		Param("labelSelector", selector.String()).Context(ctx).DoRaw()
+	if err != nil {
+		return nil, classify(ResourceName, err)
+	}
+	var list podMetricsList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, NewError(ErrorTransient, ResourceName, fmt.Errorf("could not decode pod metrics: %v", err))
+	}
+	podMetrics := make(map[string]podMetrics, len(list.Items))
+	for _, metric := range list.Items {
+		podMetrics[metric.Metadata.Name] = metric
+	}
+
+	// The samples of all pods are cached, the utilization depends on the rule and is computed by Rebalance
+	var samples []Sample
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded {
+			continue
+		}
+		request, err := podRequest(pod, resourceName)
+		if err != nil {
+			return nil, NewError(ErrorInvalid, ResourceName, err)
+		}
+
+		sample := Sample{Labels: map[string]string{"resource": string(resourceName), "name": pod.Name}, request: request}
+		metric, found := podMetrics[pod.Name]
+		switch {
+		case !found:
+			sample.Labels["state"] = stateMissing
+		case unready(pod, metric, resourceName):
+			sample.Labels["state"] = stateUnready
+		default:
+			sample.Labels["state"] = stateReady
+			sample.Value = *resource.NewMilliQuantity(podUsage(metric, resourceName), resource.DecimalSI)
+			sample.Timestamp = metric.Timestamp
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// Rebalance computes the utilization of the target's pods like the HorizontalPodAutoscaler: when scaling up, pods
+// without usable metrics are assumed to use nothing, when scaling down missing pods are assumed to use their full
+// request and unready pods are ignored.
+func (s *resourceSource) Rebalance(query Query, samples []Sample) ([]Sample, error) {
+	var (
+		usage, requests                  int64
+		missingRequests, unreadyRequests int64
+		timestamp                        time.Time
+	)
+	resourceName := query.Metric
+	for _, sample := range samples {
+		switch sample.Labels["state"] {
+		case stateMissing:
+			missingRequests += sample.request
+		case stateUnready:
+			unreadyRequests += sample.request
+		default:
+			usage += sample.Value.MilliValue()
+			requests += sample.request
+			if sample.Timestamp.After(timestamp) {
+				timestamp = sample.Timestamp
+			}
+		}
+	}
+	if requests == 0 {
+		return nil, NewError(ErrorNotFound, ResourceName, fmt.Errorf("no ready pods with %s metrics", resourceName))
+	}
+
+	utilization := float64(usage) * 100 / float64(requests)
+	if missingRequests > 0 || unreadyRequests > 0 {
+		target := targetUtilization(query)
+		scaleUp := utilization > target
+		adjustedUsage, adjustedRequests := float64(usage), float64(requests+missingRequests)
+		if scaleUp {
+			adjustedRequests += float64(unreadyRequests)
+		} else {
+			adjustedUsage += float64(missingRequests)
+		}
+		adjusted := adjustedUsage * 100 / adjustedRequests
+		// The adjustment must not flip the direction of scaling
+		if (scaleUp && adjusted > target) || (!scaleUp && adjusted <= target) {
+			utilization = adjusted
+		} else {
+			utilization = target
+		}
+	}
+
+	return []Sample{{Value: floatQuantity(utilization), Timestamp: timestamp, Labels: map[string]string{"resource": resourceName}}}, nil
+}
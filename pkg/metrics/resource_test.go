@@ -0,0 +1,184 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"context"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+	"time"
+)
+
+// resourceQuery queries the cpu utilization for a rule desiring the given usage.
+func resourceQuery(desiredUsage string) Query {
+	query := testQuery("cpu")
+	query.Rule = &v1.AutoscalingRule{}
+	query.Rule.Spec.AutoMode.Limits.DesiredUsage = resource.MustParse(desiredUsage)
+	return query
+}
+
+func stateSample(state string, usage int64, request int64) Sample {
+	sample := Sample{Labels: map[string]string{"resource": "cpu", "state": state}, request: request}
+	if state == stateReady {
+		sample.Value = *resource.NewMilliQuantity(usage, resource.DecimalSI)
+	}
+	return sample
+}
+
+func TestResourceRebalance(t *testing.T) {
+	thresholdQuery := testQuery("cpu")
+	thresholdQuery.Rule = &v1.AutoscalingRule{}
+	thresholdQuery.Rule.Spec.Thresholds = v1.Thresholds{UpperThreshold: resource.MustParse("80"), LowerThreshold: resource.MustParse("40")}
+
+	tests := []struct {
+		name        string
+		query       Query
+		samples     []Sample
+		utilization float64
+	}{
+		{"ready pods only", resourceQuery("50"), []Sample{stateSample(stateReady, 1000, 2000)}, 50},
+		{"scale up counts missing pods as idle", resourceQuery("50"),
+			[]Sample{stateSample(stateReady, 1800, 2000), stateSample(stateMissing, 0, 1000)}, 60},
+		{"scale up counts unready pods as idle", resourceQuery("50"),
+			[]Sample{stateSample(stateReady, 1800, 2000), stateSample(stateUnready, 0, 1000)}, 60},
+		{"scale up does not flip", resourceQuery("50"),
+			[]Sample{stateSample(stateReady, 1200, 2000), stateSample(stateMissing, 0, 2000)}, 50},
+		{"scale down counts missing pods at their request", resourceQuery("50"),
+			[]Sample{stateSample(stateReady, 400, 2000), stateSample(stateMissing, 0, 500)}, 36},
+		{"scale down ignores unready pods", resourceQuery("50"),
+			[]Sample{stateSample(stateReady, 400, 2000), stateSample(stateUnready, 0, 1000)}, 20},
+		{"scale down does not flip", resourceQuery("50"),
+			[]Sample{stateSample(stateReady, 400, 2000), stateSample(stateMissing, 0, 4000)}, 50},
+		{"target from thresholds", thresholdQuery,
+			[]Sample{stateSample(stateReady, 1000, 2000), stateSample(stateMissing, 0, 1000)}, 60},
+	}
+	source := &resourceSource{}
+	for _, test := range tests {
+		samples, err := source.Rebalance(test.query, test.samples)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(samples) != 1 || samples[0].Value.Cmp(floatQuantity(test.utilization)) != 0 {
+			t.Errorf("%s: got %v, expected utilization %v", test.name, samples, test.utilization)
+		}
+	}
+
+	_, err := source.Rebalance(resourceQuery("50"), []Sample{stateSample(stateMissing, 0, 1000), stateSample(stateUnready, 0, 1000)})
+	if !IsNotFound(err) {
+		t.Errorf("expected not found without ready pods, got %v", err)
+	}
+}
+
+func TestResourceUnready(t *testing.T) {
+	now := time.Now()
+	pod := func(started time.Duration, ready bool, transition time.Duration) *corev1.Pod {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		startTime := metav1.NewTime(now.Add(-started))
+		return &corev1.Pod{Status: corev1.PodStatus{
+			StartTime: &startTime,
+			Conditions: []corev1.PodCondition{
+				{Type: corev1.PodReady, Status: status, LastTransitionTime: metav1.NewTime(now.Add(-transition))},
+			},
+		}}
+	}
+	metric := podMetrics{Timestamp: now, Window: metav1.Duration{Duration: 30 * time.Second}}
+
+	tests := []struct {
+		name     string
+		pod      *corev1.Pod
+		resource corev1.ResourceName
+		unready  bool
+	}{
+		{"not started", &corev1.Pod{}, corev1.ResourceCPU, true},
+		{"initializing and not yet ready", pod(time.Minute, false, time.Minute), corev1.ResourceCPU, true},
+		{"initializing, metric covers startup", pod(time.Minute, true, 10*time.Second), corev1.ResourceCPU, true},
+		{"initializing and ready", pod(time.Minute, true, 40*time.Second), corev1.ResourceCPU, false},
+		{"initialized, never ready", pod(10*time.Minute, false, 10*time.Minute-10*time.Second), corev1.ResourceCPU, true},
+		{"initialized, was ready", pod(10*time.Minute, false, 2*time.Minute), corev1.ResourceCPU, false},
+		{"initialized and ready", pod(10*time.Minute, true, 9*time.Minute), corev1.ResourceCPU, false},
+		{"memory of a pod not yet ready", pod(time.Minute, false, time.Minute), corev1.ResourceMemory, false},
+	}
+	for _, test := range tests {
+		if unready := unready(test.pod, metric, test.resource); unready != test.unready {
+			t.Errorf("%s: got unready %v, expected %v", test.name, unready, test.unready)
+		}
+	}
+}
+
+func TestResourceSourceSharesPodsAcrossRules(t *testing.T) {
+	Configure(config.Default().Metrics)
+	now := time.Now()
+	resourcePod := func(name string, ready bool, started time.Duration) corev1.Pod {
+		pod := testPod(name, "", ready)
+		startTime := metav1.NewTime(now.Add(-started))
+		pod.Status.StartTime = &startTime
+		pod.Status.Conditions[0].LastTransitionTime = startTime
+		pod.Spec.Containers = []corev1.Container{{Name: "app", Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m")},
+		}}}
+		return pod
+	}
+	finished := resourcePod("web-d", true, time.Hour)
+	finished.Status.Phase = corev1.PodSucceeded
+	pods := []corev1.Pod{resourcePod("web-a", true, time.Hour), resourcePod("web-b", true, time.Hour),
+		resourcePod("web-c", false, time.Minute), finished}
+
+	metric := func(name string, usage string) map[string]interface{} {
+		return map[string]interface{}{
+			"metadata":   map[string]string{"name": name},
+			"timestamp":  now.UTC().Format(time.RFC3339),
+			"window":     "30s",
+			"containers": []map[string]interface{}{{"name": "app", "usage": map[string]string{"cpu": usage}}},
+		}
+	}
+	// web-b has no metrics, web-c is not ready yet
+	metrics := map[string]interface{}{"items": []interface{}{metric("web-a", "180m"), metric("web-c", "200m"), metric("web-d", "200m")}}
+	source := NewResourceSource(newPodServer(t, pods, map[string]interface{}{"/apis/metrics.k8s.io/v1beta1/namespaces/shop/pods": metrics}))
+
+	scaleUp, scaleDown := resourceQuery("25"), resourceQuery("95")
+	upKey, _ := cacheKey(source, scaleUp)
+	downKey, _ := cacheKey(source, scaleDown)
+	if upKey != downKey {
+		t.Errorf("rules with different targets use the cache keys %q and %q", upKey, downKey)
+	}
+
+	cache := NewCache()
+	tests := []struct {
+		query       Query
+		utilization float64
+	}{
+		// 180m of 600m including the missing and the unready pod
+		{scaleUp, 30},
+		// 180m of 200m plus 200m of the missing pod
+		{scaleDown, 95},
+	}
+	for _, test := range tests {
+		samples, err := cache.Fetch(context.Background(), source, test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(samples) != 1 || samples[0].Value.Cmp(floatQuantity(test.utilization)) != 0 {
+			t.Errorf("got %v, expected utilization %v", samples, test.utilization)
+		}
+		if !samples[0].Timestamp.Equal(now.Truncate(time.Second)) {
+			t.Errorf("got timestamp %v, expected %v", samples[0].Timestamp, now.Truncate(time.Second))
+		}
+	}
+}
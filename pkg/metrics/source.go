@@ -0,0 +1,125 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package metrics
+
+import (
+	"context"
+	"fmt"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/util"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sample is a single value of a metric series, the labels identify the series.
+type Sample struct {
+	Value     resource.Quantity
+	Timestamp time.Time
+	Labels    map[string]string
+	// request is the resource request in milli units of the pod of a resource sample
+	request int64
+}
+
+// Query asks a source for a metric of a rule. Sources may read additional, source specific fields of the rule.
+type Query struct {
+	Rule      *v1.AutoscalingRule
+	Namespace string
+	Metric    string
+	// Delta is set if the metric is the delta metric of the rule
+	Delta bool
+	// Target is the workload the rule is evaluated for
+	Target util.Target
+}
+
+// MetricSource retrieves metrics from a backend. It returns all series matching the query, errors are wrapped
+// into an *Error classifying them.
+type MetricSource interface {
+	Name() string
+	Fetch(ctx context.Context, query Query) ([]Sample, error)
+}
+
+// DefaultSource is used for rules that do not name a source.
+const DefaultSource = CustomName
+
+var (
+	sourcesMutex sync.RWMutex
+	sources      = make(map[string]MetricSource)
+)
+
+// Register makes a source available to rules. Sources depending on clients are registered at startup.
+func Register(source MetricSource) {
+	sourcesMutex.Lock()
+	defer sourcesMutex.Unlock()
+
+	if _, exists := sources[source.Name()]; exists {
+		panic(fmt.Sprintf("metric source %s registered twice", source.Name()))
+	}
+	sources[source.Name()] = source
+}
+
+func Get(name string) (MetricSource, error) {
+	sourcesMutex.RLock()
+	defer sourcesMutex.RUnlock()
+
+	source, exists := sources[name]
+	if !exists {
+		names := make([]string, 0, len(sources))
+		for n := range sources {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, NewError(ErrorInvalid, name, fmt.Errorf("unknown metric source %q, available: %v", name, names))
+	}
+	return source, nil
+}
+
+// MetricSelector returns the label selector restricting the series of the queried metric, an empty string if the
+// rule does not restrict them.
+func (q Query) MetricSelector() (string, error) {
+	selector := q.Rule.Spec.MetricSelector
+	if q.Delta && q.Rule.Spec.DeltaMetricSelector != nil {
+		selector = q.Rule.Spec.DeltaMetricSelector
+	}
+	if selector == nil {
+		return "", nil
+	}
+	parsed, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return "", err
+	}
+	return parsed.String(), nil
+}
+
+// Aggregation returns the aggregation combining the series of the queried metric.
+func (q Query) Aggregation() string {
+	if q.Delta && q.Rule.Spec.DeltaAggregation != "" {
+		return q.Rule.Spec.DeltaAggregation
+	}
+	if q.Rule.Spec.Aggregation != "" {
+		return q.Rule.Spec.Aggregation
+	}
+	return DefaultAggregation
+}
+
+// ForRule returns the source named by the rule, or the replay source if traces are replayed for all rules.
+func ForRule(rule *v1.AutoscalingRule) (MetricSource, error) {
+	if currentSettings().Replay.Global {
+		return Get(ReplayName)
+	}
+	if rule.Spec.Source == "" {
+		return Get(DefaultSource)
+	}
+	return Get(rule.Spec.Source)
+}
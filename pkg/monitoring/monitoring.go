@@ -0,0 +1,154 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+// Package monitoring exposes the controller's own metrics in the Prometheus text format.
+package monitoring
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type metricType string
+
+const (
+	gauge   metricType = "gauge"
+	counter metricType = "counter"
+)
+
+type sample struct {
+	labelValues []string
+	value       float64
+}
+
+type metricVec struct {
+	name       string
+	help       string
+	metricType metricType
+	labelNames []string
+
+	mutex   sync.Mutex
+	samples map[string]*sample
+}
+
+type GaugeVec struct {
+	*metricVec
+}
+
+type CounterVec struct {
+	*metricVec
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      []*metricVec
+)
+
+func register(name string, help string, metricType metricType, labelNames []string) *metricVec {
+	vec := &metricVec{name: name, help: help, metricType: metricType, labelNames: labelNames, samples: make(map[string]*sample)}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registry = append(registry, vec)
+	return vec
+}
+
+func NewGaugeVec(name string, help string, labelNames ...string) GaugeVec {
+	return GaugeVec{register(name, help, gauge, labelNames)}
+}
+
+func NewCounterVec(name string, help string, labelNames ...string) CounterVec {
+	return CounterVec{register(name, help, counter, labelNames)}
+}
+
+func (m *metricVec) sample(labelValues []string) *sample {
+	if len(labelValues) != len(m.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", m.name, len(m.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, exists := m.samples[key]
+	if !exists {
+		s = &sample{labelValues: append([]string(nil), labelValues...)}
+		m.samples[key] = s
+	}
+	return s
+}
+
+func (m *metricVec) Delete(labelValues ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.samples, strings.Join(labelValues, "\xff"))
+}
+
+func (g GaugeVec) Set(value float64, labelValues ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.sample(labelValues).value = value
+}
+
+func (c CounterVec) Add(value float64, labelValues ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.sample(labelValues).value += value
+}
+
+func (c CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func (m *metricVec) write(w *strings.Builder) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.metricType)
+
+	keys := make([]string, 0, len(m.samples))
+	for key := range m.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := m.samples[key]
+		w.WriteString(m.name)
+		if len(m.labelNames) > 0 {
+			pairs := make([]string, len(m.labelNames))
+			for i, labelName := range m.labelNames {
+				pairs[i] = fmt.Sprintf(`%s="%s"`, labelName, labelValueEscaper.Replace(s.labelValues[i]))
+			}
+			fmt.Fprintf(w, "{%s}", strings.Join(pairs, ","))
+		}
+		fmt.Fprintf(w, " %v\n", s.value)
+	}
+}
+
+// Handler serves all registered metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registryMutex.Lock()
+		vecs := append([]*metricVec(nil), registry...)
+		registryMutex.Unlock()
+
+		var builder strings.Builder
+		for _, vec := range vecs {
+			vec.write(&builder)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(builder.String()))
+	})
+}
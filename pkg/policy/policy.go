@@ -0,0 +1,138 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+// Package policy decides which workloads the rules of a namespace may scale and which namespaces they may read
+// metrics from.
+package policy
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"path"
+	"sync"
+)
+
+type entry struct {
+	ruleNamespaces   []string
+	targetNamespaces []string
+	selector         labels.Selector
+}
+
+type policy struct {
+	enabled            bool
+	allowSameNamespace bool
+	entries            []entry
+}
+
+var (
+	policyMutex sync.RWMutex
+	current     = policy{}
+)
+
+// Configure replaces the active policy, the configuration is expected to be validated.
+func Configure(policyConfig config.PolicyConfig) {
+	p := policy{enabled: policyConfig.Enabled, allowSameNamespace: policyConfig.AllowSameNamespace}
+	for _, allow := range policyConfig.Allow {
+		// Entries without selector permit all workloads, a nil selector would match none
+		selector := labels.Everything()
+		if allow.TargetSelector != nil {
+			var err error
+			if selector, err = metav1.LabelSelectorAsSelector(allow.TargetSelector); err != nil {
+				log.Errorf("Ignoring policy entry with invalid target selector: %v", err)
+				continue
+			}
+		}
+		p.entries = append(p.entries, entry{ruleNamespaces: allow.RuleNamespaces, targetNamespaces: allow.TargetNamespaces, selector: selector})
+	}
+
+	if !p.enabled {
+		log.Warn("Targeting policy disabled, rules of any namespace may scale every configured target")
+	}
+
+	policyMutex.Lock()
+	defer policyMutex.Unlock()
+	current = p
+}
+
+func active() policy {
+	policyMutex.RLock()
+	defer policyMutex.RUnlock()
+	return current
+}
+
+func matches(patterns []string, namespace string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, namespace); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// allows checks a rule namespace against a target namespace, target labels are only checked if not nil.
+func (p policy) allows(ruleNamespace string, targetNamespace string, targetLabels labels.Labels) bool {
+	if !p.enabled || (p.allowSameNamespace && ruleNamespace == targetNamespace) {
+		return true
+	}
+	for _, e := range p.entries {
+		if !matches(e.ruleNamespaces, ruleNamespace) || !matches(e.targetNamespaces, targetNamespace) {
+			continue
+		}
+		if targetLabels == nil || e.selector.Matches(targetLabels) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRule checks the parts of a rule that are known without a target, i.e. the namespace it reads metrics
+// from. It is used at admission.
+func ValidateRule(rule *v1.AutoscalingRule) error {
+	p := active()
+	if !p.enabled {
+		return nil
+	}
+	if rule.Spec.TargetNamespace == "" {
+		return fmt.Errorf("rules have to name their targetNamespace")
+	}
+	if !p.allows(rule.Namespace, rule.Spec.TargetNamespace, nil) {
+		return fmt.Errorf("rules in namespace %s may not target namespace %s", rule.Namespace, rule.Spec.TargetNamespace)
+	}
+	return nil
+}
+
+// MaySelect reports whether the rule may apply to targets in the given namespace at all. It is checked wherever
+// rules are selected for targets whose labels are not known, Permits decides once they are.
+func MaySelect(rule *v1.AutoscalingRule, namespace string) error {
+	if err := ValidateRule(rule); err != nil {
+		return err
+	}
+	if !active().allows(rule.Namespace, namespace, nil) {
+		return fmt.Errorf("rules in namespace %s may not scale workloads in namespace %s", rule.Namespace, namespace)
+	}
+	return nil
+}
+
+// Permits reports whether the rule may scale the given workload.
+func Permits(rule *v1.AutoscalingRule, namespace string, workloadLabels map[string]string) error {
+	if err := ValidateRule(rule); err != nil {
+		return err
+	}
+	workload := labels.Set(workloadLabels)
+	if !active().allows(rule.Namespace, namespace, workload) {
+		return fmt.Errorf("rules in namespace %s may not scale workloads in namespace %s with labels %q", rule.Namespace, namespace, workload.String())
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package policy
+
+import (
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"testing"
+)
+
+var testPolicy = config.PolicyConfig{
+	Enabled:            true,
+	AllowSameNamespace: true,
+	Allow: []config.PolicyEntry{
+		{RuleNamespaces: []string{"autoscaling"}, TargetNamespaces: []string{"*"}},
+		{RuleNamespaces: []string{"team-a-*"}, TargetNamespaces: []string{"shared"},
+			TargetSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"owner": "team-a"}}},
+	},
+}
+
+func rule(namespace, targetNamespace string) *v1.AutoscalingRule {
+	return &v1.AutoscalingRule{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "rule"},
+		Spec:       v1.AutoscalingRuleSpec{TargetNamespace: targetNamespace},
+	}
+}
+
+func TestAllows(t *testing.T) {
+	Configure(testPolicy)
+	p := active()
+	teamA, teamB := labels.Set{"owner": "team-a"}, labels.Set{"owner": "team-b"}
+
+	for _, test := range []struct {
+		name                           string
+		ruleNamespace, targetNamespace string
+		labels                         labels.Labels
+		allowed                        bool
+	}{
+		{"same namespace", "shop", "shop", teamB, true},
+		{"other namespace", "shop", "payments", nil, false},
+		{"central namespace", "autoscaling", "payments", teamB, true},
+		{"pattern with matching labels", "team-a-web", "shared", teamA, true},
+		{"pattern with other labels", "team-a-web", "shared", teamB, false},
+		{"pattern without labels", "team-a-web", "shared", nil, true},
+		{"pattern of other namespace", "team-b-web", "shared", teamA, false},
+		{"pattern with other target", "team-a-web", "payments", teamA, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if allowed := p.allows(test.ruleNamespace, test.targetNamespace, test.labels); allowed != test.allowed {
+				t.Errorf("allows(%s, %s, %v) = %v, expected %v", test.ruleNamespace, test.targetNamespace, test.labels, allowed, test.allowed)
+			}
+		})
+	}
+
+	withoutSameNamespace := testPolicy
+	withoutSameNamespace.AllowSameNamespace = false
+	Configure(withoutSameNamespace)
+	if active().allows("shop", "shop", nil) {
+		t.Errorf("same namespace allowed although disabled")
+	}
+
+	Configure(config.PolicyConfig{})
+	if !active().allows("shop", "payments", nil) {
+		t.Errorf("disabled policy rejects rules")
+	}
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	Configure(config.Default().Policy)
+	defer Configure(testPolicy)
+
+	if err := ValidateRule(rule("shop", "shop")); err != nil {
+		t.Errorf("rule targeting its own namespace rejected: %v", err)
+	}
+	if err := ValidateRule(rule("shop", "payments")); err == nil {
+		t.Errorf("cross-namespace rule admitted by the default policy")
+	}
+}
+
+func TestRuleChecks(t *testing.T) {
+	Configure(testPolicy)
+	teamA := map[string]string{"owner": "team-a"}
+
+	for _, test := range []struct {
+		name                                  string
+		rule                                  *v1.AutoscalingRule
+		namespace                             string
+		labels                                map[string]string
+		validates, maySelect, permits, reason bool
+	}{
+		{"own namespace", rule("shop", "shop"), "shop", nil, true, true, true, false},
+		{"missing target namespace", rule("shop", ""), "shop", nil, false, false, false, false},
+		{"metrics of other namespace", rule("shop", "payments"), "shop", nil, false, false, false, false},
+		// Rules are selected by every target without rule references, the target namespace of the rule does not
+		// restrict which workloads it scales
+		{"workload in other namespace", rule("shop", "shop"), "payments", nil, true, false, false, false},
+		{"central rule", rule("autoscaling", "payments"), "payments", nil, true, true, true, false},
+		{"team rule on own workload", rule("team-a-web", "shared"), "shared", teamA, true, true, true, false},
+		{"team rule on other workload", rule("team-a-web", "shared"), "shared", map[string]string{"owner": "team-b"}, true, true, false, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ValidateRule(test.rule); (err == nil) != test.validates {
+				t.Errorf("ValidateRule() = %v, expected valid %v", err, test.validates)
+			}
+			if err := MaySelect(test.rule, test.namespace); (err == nil) != test.maySelect {
+				t.Errorf("MaySelect() = %v, expected allowed %v", err, test.maySelect)
+			}
+			if err := Permits(test.rule, test.namespace, test.labels); (err == nil) != test.permits {
+				t.Errorf("Permits() = %v, expected allowed %v", err, test.permits)
+			}
+		})
+	}
+}
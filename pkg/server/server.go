@@ -0,0 +1,55 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package server
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"net/http"
+)
+
+type Server struct {
+	port int
+	mux  *http.ServeMux
+}
+
+func New(port int) *Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "ok")
+	})
+	return &Server{port: port, mux: mux}
+}
+
+// Handle registers an additional handler. It has to be called before Run.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+func (s *Server) Run() {
+	address := fmt.Sprintf(":%d", s.port)
+	log.Infof("HTTP server listening on %s", address)
+	if err := http.ListenAndServe(address, s.mux); err != nil {
+		log.Errorf("HTTP server stopped: %v", err)
+	}
+}
+
+// RunTLS serves via TLS with the given certificate and key files.
+func (s *Server) RunTLS(certFile string, keyFile string) {
+	address := fmt.Sprintf(":%d", s.port)
+	log.Infof("HTTPS server listening on %s", address)
+	if err := http.ListenAndServeTLS(address, certFile, keyFile, s.mux); err != nil {
+		log.Errorf("HTTPS server stopped: %v", err)
+	}
+}
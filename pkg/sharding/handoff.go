@@ -0,0 +1,96 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package sharding
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"strings"
+)
+
+// Handoff passes the state of targets from their previous to their new owner through a ConfigMap.
+type Handoff struct {
+	kubeclientset kubernetes.Interface
+	namespace     string
+	name          string
+}
+
+func NewHandoff(kubeclientset kubernetes.Interface, namespace string, name string) *Handoff {
+	return &Handoff{kubeclientset: kubeclientset, namespace: namespace, name: name}
+}
+
+// dataKey converts a target key into a valid ConfigMap key.
+func dataKey(key string) string {
+	return strings.Replace(key, "/", ".", -1)
+}
+
+// Store leaves the state of a target for its next owner.
+func (h *Handoff) Store(key string, state string) error {
+	configMaps := h.kubeclientset.CoreV1().ConfigMaps(h.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := configMaps.Get(h.name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			configMap = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: h.name, Namespace: h.namespace},
+				Data:       map[string]string{dataKey(key): state},
+			}
+			_, err = configMaps.Create(configMap)
+			if errors.IsAlreadyExists(err) {
+				// Created concurrently, retry as conflict
+				return errors.NewConflict(corev1.Resource("configmaps"), h.name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string)
+		}
+		configMap.Data[dataKey(key)] = state
+		_, err = configMaps.Update(configMap)
+		return err
+	})
+}
+
+// Take removes the state of a target and returns it, if its previous owner left one.
+func (h *Handoff) Take(key string) (string, bool, error) {
+	configMaps := h.kubeclientset.CoreV1().ConfigMaps(h.namespace)
+
+	var (
+		state string
+		found bool
+	)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := configMaps.Get(h.name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			found = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		state, found = configMap.Data[dataKey(key)]
+		if !found {
+			return nil
+		}
+		delete(configMap.Data, dataKey(key))
+		_, err = configMaps.Update(configMap)
+		return err
+	})
+	return state, found, err
+}
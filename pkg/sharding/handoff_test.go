@@ -0,0 +1,171 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package sharding
+
+import (
+	"encoding/json"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// configMapServer serves the ConfigMaps of a namespace like the API server, updates with an outdated
+// resourceVersion are rejected as conflict. The next conflicts updates fail even if they are current.
+type configMapServer struct {
+	mutex      sync.Mutex
+	configMaps map[string]*corev1.ConfigMap
+	version    int
+	conflicts  int
+}
+
+func (s *configMapServer) status(w http.ResponseWriter, code int32, reason metav1.StatusReason) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(int(code))
+	json.NewEncoder(w).Encode(&metav1.Status{TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}, Status: metav1.StatusFailure,
+		Code: code, Reason: reason, Details: &metav1.StatusDetails{Kind: "configmaps"}})
+}
+
+func (s *configMapServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	const prefix = "/api/v1/namespaces/autoscaling/configmaps"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		s.status(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+	var body corev1.ConfigMap
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			s.status(w, http.StatusBadRequest, metav1.StatusReasonBadRequest)
+			return
+		}
+		name = body.Name
+	}
+	stored := s.configMaps[name]
+
+	switch r.Method {
+	case http.MethodGet:
+		if stored == nil {
+			s.status(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+			return
+		}
+	case http.MethodPost:
+		if stored != nil {
+			s.status(w, http.StatusConflict, metav1.StatusReasonAlreadyExists)
+			return
+		}
+		stored = s.save(&body)
+	case http.MethodPut:
+		if stored == nil {
+			s.status(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+			return
+		}
+		if s.conflicts > 0 || body.ResourceVersion != stored.ResourceVersion {
+			s.conflicts--
+			s.status(w, http.StatusConflict, metav1.StatusReasonConflict)
+			return
+		}
+		stored = s.save(&body)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stored)
+}
+
+func (s *configMapServer) save(configMap *corev1.ConfigMap) *corev1.ConfigMap {
+	s.version++
+	saved := configMap.DeepCopy()
+	saved.TypeMeta = metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"}
+	saved.ResourceVersion = strconv.Itoa(s.version)
+	if s.configMaps == nil {
+		s.configMaps = make(map[string]*corev1.ConfigMap)
+	}
+	s.configMaps[saved.Name] = saved
+	return saved
+}
+
+func newTestHandoff(t *testing.T, server *configMapServer) *Handoff {
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: httpServer.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHandoff(clientset, "autoscaling", "gac-handoff")
+}
+
+func TestHandoff(t *testing.T) {
+	server := &configMapServer{}
+	handoff := newTestHandoff(t, server)
+
+	// Nothing to take before the ConfigMap exists
+	if _, found, err := handoff.Take("Deployment/shop/web"); err != nil || found {
+		t.Fatalf("Take() = %v, %v on missing ConfigMap", found, err)
+	}
+
+	if err := handoff.Store("Deployment/shop/web", `{"replicas": 3}`); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	if err := handoff.Store("StatefulSet/shop/db", `{"replicas": 1}`); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	if data := server.configMaps["gac-handoff"].Data; data["Deployment.shop.web"] != `{"replicas": 3}` || len(data) != 2 {
+		t.Fatalf("unexpected ConfigMap data %v", data)
+	}
+
+	state, found, err := handoff.Take("Deployment/shop/web")
+	if err != nil || !found || state != `{"replicas": 3}` {
+		t.Fatalf("Take() = %q, %v, %v", state, found, err)
+	}
+	// The state is handed over once
+	if _, found, err := handoff.Take("Deployment/shop/web"); err != nil || found {
+		t.Fatalf("state taken twice: %v, %v", found, err)
+	}
+	if state, found, _ := handoff.Take("StatefulSet/shop/db"); !found || state != `{"replicas": 1}` {
+		t.Fatalf("state of other target lost: %q, %v", state, found)
+	}
+}
+
+func TestHandoffRetriesConflicts(t *testing.T) {
+	server := &configMapServer{}
+	handoff := newTestHandoff(t, server)
+	if err := handoff.Store("Deployment/shop/web", "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	server.conflicts = 2
+	if err := handoff.Store("Deployment/shop/api", "second"); err != nil {
+		t.Fatalf("Store did not retry the conflict: %v", err)
+	}
+	server.conflicts = 2
+	if state, found, err := handoff.Take("Deployment/shop/web"); err != nil || !found || state != "first" {
+		t.Fatalf("Take() = %q, %v, %v", state, found, err)
+	}
+	if data := server.configMaps["gac-handoff"].Data; len(data) != 1 || data["Deployment.shop.api"] != "second" {
+		t.Fatalf("unexpected ConfigMap data %v", data)
+	}
+
+	// Persistent conflicts are reported
+	server.conflicts = 100
+	if err := handoff.Store("Deployment/shop/web", "third"); err == nil {
+		t.Fatalf("persistent conflicts not reported")
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package sharding
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/config"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"time"
+)
+
+// MemberLabel marks the Leases of the controller replicas taking part in sharding.
+const MemberLabel = "bsinfo.hhu.de/autoscaler-shard"
+
+// Membership announces this replica with its own Lease and keeps track of the replicas holding a live Lease.
+// Leases are compared against the local clock, so the clocks of the replicas must not drift apart by much.
+type Membership struct {
+	kubeclientset kubernetes.Interface
+	namespace     string
+	identity      string
+	leaseDuration time.Duration
+	renewInterval time.Duration
+	onChange      func(previous, current *Ring)
+	ring          *Ring
+	lastRenewal   time.Time
+}
+
+// NewMembership creates the membership of this replica. onChange is called with the previous and the current ring
+// whenever replicas join or leave, the first time with the ring as it looked before this replica joined.
+func NewMembership(kubeclientset kubernetes.Interface, sharding config.ShardingConfig, identity string, onChange func(previous, current *Ring)) *Membership {
+	return &Membership{kubeclientset: kubeclientset, namespace: sharding.Namespace, identity: identity,
+		leaseDuration: time.Duration(sharding.LeaseDuration) * time.Second, renewInterval: time.Duration(sharding.RenewInterval) * time.Second,
+		onChange: onChange}
+}
+
+func (m *Membership) leaseName() string {
+	return "gac-shard-" + m.identity
+}
+
+func (m *Membership) renew() error {
+	leases := m.kubeclientset.CoordinationV1().Leases(m.namespace)
+	now := metav1.NewMicroTime(time.Now())
+	seconds := int32(m.leaseDuration / time.Second)
+
+	lease, err := leases.Get(m.leaseName(), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: m.leaseName(), Namespace: m.namespace, Labels: map[string]string{MemberLabel: "true"}},
+			Spec:       coordinationv1.LeaseSpec{HolderIdentity: &m.identity, LeaseDurationSeconds: &seconds, AcquireTime: &now, RenewTime: &now},
+		}
+		_, err = leases.Create(lease)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	lease.Spec.HolderIdentity = &m.identity
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(lease)
+	return err
+}
+
+// members lists the holders of live Leases. Leases expired for a long time belong to replicas that are gone for
+// good and are removed.
+func (m *Membership) members() ([]string, error) {
+	leases := m.kubeclientset.CoordinationV1().Leases(m.namespace)
+	list, err := leases.List(metav1.ListOptions{LabelSelector: MemberLabel + "=true"})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var members []string
+	for _, lease := range list.Items {
+		if lease.Spec.HolderIdentity == nil || lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		duration := time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+		expiry := lease.Spec.RenewTime.Add(duration)
+		if now.Before(expiry) {
+			members = append(members, *lease.Spec.HolderIdentity)
+		} else if now.After(expiry.Add(5 * duration)) {
+			log.Debugf("Removing expired lease %s", lease.Name)
+			if err := leases.Delete(lease.Name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+				log.Warnf("Could not remove expired lease %s: %v", lease.Name, err)
+			}
+		}
+	}
+	return members, nil
+}
+
+// sync renews the Lease of this replica and updates the ring. A replica that could not renew its Lease in time has
+// to assume the others took over its targets and continues with an empty ring.
+func (m *Membership) sync() {
+	if err := m.renew(); err != nil {
+		log.Errorf("Could not renew lease %s: %v", m.leaseName(), err)
+	} else {
+		m.lastRenewal = time.Now()
+	}
+
+	var ring *Ring
+	if time.Since(m.lastRenewal) > m.leaseDuration {
+		ring = NewRing(nil)
+	} else {
+		members, err := m.members()
+		if err != nil {
+			log.Errorf("Could not list shard members: %v", err)
+			return
+		}
+		ring = NewRing(members)
+	}
+
+	previous := m.ring
+	if previous == nil {
+		previous = ring.Without(m.identity)
+	} else if previous.Equal(ring) {
+		return
+	}
+	log.Infof("Shard members changed to %v", ring.Members())
+	m.ring = ring
+	m.onChange(previous, ring)
+}
+
+// Run keeps the membership up to date until the stop channel is closed.
+func (m *Membership) Run(stopChan <-chan struct{}) {
+	log.Infof("Joining shard members as %s (lease namespace: %s)", m.identity, m.namespace)
+	m.sync()
+
+	ticker := time.NewTicker(m.renewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+			m.sync()
+		}
+	}
+}
+
+// Leave removes the Lease of this replica, so the others take over its targets without waiting for it to expire.
+func (m *Membership) Leave() {
+	log.Infof("Leaving shard members")
+	if err := m.kubeclientset.CoordinationV1().Leases(m.namespace).Delete(m.leaseName(), &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		log.Errorf("Could not remove lease %s: %v", m.leaseName(), err)
+	}
+}
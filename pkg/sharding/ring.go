@@ -0,0 +1,112 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package sharding
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// virtualNodes is the number of points every member occupies on the ring, it evens out the share of targets.
+const virtualNodes = 100
+
+// Ring assigns keys to members by consistent hashing, so that a joining or leaving member only moves the keys it
+// gains or loses.
+type Ring struct {
+	members []string
+	points  []uint64
+	owners  map[uint64]string
+}
+
+// hash spreads similar keys over the whole ring. FNV alone hardly changes its upper bits for keys that only differ
+// in their last characters, the finalizer of MurmurHash3 mixes them.
+func hash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+func NewRing(members []string) *Ring {
+	sorted := append([]string(nil), members...)
+	sort.Strings(sorted)
+
+	ring := &Ring{members: sorted, owners: make(map[uint64]string, len(sorted)*virtualNodes)}
+	for _, member := range sorted {
+		for i := 0; i < virtualNodes; i++ {
+			point := hash(member + "#" + strconv.Itoa(i))
+			ring.points = append(ring.points, point)
+			ring.owners[point] = member
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i] < ring.points[j] })
+	return ring
+}
+
+// Owner returns the member owning the key, an empty string if the ring has no members.
+func (r *Ring) Owner(key string) string {
+	if r == nil || len(r.points) == 0 {
+		return ""
+	}
+	point := hash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= point })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+func (r *Ring) Members() []string {
+	if r == nil {
+		return nil
+	}
+	return r.members
+}
+
+func (r *Ring) Has(member string) bool {
+	for _, m := range r.Members() {
+		if m == member {
+			return true
+		}
+	}
+	return false
+}
+
+// Without returns the ring as it looks without the given member.
+func (r *Ring) Without(member string) *Ring {
+	var members []string
+	for _, m := range r.Members() {
+		if m != member {
+			members = append(members, m)
+		}
+	}
+	return NewRing(members)
+}
+
+func (r *Ring) Equal(other *Ring) bool {
+	members, otherMembers := r.Members(), other.Members()
+	if len(members) != len(otherMembers) {
+		return false
+	}
+	for i := range members {
+		if members[i] != otherMembers[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package sharding
+
+import (
+	"fmt"
+	"testing"
+)
+
+func targetKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("shop-%d/web-%d", i%7, i)
+	}
+	return keys
+}
+
+func assignment(ring *Ring, keys []string) map[string]string {
+	owners := make(map[string]string, len(keys))
+	for _, key := range keys {
+		owners[key] = ring.Owner(key)
+	}
+	return owners
+}
+
+func TestRingIsDeterministic(t *testing.T) {
+	keys := targetKeys(500)
+	first := assignment(NewRing([]string{"gac-a", "gac-b", "gac-c"}), keys)
+	second := assignment(NewRing([]string{"gac-c", "gac-a", "gac-b"}), keys)
+	for _, key := range keys {
+		if first[key] != second[key] {
+			t.Fatalf("key %s owned by %s and %s depending on the member order", key, first[key], second[key])
+		}
+	}
+}
+
+func TestRingBalance(t *testing.T) {
+	members := []string{"gac-a", "gac-b", "gac-c", "gac-d"}
+	keys := targetKeys(4000)
+	counts := make(map[string]int)
+	for _, owner := range assignment(NewRing(members), keys) {
+		counts[owner]++
+	}
+	for _, member := range members {
+		share := float64(counts[member]) / float64(len(keys))
+		if share < 0.15 || share > 0.35 {
+			t.Errorf("member %s owns %.0f%% of the keys", member, share*100)
+		}
+	}
+}
+
+func TestRingStability(t *testing.T) {
+	keys := targetKeys(2000)
+	ring := NewRing([]string{"gac-a", "gac-b", "gac-c"})
+	before := assignment(ring, keys)
+
+	// A joining member only takes keys, it never moves keys between the existing members
+	joined := assignment(NewRing([]string{"gac-a", "gac-b", "gac-c", "gac-d"}), keys)
+	moved := 0
+	for _, key := range keys {
+		if joined[key] != before[key] {
+			if joined[key] != "gac-d" {
+				t.Fatalf("key %s moved from %s to %s", key, before[key], joined[key])
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > len(keys)/2 {
+		t.Errorf("%d of %d keys moved to the joining member", moved, len(keys))
+	}
+
+	// A leaving member only gives away its own keys
+	left := assignment(ring.Without("gac-b"), keys)
+	for _, key := range keys {
+		if before[key] != "gac-b" && left[key] != before[key] {
+			t.Fatalf("key %s moved from %s to %s although its owner stayed", key, before[key], left[key])
+		}
+		if left[key] == "gac-b" {
+			t.Fatalf("key %s still owned by the leaving member", key)
+		}
+	}
+}
+
+func TestRingMembers(t *testing.T) {
+	var empty *Ring
+	if owner := empty.Owner("shop/web"); owner != "" {
+		t.Errorf("nil ring returned owner %q", owner)
+	}
+	if owner := NewRing(nil).Owner("shop/web"); owner != "" {
+		t.Errorf("empty ring returned owner %q", owner)
+	}
+
+	ring := NewRing([]string{"gac-b", "gac-a"})
+	if !ring.Has("gac-a") || ring.Has("gac-c") {
+		t.Errorf("unexpected members %v", ring.Members())
+	}
+	if !ring.Equal(NewRing([]string{"gac-a", "gac-b"})) || ring.Equal(ring.Without("gac-a")) || !empty.Equal(NewRing(nil)) {
+		t.Errorf("Equal does not compare the members")
+	}
+	if without := ring.Without("gac-a"); without.Has("gac-a") || !without.Has("gac-b") || !ring.Has("gac-a") {
+		t.Errorf("Without modified the ring or kept the member")
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+package status
+
+import (
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/client/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"reflect"
+)
+
+// Updater maintains the per-target entries in the status of autoscaling rules.
+type Updater struct {
+	rulesClientset versioned.Interface
+}
+
+func NewUpdater(rulesClientset versioned.Interface) *Updater {
+	return &Updater{rulesClientset: rulesClientset}
+}
+
+func sameTarget(a v1.TargetStatus, b v1.TargetStatus) bool {
+	return a.Kind == b.Kind && a.Namespace == b.Namespace && a.Name == b.Name
+}
+
+func find(status *v1.AutoscalingRuleStatus, targetStatus v1.TargetStatus) *v1.TargetStatus {
+	for i := range status.Targets {
+		if sameTarget(status.Targets[i], targetStatus) {
+			return &status.Targets[i]
+		}
+	}
+	return nil
+}
+
+// unchanged compares two entries without their timestamps.
+func unchanged(current *v1.TargetStatus, targetStatus v1.TargetStatus) bool {
+	if current == nil {
+		return false
+	}
+	a := *current.DeepCopy()
+	b := *targetStatus.DeepCopy()
+	a.LastUpdateTime = metav1.Time{}
+	b.LastUpdateTime = metav1.Time{}
+	for i := range a.Conditions {
+		a.Conditions[i].LastTransitionTime = metav1.Time{}
+	}
+	for i := range b.Conditions {
+		b.Conditions[i].LastTransitionTime = metav1.Time{}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// setTransitionTimes keeps the transition time of conditions whose status did not change, the others changed now.
+func setTransitionTimes(current *v1.TargetStatus, targetStatus *v1.TargetStatus, now metav1.Time) {
+	for i := range targetStatus.Conditions {
+		condition := &targetStatus.Conditions[i]
+		condition.LastTransitionTime = now
+		if current == nil {
+			continue
+		}
+		for _, previous := range current.Conditions {
+			if previous.Type == condition.Type && previous.Status == condition.Status {
+				condition.LastTransitionTime = previous.LastTransitionTime
+			}
+		}
+	}
+}
+
+// UpdateTarget writes the entry of a target into the status of the rule. Nothing is written if the (cached) rule
+// already carries the same entry.
+func (u *Updater) UpdateTarget(rule *v1.AutoscalingRule, targetStatus v1.TargetStatus) error {
+	if unchanged(find(&rule.Status, targetStatus), targetStatus) {
+		return nil
+	}
+
+	rules := u.rulesClientset.BsinfoV1().AutoscalingRules(rule.Namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest, err := rules.Get(rule.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		current := find(&latest.Status, targetStatus)
+		if unchanged(current, targetStatus) {
+			return nil
+		}
+
+		targetStatus.LastUpdateTime = metav1.Now()
+		setTransitionTimes(current, &targetStatus, targetStatus.LastUpdateTime)
+		if current != nil {
+			*current = targetStatus
+		} else {
+			latest.Status.Targets = append(latest.Status.Targets, targetStatus)
+		}
+		_, err = rules.UpdateStatus(latest)
+		return err
+	})
+}
@@ -0,0 +1,173 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+
+// Package webhook receives pushed samples and evaluation requests for rules, either as alertmanager notification
+// or as a simple JSON payload:
+//
+//	{"rule": "autoscaling/memory-usage-rule", "value": "850m", "delta": "20m"}
+//
+// Alertmanager alerts name the rule in their "rule" label and may carry a value in a "value" annotation.
+package webhook
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/autoscaler"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ruleLabel       = "rule"
+	valueAnnotation = "value"
+)
+
+// Dispatcher hands a push or evaluation request for a rule to all affected targets.
+type Dispatcher interface {
+	// Resolve finds the rule referenced by namespace/name or by its name alone
+	Resolve(reference string) (*v1.AutoscalingRule, error)
+	// Trigger requests the evaluation of the rule and returns the affected targets
+	Trigger(rule *v1.AutoscalingRule, push *autoscaler.Push) []string
+}
+
+type alert struct {
+	Status      string            `json:"status"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// payload covers both formats, alertmanager notifications are recognized by their alerts
+type payload struct {
+	Alerts []alert `json:"alerts"`
+
+	Rule      string             `json:"rule"`
+	Value     *resource.Quantity `json:"value,omitempty"`
+	Delta     *resource.Quantity `json:"delta,omitempty"`
+	Timestamp *time.Time         `json:"timestamp,omitempty"`
+}
+
+type request struct {
+	rule string
+	push *autoscaler.Push
+}
+
+func (p payload) requests() ([]request, error) {
+	if len(p.Alerts) == 0 {
+		if p.Rule == "" {
+			return nil, fmt.Errorf("payload names neither a rule nor alerts")
+		}
+		if p.Value == nil {
+			if p.Delta != nil {
+				return nil, fmt.Errorf("a pushed delta requires a value")
+			}
+			return []request{{rule: p.Rule}}, nil
+		}
+
+		push := &autoscaler.Push{Value: *p.Value, Delta: p.Delta, Timestamp: time.Now()}
+		if p.Timestamp != nil {
+			push.Timestamp = *p.Timestamp
+		}
+		return []request{{rule: p.Rule, push: push}}, nil
+	}
+
+	var requests []request
+	for _, a := range p.Alerts {
+		rule := a.Labels[ruleLabel]
+		if rule == "" {
+			log.Debugf("Ignoring alert without %s label: %v", ruleLabel, a.Labels)
+			continue
+		}
+		r := request{rule: rule}
+		if value, exists := a.Annotations[valueAnnotation]; exists && a.Status != "resolved" {
+			quantity, err := resource.ParseQuantity(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q of alert for rule %s: %v", value, rule, err)
+			}
+			r.push = &autoscaler.Push{Value: quantity, Timestamp: time.Now()}
+		}
+		requests = append(requests, r)
+	}
+	return requests, nil
+}
+
+type handler struct {
+	dispatcher Dispatcher
+	token      string
+}
+
+// Handler creates the webhook endpoint. Requests must carry the token as bearer token, without a token all
+// requests are refused.
+func Handler(dispatcher Dispatcher, token string) http.Handler {
+	return &handler{dispatcher: dispatcher, token: token}
+}
+
+func (h *handler) authorized(r *http.Request) bool {
+	if h.token == "" {
+		return false
+	}
+	provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(h.token)) == 1
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var p payload
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&p); err != nil {
+		http.Error(w, fmt.Sprintf("invalid payload: %v", err), http.StatusBadRequest)
+		return
+	}
+	requests, err := p.requests()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// All rules are resolved before the first one is triggered, a request is either dispatched completely or not
+	rules := make([]*v1.AutoscalingRule, len(requests))
+	for i, req := range requests {
+		rule, err := h.dispatcher.Resolve(req.rule)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.IsNotFound(err) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		rules[i] = rule
+	}
+
+	triggered := make(map[string][]string)
+	for i, req := range requests {
+		targets := h.dispatcher.Trigger(rules[i], req.push)
+		log.Infof("Webhook triggered evaluation of rule %s for targets %v (pushed sample: %v)", req.rule, targets, req.push != nil)
+		triggered[req.rule] = targets
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"triggered": triggered})
+}
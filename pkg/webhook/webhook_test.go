@@ -0,0 +1,121 @@
+/*
+ *  Copyright (C) 2019 Heinrich-Heine-Universitaet Duesseldorf, Institute of Computer Science, Department Operating Systems
+ *
+ *  This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+ *  warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>
+ */
+package webhook
+
+import (
+	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
+	"github.com/grieshaber/generic-autoscaler-controller/pkg/autoscaler"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeDispatcher struct {
+	rules     map[string]bool
+	triggered []string
+}
+
+func (d *fakeDispatcher) Resolve(reference string) (*v1.AutoscalingRule, error) {
+	if !d.rules[reference] {
+		return nil, errors.NewNotFound(v1.Resource("autoscalingrules"), reference)
+	}
+	return &v1.AutoscalingRule{ObjectMeta: metav1.ObjectMeta{Namespace: "autoscaling", Name: reference}}, nil
+}
+
+func (d *fakeDispatcher) Trigger(rule *v1.AutoscalingRule, push *autoscaler.Push) []string {
+	d.triggered = append(d.triggered, rule.Name)
+	return []string{"Deployment/shop/web"}
+}
+
+func post(handler http.Handler, token, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAuthorization(t *testing.T) {
+	body := `{"rule": "cpu-rule"}`
+	for _, test := range []struct {
+		name, configured, provided string
+		status                     int
+	}{
+		{"valid token", "secret", "secret", http.StatusAccepted},
+		{"wrong token", "secret", "guess", http.StatusUnauthorized},
+		{"missing token", "secret", "", http.StatusUnauthorized},
+		{"no token configured", "", "", http.StatusUnauthorized},
+		{"no token configured but provided", "", "anything", http.StatusUnauthorized},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dispatcher := &fakeDispatcher{rules: map[string]bool{"cpu-rule": true}}
+			response := post(Handler(dispatcher, test.configured), test.provided, body)
+			if response.Code != test.status {
+				t.Errorf("status = %d, expected %d", response.Code, test.status)
+			}
+			if test.status != http.StatusAccepted && len(dispatcher.triggered) > 0 {
+				t.Errorf("unauthorized request triggered %v", dispatcher.triggered)
+			}
+		})
+	}
+}
+
+func TestDispatchIsAllOrNothing(t *testing.T) {
+	dispatcher := &fakeDispatcher{rules: map[string]bool{"cpu-rule": true, "memory-rule": true}}
+	handler := Handler(dispatcher, "secret")
+
+	body := `{"alerts": [
+		{"status": "firing", "labels": {"rule": "cpu-rule"}},
+		{"status": "firing", "labels": {"rule": "unknown-rule"}},
+		{"status": "firing", "labels": {"rule": "memory-rule"}}
+	]}`
+	if response := post(handler, "secret", body); response.Code != http.StatusNotFound {
+		t.Errorf("status = %d, expected %d", response.Code, http.StatusNotFound)
+	}
+	if len(dispatcher.triggered) > 0 {
+		t.Errorf("rules %v triggered although the request failed", dispatcher.triggered)
+	}
+
+	body = `{"alerts": [
+		{"status": "firing", "labels": {"rule": "cpu-rule"}, "annotations": {"value": "850m"}},
+		{"status": "resolved", "labels": {"rule": "memory-rule"}, "annotations": {"value": "20m"}},
+		{"status": "firing", "labels": {"alertname": "unrelated"}}
+	]}`
+	if response := post(handler, "secret", body); response.Code != http.StatusAccepted {
+		t.Errorf("status = %d, expected %d: %s", response.Code, http.StatusAccepted, response.Body)
+	}
+	if strings.Join(dispatcher.triggered, ",") != "cpu-rule,memory-rule" {
+		t.Errorf("triggered %v, expected cpu-rule and memory-rule", dispatcher.triggered)
+	}
+}
+
+func TestInvalidPayloads(t *testing.T) {
+	for _, body := range []string{
+		`not json`,
+		`{}`,
+		`{"rule": "cpu-rule", "delta": "1"}`,
+		`{"alerts": [{"status": "firing", "labels": {"rule": "cpu-rule"}, "annotations": {"value": "lots"}}]}`,
+	} {
+		dispatcher := &fakeDispatcher{rules: map[string]bool{"cpu-rule": true}}
+		if response := post(Handler(dispatcher, "secret"), "secret", body); response.Code != http.StatusBadRequest {
+			t.Errorf("payload %s: status = %d, expected %d", body, response.Code, http.StatusBadRequest)
+		}
+		if len(dispatcher.triggered) > 0 {
+			t.Errorf("payload %s triggered %v", body, dispatcher.triggered)
+		}
+	}
+}
@@ -12,15 +12,73 @@
 
 package util
 
+import (
+	"time"
+)
+
+// MetricEvaluation is the evaluation state of a single rule, maintained by the rule's scaling algorithm.
 type MetricEvaluation struct {
-	LastDelta      int64
-	AvgDelta	   int64
-	NumIterations int64
+	Algorithm string
+	LastDelta int64
+	// LastValue is the last value observed, in milli units
+	LastValue      int64
+	LastIncrease   float64
 	ViolationCount []float64
 	Replicas       float64
 	Higher         bool
+	// ProposedAt is the time Replicas were last proposed
+	ProposedAt time.Time
+	// Series is the number of series of the last value, combined by Aggregation
+	Series      int
+	Aggregation string
+	// History holds the recent values the delta is derived from if the rule has no delta metric
+	History []TimedValue
+	// CounterOffset is added to the values of a counter to undo its resets, LastRaw is the last value as measured
+	CounterOffset float64
+	LastRaw       float64
+	// ValueFilter and DeltaFilter are the states of the smoothing filters of the rule's inputs
+	ValueFilter FilterState
+	DeltaFilter FilterState
+	// Anomaly is the state of the anomaly detection of the rule's inputs
+	Anomaly AnomalyState
+}
+
+// AnomalyState holds the recent inputs anomalies are detected against and counts the detected anomalies.
+type AnomalyState struct {
+	Window []float64
+	// Pending is the number of consecutive anomalies waiting for confirmation
+	Pending   int32
+	Anomalies int64
+	LastScore float64
+	LastTime  time.Time
+}
+
+// FilterState is the state of a smoothing filter. Estimate and Variance are used by the ewma and kalman filters,
+// Window by the sma and median filters.
+type FilterState struct {
+	Type     string
+	Estimate float64
+	Variance float64
+	Window   []float64
+}
+
+// TimedValue is a value of a metric at a point in time.
+type TimedValue struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+func NewMetricEvaluation(algorithm string, replicas float64) *MetricEvaluation {
+	return &MetricEvaluation{Algorithm: algorithm, ViolationCount: make([]float64, 1, 5), Replicas: replicas}
 }
 
-func NewMetricEvaluation(replicas float64, delta int64) *MetricEvaluation {
-	return &MetricEvaluation{0, delta, 0, make([]float64, 1, 5), replicas, false}
+// Copy returns a deep copy of the evaluation.
+func (e *MetricEvaluation) Copy() *MetricEvaluation {
+	copied := *e
+	copied.ViolationCount = append([]float64(nil), e.ViolationCount...)
+	copied.History = append([]TimedValue(nil), e.History...)
+	copied.ValueFilter.Window = append([]float64(nil), e.ValueFilter.Window...)
+	copied.DeltaFilter.Window = append([]float64(nil), e.DeltaFilter.Window...)
+	copied.Anomaly.Window = append([]float64(nil), e.Anomaly.Window...)
+	return &copied
 }
@@ -15,21 +15,21 @@ package util
 import (
 	"fmt"
 	log "github.com/Sirupsen/logrus"
-	v1 "github.com/grieshaber/generic-autoscaler-controller/pkg/apis/autoscalingrule/v1"
 	"github.com/jedib0t/go-pretty/table"
+	"time"
 )
 
-func LogTable(metricEvaluations map[*v1.AutoscalingRule]*MetricEvaluation) {
+func LogTable(metricEvaluations map[string]*MetricEvaluation) {
 	if len(metricEvaluations) == 0 {
 		return
 	}
 
 	t := table.NewWriter()
 
-	t.AppendHeader(table.Row{"Rule", "Violation Count", "Desired Replicas", "LastDelta"})
+	t.AppendHeader(table.Row{"Rule", "Algorithm", "Violation Count", "Desired Replicas", "LastDelta", "Aggregation", "Series", "Age"})
 
 	for rule, me := range metricEvaluations {
-		t.AppendRow(table.Row{rule.Name, me.ViolationCount, me.Replicas, me.LastDelta})
+		t.AppendRow(table.Row{rule, me.Algorithm, me.ViolationCount, me.Replicas, me.LastDelta, me.Aggregation, me.Series, time.Since(me.ProposedAt).Round(time.Second)})
 	}
 
 	overview := t.Render()